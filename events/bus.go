@@ -0,0 +1,57 @@
+// Package events is an in-process publish/subscribe bus for game lifecycle
+// events. Side effects such as bot logs, statistics and notifications subscribe
+// to events rather than being called directly by the code raising them.
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// Handler is called with each event it is subscribed to.
+type Handler func(Event)
+
+var lock sync.RWMutex
+var handlers = make(map[Kind][]Handler)
+var allHandlers []Handler
+
+// Subscribe calls the handler for every event of the given kind.
+func Subscribe(kind Kind, h Handler) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	handlers[kind] = append(handlers[kind], h)
+}
+
+// SubscribeAll calls the handler for every event.
+func SubscribeAll(h Handler) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	allHandlers = append(allHandlers, h)
+}
+
+// Publish calls every handler subscribed to the event, in the order they
+// subscribed, before returning. Handlers that need to do slow work, such as
+// calling out to other servers, should do it in their own goroutine. A handler
+// that panics is logged and doesn't stop the remaining handlers.
+func Publish(e Event) {
+	lock.RLock()
+	hs := append([]Handler{}, handlers[e.Kind()]...)
+	hs = append(hs, allHandlers...)
+	lock.RUnlock()
+
+	for _, h := range hs {
+		call(h, e)
+	}
+}
+
+func call(h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("An error occurred handling the event %s:\n%v\n", e.Kind(), r)
+		}
+	}()
+
+	h(e)
+}
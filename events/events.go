@@ -0,0 +1,96 @@
+package events
+
+import (
+	"github.com/mleonard87/merknera/repository"
+)
+
+type Kind string
+
+const (
+	BOT_REGISTERED     Kind = "BOT_REGISTERED"
+	BOT_STATUS_CHANGED Kind = "BOT_STATUS_CHANGED"
+	GAME_CREATED       Kind = "GAME_CREATED"
+	MOVE_REQUESTED     Kind = "MOVE_REQUESTED"
+	MOVE_COMPLETED     Kind = "MOVE_COMPLETED"
+	GAME_COMPLETED     Kind = "GAME_COMPLETED"
+	GAME_SUSPENDED     Kind = "GAME_SUSPENDED"
+)
+
+type Event interface {
+	Kind() Kind
+}
+
+// BotRegistered is published when a bot registers, or re-registers an existing
+// version.
+type BotRegistered struct {
+	Bot          repository.Bot
+	GameType     repository.GameType
+	Mode         string
+	Reregistered bool
+}
+
+func (e BotRegistered) Kind() Kind { return BOT_REGISTERED }
+
+// BotStatusChanged is published when the health of a bot changes its status.
+type BotStatusChanged struct {
+	Bot    repository.Bot
+	From   repository.BotStatus
+	To     repository.BotStatus
+	Reason string
+}
+
+func (e BotStatusChanged) Kind() Kind { return BOT_STATUS_CHANGED }
+
+// GameCreated is published once a game and its players have been created.
+type GameCreated struct {
+	Game repository.Game
+}
+
+func (e GameCreated) Kind() Kind { return GAME_CREATED }
+
+// MoveRequested is published just before a bot is called for its next move.
+type MoveRequested struct {
+	Game     repository.Game
+	GameType repository.GameType
+	GameMove repository.GameMove
+	Bot      repository.Bot
+	Method   string
+}
+
+func (e MoveRequested) Kind() Kind { return MOVE_REQUESTED }
+
+// MoveCompleted is published once the call to a bot for its next move has
+// returned. Err is set if the call failed.
+type MoveCompleted struct {
+	Game     repository.Game
+	GameType repository.GameType
+	GameMove repository.GameMove
+	Bot      repository.Bot
+	Method   string
+	Err      error
+}
+
+func (e MoveCompleted) Kind() Kind { return MOVE_COMPLETED }
+
+// GameCompleted is published once a game has been won or drawn.
+type GameCompleted struct {
+	Game     repository.Game
+	GameType repository.GameType
+	// Either WIN or DRAW.
+	Result  string
+	Players []repository.GameBot
+}
+
+func (e GameCompleted) Kind() Kind { return GAME_COMPLETED }
+
+// GameSuspended is published when a bot's move causes an error, leaving the
+// game unfinished.
+type GameSuspended struct {
+	Game     repository.Game
+	GameType repository.GameType
+	GameMove repository.GameMove
+	Bot      repository.Bot
+	Err      error
+}
+
+func (e GameSuspended) Kind() Kind { return GAME_SUSPENDED }
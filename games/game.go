@@ -17,12 +17,27 @@ const (
 )
 
 type GameManager interface {
-	GenerateGames(bot repository.Bot) []repository.Game
+	// GenerateGames returns the pairings for the ranked games a newly ranked bot
+	// plays. The games aren't created until the pairings are released from the
+	// backlog.
+	GenerateGames(bot repository.Bot) ([]repository.Pairing, error)
+	// CreateGame creates a single game between the given bots, in the order that
+	// they are given, along with the first move of the game. The game is created
+	// as part of the transaction, once it is committed the caller publishes
+	// events.GameCreated.
+	CreateGame(tx *repository.Tx, players []repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error)
+	// CreateTeamGame creates a single game between teams of bots. Teams play in
+	// the order they are given and each bot is given the next play sequence in
+	// turn, so the first bot of each team plays before the second bot of any.
+	// As with CreateGame the game is created as part of the transaction.
+	CreateTeamGame(tx *repository.Tx, teams [][]repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error)
 	Mnemonic() string
 	Name() string
+	// TeamSize returns the number of bots on each team, 1 for games that aren't
+	// played in teams.
+	TeamSize() int
 	GetNextMoveRPCMethodName() string
 	GetNextMoveRPCParams(gameMove repository.GameMove) (interface{}, error)
-	GetNextMoveRPCResult(gameMove repository.GameMove) interface{}
 
 	GetCompleteRPCMethodName() string
 	GetCompleteRPCParams(gb repository.GameBot, gr GameResult) (interface{}, error)
@@ -43,19 +58,30 @@ type GameManagerMeta struct {
 
 var RegisteredGameManagers []GameManagerMeta
 
-func RegisterGameManager(gm GameManager) error {
-	_, err := repository.GetGameTypeByMnemonic(gm.Mnemonic())
-	if err != nil {
-		_, err := repository.CreateGameType(gm.Mnemonic(), gm.Name())
-		if err != nil {
-			return err
-		}
-	}
-
+// RegisterGameManager makes the game manager available to play games. Its game
+// type isn't stored until CreateGameTypes is called, so that game managers can
+// be registered before there is a database connection.
+func RegisterGameManager(gm GameManager) {
 	gmm := GameManagerMeta{}
 	gmm.GameManager = gm
 
 	RegisteredGameManagers = append(RegisteredGameManagers, gmm)
+}
+
+// CreateGameTypes stores the game type of each registered game manager that
+// doesn't already have one. It must be called on startup before any games are
+// played.
+func CreateGameTypes() error {
+	for _, gmm := range RegisteredGameManagers {
+		gm := gmm.GameManager
+		_, err := repository.GetGameTypeByMnemonic(gm.Mnemonic())
+		if err != nil {
+			_, err := repository.CreateGameType(gm.Mnemonic(), gm.Name())
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
@@ -69,3 +95,70 @@ func GetGameManager(gameType repository.GameType) (GameManager, error) {
 
 	return nil, errors.New("Unknown game type.")
 }
+
+// PairWithOpponents returns the pairings for the games a bot plays against the
+// given opponents, twice so that the bot's team plays once first and once
+// second. In team games the bot is teamed up with the opponents following each
+// one in turn and plays against the ones after them, so every opponent is played
+// against at least once. If there are too few opponents to make up the teams
+// there are no pairings.
+func PairWithOpponents(gm GameManager, gameType repository.GameType, bot repository.Bot, opponents []repository.Bot, kind repository.GameKind, rated bool) []repository.Pairing {
+	teamSize := gm.TeamSize()
+	if len(opponents) < teamSize*2-1 {
+		return []repository.Pairing{}
+	}
+
+	var pairings []repository.Pairing
+	for i := range opponents {
+		team := []repository.Bot{bot}
+		opposition := []repository.Bot{opponents[i]}
+		for j := 1; j < teamSize*2-1; j++ {
+			o := opponents[(i+j)%len(opponents)]
+			if j < teamSize {
+				team = append(team, o)
+			} else {
+				opposition = append(opposition, o)
+			}
+		}
+
+		pairings = append(pairings,
+			repository.Pairing{GameType: gameType, Teams: [][]repository.Bot{opposition, team}, Kind: kind, Rated: rated},
+			repository.Pairing{GameType: gameType, Teams: [][]repository.Bot{team, opposition}, Kind: kind, Rated: rated},
+		)
+	}
+
+	return pairings
+}
+
+// Teammate identifies another bot on the same team, passed to bots in their
+// NextMove params.
+type Teammate struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	PlaySequence int    `json:"playsequence"`
+}
+
+// GetTeammates returns the identities of the other bots on the same team as the
+// given game bot. The list is empty, rather than nil, if the bot has no
+// teammates so that it is always present in the params.
+func GetTeammates(gb repository.GameBot) ([]Teammate, error) {
+	gameBots, err := gb.Teammates()
+	if err != nil {
+		return nil, err
+	}
+
+	teammates := []Teammate{}
+	for _, t := range gameBots {
+		b, err := t.Bot()
+		if err != nil {
+			return nil, err
+		}
+		teammates = append(teammates, Teammate{
+			Name:         b.Name,
+			Version:      b.Version,
+			PlaySequence: t.PlaySequence,
+		})
+	}
+
+	return teammates, nil
+}
@@ -20,10 +20,7 @@ const (
 )
 
 func init() {
-	err := RegisterGameManager(new(TicTacToeGameManager))
-	if err != nil {
-		log.Fatal(err)
-	}
+	RegisterGameManager(new(TicTacToeGameManager))
 }
 
 type TicTacToeGameState []string
@@ -54,42 +51,54 @@ func (tgs *TicTacToeGameState) MarshalJSON() ([]byte, error) {
 
 type TicTacToeGameManager struct{}
 
-func (tgm TicTacToeGameManager) GenerateGames(bot repository.Bot) []repository.Game {
+// GenerateGames pairs the bot with every other ranked bot, twice so that it
+// plays once as each player.
+func (tgm TicTacToeGameManager) GenerateGames(bot repository.Bot) ([]repository.Pairing, error) {
 	gameType, err := repository.GetGameTypeByMnemonic(TICTACTOE_MNEMONIC)
 	if err != nil {
-		log.Fatal(err)
+		return []repository.Pairing{}, err
 	}
 
 	botList, err := repository.ListBotsForGameType(gameType)
 	if err != nil {
-		log.Fatal(err)
+		return []repository.Pairing{}, err
 	}
 
-	var gameList []repository.Game
+	// If its not the same bot as we are invoking this game for then pair them.
+	var opponents []repository.Bot
 	for _, b := range botList {
-		// If its not the same bot as we are invoking this game for then create the game.
 		if b.Id != bot.Id {
-			// Create a game for these two bots with the initial bot as player 1
-			game1, err := createGameWithPlayers(gameType, &b, &bot)
-			if err != nil {
-				log.Fatal(err)
-			}
+			opponents = append(opponents, b)
+		}
+	}
 
-			bot.Logf("Scheduled game with %s. You are player two (gameId: %d)", b.Name, game1.Id)
+	return PairWithOpponents(tgm, gameType, bot, opponents, repository.GAME_KIND_LADDER, true), nil
+}
 
-			// Create a game for these two bots with the initial bot as player 2
-			game2, err := createGameWithPlayers(gameType, &bot, &b)
-			if err != nil {
-				log.Fatal(err)
-			}
+func (tgm TicTacToeGameManager) CreateGame(tx *repository.Tx, players []repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error) {
+	if len(players) != 2 {
+		return repository.Game{}, errors.New("Tic-Tac-Toe must be played by exactly two bots.")
+	}
+
+	gameType, err := repository.GetGameTypeByMnemonic(TICTACTOE_MNEMONIC)
+	if err != nil {
+		return repository.Game{}, err
+	}
 
-			bot.Logf("Scheduled game with %s. You are player one (gameId: %d)", b.Name, game2.Id)
+	return createGameWithPlayers(tx, gameType, kind, rated, &players[0], &players[1])
+}
 
-			gameList = append(gameList, game1, game2)
+// Tic-Tac-Toe has no team variant so each team must be a single bot.
+func (tgm TicTacToeGameManager) CreateTeamGame(tx *repository.Tx, teams [][]repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error) {
+	var players []repository.Bot
+	for _, t := range teams {
+		if len(t) != 1 {
+			return repository.Game{}, errors.New("Tic-Tac-Toe cannot be played in teams.")
 		}
+		players = append(players, t[0])
 	}
 
-	return gameList
+	return tgm.CreateGame(tx, players, kind, rated)
 }
 
 func (tgm TicTacToeGameManager) Mnemonic() string {
@@ -100,6 +109,10 @@ func (tgm TicTacToeGameManager) Name() string {
 	return TICTACTOE_NAME
 }
 
+func (tgm TicTacToeGameManager) TeamSize() int {
+	return 1
+}
+
 func (tgm TicTacToeGameManager) GetNextMoveRPCMethodName() string {
 	return TICTACTOE_RPC_METHOD_NEXT_MOVE
 }
@@ -116,6 +129,7 @@ type nextMoveParams struct {
 	GameId    int                `json:"gameid"`
 	Mark      string             `json:"mark"`
 	GameState TicTacToeGameState `json:"gamestate"`
+	Teammates []Teammate         `json:"teammates"`
 }
 
 func (tgm TicTacToeGameManager) GetNextMoveRPCParams(gameMove repository.GameMove) (interface{}, error) {
@@ -142,23 +156,21 @@ func (tgm TicTacToeGameManager) GetNextMoveRPCParams(gameMove repository.GameMov
 		return nil, err
 	}
 
+	teammates, err := GetTeammates(gb)
+	if err != nil {
+		return nil, err
+	}
+
 	params := nextMoveParams{
 		GameId:    g.Id,
 		Mark:      mark,
 		GameState: tttGameState,
+		Teammates: teammates,
 	}
 
 	return params, nil
 }
 
-type nextMoveResponse struct {
-	Position int `json:"position"`
-}
-
-func (tgm TicTacToeGameManager) GetNextMoveRPCResult(gameMove repository.GameMove) interface{} {
-	return nextMoveResponse{}
-}
-
 func (tgm TicTacToeGameManager) ProcessMove(gameMove repository.GameMove, result map[string]interface{}) (interface{}, GameResult, error) {
 	var position int
 	if pos, ok := result["position"].(float64); ok {
@@ -269,17 +281,12 @@ func (tgm TicTacToeGameManager) GetCompleteRPCParams(gb repository.GameBot, gr G
 
 	win := false
 	if gr == GAME_RESULT_WIN {
-		wm, err := game.WinningMove()
-		if err != nil {
-			return nil, err
-		}
-
-		winninggb, err := wm.GameBot()
+		winningTeam, err := game.WinningTeam()
 		if err != nil {
 			return nil, err
 		}
 
-		if gb.Id == winninggb.Id {
+		if gb.Team == winningTeam {
 			win = true
 		}
 	}
@@ -328,23 +335,24 @@ func getMarkForPlaySequence(ps int) string {
 	return ""
 }
 
-func createGameWithPlayers(gameType repository.GameType, playerOne *repository.Bot, playerTwo *repository.Bot) (repository.Game, error) {
-	game, err := repository.CreateGame(gameType)
+func createGameWithPlayers(tx *repository.Tx, gameType repository.GameType, kind repository.GameKind, rated bool, playerOne *repository.Bot, playerTwo *repository.Bot) (repository.Game, error) {
+	game, err := repository.CreateGameTx(tx, gameType, kind, rated)
 	if err != nil {
 		return game, err
 	}
 
-	_, err = repository.CreateGameBot(game, *playerOne, 1)
+	firstPlayer, err := repository.CreateGameBotTx(tx, game, *playerOne, 1)
 	if err != nil {
 		return game, err
 	}
 
-	_, err = repository.CreateGameBot(game, *playerTwo, 2)
+	_, err = repository.CreateGameBotTx(tx, game, *playerTwo, 2)
 	if err != nil {
 		return game, err
 	}
 
-	err = createFirstGameMove(game)
+	initialGameState := make([]string, 9, 9)
+	_, err = repository.CreateGameMoveTx(tx, firstPlayer, initialGameState)
 	if err != nil {
 		return game, err
 	}
@@ -352,21 +360,6 @@ func createGameWithPlayers(gameType repository.GameType, playerOne *repository.B
 	return game, nil
 }
 
-func createFirstGameMove(game repository.Game) error {
-	players, err := game.Players()
-	if err != nil {
-		return err
-	}
-	firstPlayer := players[0]
-	initialGameState := make([]string, 9, 9)
-	_, err = repository.CreateGameMove(firstPlayer, initialGameState)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func isWinForMark(gs []string, m string) bool {
 	switch {
 	case gs[0] == m && gs[3] == m && gs[6] == m:
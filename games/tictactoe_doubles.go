@@ -0,0 +1,294 @@
+package games
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	TICTACTOE_DOUBLES_MNEMONIC             = "TICTACTOE_DOUBLES"
+	TICTACTOE_DOUBLES_NAME                 = "Tic-Tac-Toe Doubles"
+	TICTACTOE_DOUBLES_RPC_METHOD_NEXT_MOVE = "TicTacToeDoubles.NextMove"
+	TICTACTOE_DOUBLES_RPC_METHOD_COMPLETE  = "TicTacToeDoubles.Complete"
+	TICTACTOE_DOUBLES_RPC_METHOD_ERROR     = "TicTacToeDoubles.Error"
+
+	TICTACTOE_DOUBLES_TEAM_SIZE = 2
+)
+
+func init() {
+	RegisterGameManager(new(TicTacToeDoublesGameManager))
+}
+
+// TicTacToeDoublesGameManager plays Tic-Tac-Toe between two teams of two bots.
+// The first team plays X and the second O, and the bots take turns in play
+// sequence, so the first bot of each team moves before the second bot of either.
+type TicTacToeDoublesGameManager struct{}
+
+// GenerateGames pairs the bot with every other ranked bot, teamed up with and
+// against the others in turn.
+func (tdgm TicTacToeDoublesGameManager) GenerateGames(bot repository.Bot) ([]repository.Pairing, error) {
+	gameType, err := repository.GetGameTypeByMnemonic(TICTACTOE_DOUBLES_MNEMONIC)
+	if err != nil {
+		return []repository.Pairing{}, err
+	}
+
+	botList, err := repository.ListBotsForGameType(gameType)
+	if err != nil {
+		return []repository.Pairing{}, err
+	}
+
+	var opponents []repository.Bot
+	for _, b := range botList {
+		if b.Id != bot.Id {
+			opponents = append(opponents, b)
+		}
+	}
+
+	return PairWithOpponents(tdgm, gameType, bot, opponents, repository.GAME_KIND_LADDER, true), nil
+}
+
+// Tic-Tac-Toe Doubles can only be played in teams.
+func (tdgm TicTacToeDoublesGameManager) CreateGame(tx *repository.Tx, players []repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error) {
+	return repository.Game{}, errors.New("Tic-Tac-Toe Doubles must be played by two teams of two bots.")
+}
+
+func (tdgm TicTacToeDoublesGameManager) CreateTeamGame(tx *repository.Tx, teams [][]repository.Bot, kind repository.GameKind, rated bool) (repository.Game, error) {
+	if len(teams) != 2 || len(teams[0]) != TICTACTOE_DOUBLES_TEAM_SIZE || len(teams[1]) != TICTACTOE_DOUBLES_TEAM_SIZE {
+		return repository.Game{}, errors.New("Tic-Tac-Toe Doubles must be played by two teams of two bots.")
+	}
+
+	gameType, err := repository.GetGameTypeByMnemonic(TICTACTOE_DOUBLES_MNEMONIC)
+	if err != nil {
+		return repository.Game{}, err
+	}
+
+	game, err := repository.CreateGameTx(tx, gameType, kind, rated)
+	if err != nil {
+		return game, err
+	}
+
+	var firstPlayer repository.GameBot
+	for position := 0; position < TICTACTOE_DOUBLES_TEAM_SIZE; position++ {
+		for t, team := range teams {
+			sequence := position*len(teams) + t + 1
+			gb, err := repository.CreateTeamGameBotTx(tx, game, team[position], sequence, t+1)
+			if err != nil {
+				return game, err
+			}
+			if sequence == 1 {
+				firstPlayer = gb
+			}
+		}
+	}
+
+	initialGameState := make([]string, 9, 9)
+	_, err = repository.CreateGameMoveTx(tx, firstPlayer, initialGameState)
+	if err != nil {
+		return game, err
+	}
+
+	return game, nil
+}
+
+func (tdgm TicTacToeDoublesGameManager) Mnemonic() string {
+	return TICTACTOE_DOUBLES_MNEMONIC
+}
+
+func (tdgm TicTacToeDoublesGameManager) Name() string {
+	return TICTACTOE_DOUBLES_NAME
+}
+
+func (tdgm TicTacToeDoublesGameManager) TeamSize() int {
+	return TICTACTOE_DOUBLES_TEAM_SIZE
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetNextMoveRPCMethodName() string {
+	return TICTACTOE_DOUBLES_RPC_METHOD_NEXT_MOVE
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetCompleteRPCMethodName() string {
+	return TICTACTOE_DOUBLES_RPC_METHOD_COMPLETE
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetErrorRPCMethodName() string {
+	return TICTACTOE_DOUBLES_RPC_METHOD_ERROR
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetNextMoveRPCParams(gameMove repository.GameMove) (interface{}, error) {
+	gb, err := gameMove.GameBot()
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := gb.Game()
+	if err != nil {
+		return nil, err
+	}
+
+	gs, err := g.GameState()
+	if err != nil {
+		return nil, err
+	}
+
+	var tttGameState TicTacToeGameState
+	err = json.Unmarshal([]byte(gs), &tttGameState)
+	if err != nil {
+		return nil, err
+	}
+
+	teammates, err := GetTeammates(gb)
+	if err != nil {
+		return nil, err
+	}
+
+	params := nextMoveParams{
+		GameId:    g.Id,
+		Mark:      getMarkForTeam(gb.Team),
+		GameState: tttGameState,
+		Teammates: teammates,
+	}
+
+	return params, nil
+}
+
+func (tdgm TicTacToeDoublesGameManager) ProcessMove(gameMove repository.GameMove, result map[string]interface{}) (interface{}, GameResult, error) {
+	var position int
+	if pos, ok := result["position"].(float64); ok {
+		position = int(pos)
+	} else {
+		return nil, GAME_RESULT_UNDECIDED, errors.New("Could not find property \"position\" in your response or position was not an integer.")
+	}
+
+	gb, err := gameMove.GameBot()
+	if err != nil {
+		return nil, GAME_RESULT_UNDECIDED, err
+	}
+
+	game, err := gb.Game()
+	if err != nil {
+		return nil, GAME_RESULT_UNDECIDED, err
+	}
+
+	gs, err := game.GameState()
+	if err != nil {
+		return nil, GAME_RESULT_UNDECIDED, err
+	}
+
+	var tttGameState TicTacToeGameState
+	err = json.Unmarshal([]byte(gs), &tttGameState)
+	if err != nil {
+		return nil, GAME_RESULT_UNDECIDED, err
+	}
+
+	// Check that the position played is within the range of the game board.
+	if position >= len(tttGameState) || position < 0 {
+		msg := fmt.Sprintf("Invalid position: \"%d\" is not a valid position in a 3x3 Tic-Tac-Toe board. Valid positions are 0-8 inclusive.", position)
+		return nil, GAME_RESULT_UNDECIDED, errors.New(msg)
+	}
+
+	// Check that the position played has not already been played.
+	if tttGameState[position] != "" {
+		msg := fmt.Sprintf("Invalid position: The position you played, \"%d\", is already taken by \"%s\"", position, tttGameState[position])
+		return nil, GAME_RESULT_UNDECIDED, errors.New(msg)
+	}
+
+	mark := getMarkForTeam(gb.Team)
+	tttGameState[position] = mark
+
+	if isWinForMark(tttGameState, mark) {
+		return tttGameState, GAME_RESULT_WIN, nil
+	}
+
+	for _, v := range tttGameState {
+		if v == "" {
+			return tttGameState, GAME_RESULT_UNDECIDED, nil
+		}
+	}
+
+	return tttGameState, GAME_RESULT_DRAW, nil
+}
+
+// GetGameBotForNextMove returns the bot with the next play sequence, going back
+// to the first bot after the last.
+func (tdgm TicTacToeDoublesGameManager) GetGameBotForNextMove(currentMove repository.GameMove) (repository.GameBot, error) {
+	gb, err := currentMove.GameBot()
+	if err != nil {
+		return repository.GameBot{}, err
+	}
+
+	game, err := gb.Game()
+	if err != nil {
+		return repository.GameBot{}, err
+	}
+
+	gameBots, err := game.Players()
+	if err != nil {
+		return repository.GameBot{}, err
+	}
+
+	nextSequence := gb.PlaySequence%len(gameBots) + 1
+	for _, b := range gameBots {
+		if b.PlaySequence == nextSequence {
+			return b, nil
+		}
+	}
+
+	return repository.GameBot{}, errors.New("Could not find GameBot for next move.")
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetCompleteRPCParams(gb repository.GameBot, gr GameResult) (interface{}, error) {
+	game, err := gb.Game()
+	if err != nil {
+		return nil, err
+	}
+
+	gs, err := game.GameState()
+	if err != nil {
+		return nil, err
+	}
+
+	win := false
+	if gr == GAME_RESULT_WIN {
+		winningTeam, err := game.WinningTeam()
+		if err != nil {
+			return nil, err
+		}
+
+		if gb.Team == winningTeam {
+			win = true
+		}
+	}
+
+	var tgs TicTacToeGameState
+	err = json.Unmarshal([]byte(gs), &tgs)
+	if err != nil {
+		return nil, err
+	}
+	cp := completeParams{
+		GameId:    game.Id,
+		Winner:    win,
+		Mark:      getMarkForTeam(gb.Team),
+		GameState: tgs,
+	}
+
+	return cp, nil
+}
+
+func (tdgm TicTacToeDoublesGameManager) GetErrorRPCParams(gm repository.GameMove, errorMessage string) interface{} {
+	gb, _ := gm.GameBot()
+	game, _ := gb.Game()
+	return errorParams{
+		GameId:    game.Id,
+		Message:   errorMessage,
+		ErrorCode: 9999,
+	}
+}
+
+// getMarkForTeam returns the mark played by every bot on the team. Teams are
+// numbered from 1 so the first team plays X.
+func getMarkForTeam(team int) string {
+	return getMarkForPlaySequence(team)
+}
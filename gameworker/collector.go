@@ -1,11 +1,29 @@
 package gameworker
 
-import "github.com/mleonard87/merknera/repository"
+import (
+	"log"
 
-var GameMoveQueue = make(chan GameMoveRequest, 100)
+	"github.com/mleonard87/merknera/repository"
+)
+
+// moveQueued wakes the dispatcher when a move is queued so that it doesn't have
+// to wait for its next poll of the job table.
+var moveQueued = make(chan bool, 1)
 
 func QueueGameMove(move repository.GameMove) {
-	gmrequest := GameMoveRequest{GameMove: move}
+	err := repository.EnqueueGameMove(move)
+	if err != nil {
+		log.Printf("Error queueing game move (game move id: %d):\n%v\n", move.Id, err)
+		return
+	}
+
+	notifyMoveQueued()
+}
 
-	GameMoveQueue <- gmrequest
+// notifyMoveQueued wakes the dispatcher, e.g. after a move has been queued.
+func notifyMoveQueued() {
+	select {
+	case moveQueued <- true:
+	default:
+	}
 }
@@ -1,30 +1,191 @@
 package gameworker
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_MOVE_LEASE          = "MERKNERA_MOVE_LEASE"
+	ENVVAR_MOVE_MAX_ATTEMPTS   = "MERKNERA_MOVE_MAX_ATTEMPTS"
+	ENVVAR_MAX_BOT_CONCURRENCY = "MERKNERA_MAX_BOT_CONCURRENCY"
+	ENVVAR_PRIORITY_AGING      = "MERKNERA_PRIORITY_AGING"
+	ENVVAR_FAIR_SHARE_WINDOW   = "MERKNERA_FAIR_SHARE_WINDOW"
+
+	// The default number of seconds a move is leased to a worker node for. The
+	// lease is extended by each heartbeat from the node so it only expires if the
+	// node stops.
+	DEFAULT_MOVE_LEASE = 300
+	// The default number of times a move may be claimed before it is failed.
+	DEFAULT_MOVE_MAX_ATTEMPTS = 5
+	// The default maximum number of moves that may be played at once by a single
+	// bot, whatever the bot declares it can handle.
+	DEFAULT_MAX_BOT_CONCURRENCY = 4
+	// The default number of seconds a queued move waits before it is raised to
+	// the next priority, so that first moves and background games still make
+	// progress whilst games under way keep the workers busy.
+	DEFAULT_PRIORITY_AGING = 30
+	// The default number of seconds of recent moves counted when sharing the
+	// workers fairly between bot owners.
+	DEFAULT_FAIR_SHARE_WINDOW = 300
+	// How often the job table is checked for moves when no new moves have been
+	// queued by this process.
+	MOVE_POLL_INTERVAL = time.Second
+)
 
 var WorkerQueue chan chan GameMoveRequest
 
+// inFlight counts the moves that have been handed to workers and not yet
+// finished.
+var inFlight sync.WaitGroup
+
+// stopDispatcher is closed to stop the dispatcher claiming moves and
+// dispatcherStopped is closed once it has stopped.
+var stopDispatcher = make(chan bool)
+var dispatcherStopped = make(chan bool)
+
+func envInt(name string, defaultValue int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 1 {
+		return defaultValue
+	}
+
+	return v
+}
+
+// MaxBotConcurrency is the most moves that any one bot may be asked to play at
+// once.
+func MaxBotConcurrency() int {
+	return envInt(ENVVAR_MAX_BOT_CONCURRENCY, DEFAULT_MAX_BOT_CONCURRENCY)
+}
+
 func StartGameMoveDispatcher(numworkers int) {
+	lease := time.Duration(envInt(ENVVAR_MOVE_LEASE, DEFAULT_MOVE_LEASE)) * time.Second
+	maxAttempts := envInt(ENVVAR_MOVE_MAX_ATTEMPTS, DEFAULT_MOVE_MAX_ATTEMPTS)
+	maxBotConcurrency := MaxBotConcurrency()
+	priorityAging := time.Duration(envInt(ENVVAR_PRIORITY_AGING, DEFAULT_PRIORITY_AGING)) * time.Second
+	fairShareWindow := time.Duration(envInt(ENVVAR_FAIR_SHARE_WINDOW, DEFAULT_FAIR_SHARE_WINDOW)) * time.Second
+
+	err := startWorkerNode(lease)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("Starting dispatcher")
-	// first, initialize the channel we are going to put the workers work channels into.
-	WorkerQueue = make(chan chan GameMoveRequest, numworkers)
+	// first, initialize the channel we are going to put the workers work channels
+	// into. It is large enough for the biggest pool so a worker never blocks
+	// adding itself.
+	WorkerQueue = make(chan chan GameMoveRequest, MAX_WORKERS)
 
 	// Now, create all our workers.
-	for i := 0; i < numworkers; i++ {
-		fmt.Println("Starting worker", i+1)
-		worker := NewGameMoveWorker(i+1, WorkerQueue)
-		worker.Start()
+	err = ResizeWorkerPool(numworkers)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	go func() {
+		defer close(dispatcherStopped)
+		var worker chan GameMoveRequest
 		for {
-			select {
-			case work := <-GameMoveQueue:
-				go func() {
-					worker := <-WorkerQueue
-					worker <- work
-				}()
+			// Wait for a worker to be free before claiming a move so that moves
+			// are only leased whilst they are being played.
+			if worker == nil {
+				select {
+				case worker = <-WorkerQueue:
+				case <-stopDispatcher:
+					return
+				}
+			}
+
+			// If the pool has been shrunk stop this worker rather than giving
+			// it another move.
+			if retireWorker(worker) {
+				worker = nil
+				continue
+			}
+
+			work, ok := claimGameMove(lease, maxAttempts, maxBotConcurrency, priorityAging, fairShareWindow)
+			if !ok {
+				// Either the dispatcher has been stopped or the pool has been
+				// resized, in which case we hold on to the worker and go again.
+				select {
+				case <-stopDispatcher:
+					return
+				default:
+					continue
+				}
 			}
+			inFlight.Add(1)
+			worker <- work
+			worker = nil
 		}
 	}()
 }
+
+// Shutdown stops the dispatcher claiming moves and waits for the moves that are
+// being played, and the notifications being sent, to finish, for at most the
+// given deadline. Any moves still being played after the deadline are put back
+// in the queue so that they are resumed by another worker node or when Merknera
+// is restarted.
+func Shutdown(deadline time.Duration) error {
+	fmt.Println("Stopping dispatcher")
+	close(stopDispatcher)
+	<-dispatcherStopped
+
+	finished := make(chan bool)
+	go func() {
+		inFlight.Wait()
+		notifications.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		fmt.Println("All in-flight moves and notifications have finished")
+	case <-time.After(deadline):
+		log.Printf("[node%d] Moves were still being played after %s, they will be requeued\n", currentNode.Id, deadline)
+	}
+
+	stopAllWorkers()
+
+	return stopWorkerNode()
+}
+
+// claimGameMove blocks until a move job can be claimed from the job table, in
+// order of priority and then shared fairly between bot owners. Moves for bots
+// that are already playing as many moves as they allow are left queued so a
+// busy bot doesn't hold up moves for other bots. If the dispatcher is stopped,
+// or the pool is resized, before a move can be claimed false is returned.
+func claimGameMove(lease time.Duration, maxAttempts int, maxBotConcurrency int, priorityAging time.Duration, fairShareWindow time.Duration) (GameMoveRequest, bool) {
+	for {
+		job, err := repository.ClaimMoveJob(currentNode, lease, maxAttempts, maxBotConcurrency, priorityAging, fairShareWindow)
+		if err == nil {
+			gm, err := job.GameMove()
+			if err == nil {
+				return GameMoveRequest{GameMove: gm, Job: job, Priority: job.Priority}, true
+			}
+			log.Printf("Error retrieving game move for job (job id: %d):\n%v\n", job.Id, err)
+			job.Complete()
+			continue
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("Error claiming a game move:\n%v\n", err)
+		}
+
+		select {
+		case <-moveQueued:
+		case <-time.After(MOVE_POLL_INTERVAL):
+		case <-poolResized:
+			return GameMoveRequest{}, false
+		case <-stopDispatcher:
+			return GameMoveRequest{}, false
+		}
+	}
+}
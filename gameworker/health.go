@@ -0,0 +1,285 @@
+package gameworker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_HEALTH_INTERVAL          = "MERKNERA_HEALTH_INTERVAL"
+	ENVVAR_HEALTH_FAILURE_THRESHOLD = "MERKNERA_HEALTH_FAILURE_THRESHOLD"
+	ENVVAR_HEALTH_BACKOFF           = "MERKNERA_HEALTH_BACKOFF"
+	ENVVAR_HEALTH_MAX_BACKOFF       = "MERKNERA_HEALTH_MAX_BACKOFF"
+
+	// The default number of seconds between checks for unhealthy bots that are
+	// due to be pinged again.
+	DEFAULT_HEALTH_INTERVAL = 10
+	// The default number of failures in a row after which a bot's endpoint is
+	// considered down and its bots are taken offline.
+	DEFAULT_HEALTH_FAILURE_THRESHOLD = 3
+	// The default number of seconds to wait before pinging an endpoint that is
+	// down. The wait doubles after each failed ping up to the maximum.
+	DEFAULT_HEALTH_BACKOFF     = 30
+	DEFAULT_HEALTH_MAX_BACKOFF = 1800
+)
+
+type CircuitState string
+
+const (
+	// Calls are made to the endpoint as normal.
+	CIRCUIT_CLOSED CircuitState = "CLOSED"
+	// The endpoint is down and no calls are made to it until its backoff has
+	// passed.
+	CIRCUIT_OPEN CircuitState = "OPEN"
+	// The backoff has passed and a single ping is allowed through to find out
+	// whether the endpoint is back.
+	CIRCUIT_HALF_OPEN CircuitState = "HALF_OPEN"
+)
+
+// circuitBreaker tracks the health of a single bot endpoint. Several versions of
+// a bot may share an endpoint so the breaker is kept per endpoint rather than
+// per bot.
+type circuitBreaker struct {
+	state     CircuitState
+	failures  int
+	backoff   time.Duration
+	nextProbe time.Time
+}
+
+var breakerLock sync.Mutex
+var breakers = make(map[string]*circuitBreaker)
+
+// breakerFor returns the breaker for the endpoint. breakerLock must be held.
+func breakerFor(endpoint string) *circuitBreaker {
+	cb, ok := breakers[endpoint]
+	if !ok {
+		cb = &circuitBreaker{state: CIRCUIT_CLOSED}
+		breakers[endpoint] = cb
+	}
+
+	return cb
+}
+
+// allowCall returns true if calls may be made to the endpoint. Once the backoff
+// of an open circuit has passed it is half-opened and a single call is allowed.
+func allowCall(endpoint string) bool {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+
+	cb := breakerFor(endpoint)
+	switch cb.state {
+	case CIRCUIT_CLOSED:
+		return true
+	case CIRCUIT_OPEN:
+		if time.Now().After(cb.nextProbe) {
+			cb.state = CIRCUIT_HALF_OPEN
+			return true
+		}
+	}
+
+	return false
+}
+
+func breakerSuccess(endpoint string) {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+
+	delete(breakers, endpoint)
+}
+
+// breakerFailure records a failed call to the endpoint and returns true if the
+// circuit is now open.
+func breakerFailure(endpoint string) bool {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+
+	cb := breakerFor(endpoint)
+	cb.failures++
+
+	if cb.state == CIRCUIT_HALF_OPEN {
+		cb.backoff *= 2
+		maxBackoff := time.Duration(envInt(ENVVAR_HEALTH_MAX_BACKOFF, DEFAULT_HEALTH_MAX_BACKOFF)) * time.Second
+		if cb.backoff > maxBackoff {
+			cb.backoff = maxBackoff
+		}
+	} else if cb.state == CIRCUIT_CLOSED && cb.failures >= envInt(ENVVAR_HEALTH_FAILURE_THRESHOLD, DEFAULT_HEALTH_FAILURE_THRESHOLD) {
+		cb.backoff = time.Duration(envInt(ENVVAR_HEALTH_BACKOFF, DEFAULT_HEALTH_BACKOFF)) * time.Second
+	} else {
+		return cb.state == CIRCUIT_OPEN
+	}
+
+	cb.state = CIRCUIT_OPEN
+	cb.nextProbe = time.Now().Add(cb.backoff)
+
+	return true
+}
+
+// ResetCircuit closes the circuit for the endpoint, e.g. when a bot is
+// re-registered and so is known to be reachable.
+func ResetCircuit(endpoint string) {
+	breakerSuccess(endpoint)
+}
+
+// CheckBotHealth pings the bot and updates its status from the result. True is
+// returned if the bot could be reached.
+func CheckBotHealth(bot *repository.Bot) bool {
+	return PingBot(bot) == nil
+}
+
+// PingBot pings the bot and updates its status from the result, returning why
+// the bot couldn't be reached if it didn't respond.
+//
+// Circuits are kept by each node but bot status is shared between nodes. If the
+// circuit for the bot's endpoint is open on this node the bot's status is never
+// changed without pinging it, and if another node has since brought the bot
+// back online the circuit is closed so that the bot is pinged.
+func PingBot(bot *repository.Bot) error {
+	if !allowCall(bot.RPCEndpoint) {
+		if bot.Status == repository.BOT_STATUS_OFFLINE {
+			return fmt.Errorf("%s is offline and won't be pinged until its endpoint is due to be checked again.", bot.Name)
+		}
+		breakerSuccess(bot.RPCEndpoint)
+	}
+
+	err := bot.Ping()
+	if err != nil {
+		markUnhealthy(bot, breakerFailure(bot.RPCEndpoint), err)
+		return err
+	}
+
+	breakerSuccess(bot.RPCEndpoint)
+	markHealthy(bot)
+	return nil
+}
+
+// recordCallFailure records a call to the bot that failed because the bot
+// couldn't be reached.
+func recordCallFailure(bot *repository.Bot, cause error) {
+	markUnhealthy(bot, breakerFailure(bot.RPCEndpoint), cause)
+}
+
+// markHealthy brings the bot back online and queues any moves that were waiting
+// for it.
+func markHealthy(bot *repository.Bot) {
+	if bot.Status == repository.BOT_STATUS_ONLINE || bot.Status == repository.BOT_STATUS_SUPERSEDED {
+		return
+	}
+
+	from := bot.Status
+	err := bot.MarkOnline()
+	if err != nil {
+		log.Printf("Error marking bot online (bot id: %d):\n%v\n", bot.Id, err)
+		return
+	}
+	publishStatusChange(bot, from, "the bot responded")
+
+	awaitingMoves, err := bot.ListAwaitingMoves()
+	if err != nil {
+		log.Printf("Error getting awaiting moves for bot (bot id: %d):\n%v\n", bot.Id, err)
+		return
+	}
+	for _, gm := range awaitingMoves {
+		QueueGameMove(gm)
+	}
+}
+
+// markUnhealthy makes an online bot suspect, or takes it offline if the circuit
+// for its endpoint is now open.
+func markUnhealthy(bot *repository.Bot, circuitOpen bool, cause error) {
+	from := bot.Status
+	var err error
+	if circuitOpen {
+		if from != repository.BOT_STATUS_ONLINE && from != repository.BOT_STATUS_SUSPECT {
+			return
+		}
+		err = bot.MarkOffline()
+	} else {
+		if from != repository.BOT_STATUS_ONLINE {
+			return
+		}
+		err = bot.MarkSuspect()
+	}
+	if err != nil {
+		log.Printf("Error updating bot health (bot id: %d):\n%v\n", bot.Id, err)
+		return
+	}
+	publishStatusChange(bot, from, cause.Error())
+}
+
+func publishStatusChange(bot *repository.Bot, from repository.BotStatus, reason string) {
+	events.Publish(events.BotStatusChanged{
+		Bot:    *bot,
+		From:   from,
+		To:     bot.Status,
+		Reason: reason,
+	})
+}
+
+// StartHealthMonitor starts a background goroutine that pings suspect and
+// offline bots, backing off for each endpoint that stays down, so that bots
+// come back online without having to re-register.
+func StartHealthMonitor() {
+	interval := time.Duration(envInt(ENVVAR_HEALTH_INTERVAL, DEFAULT_HEALTH_INTERVAL)) * time.Second
+
+	fmt.Println("Starting health monitor")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				probeUnhealthyBots()
+			case <-stopDispatcher:
+				return
+			}
+		}
+	}()
+}
+
+// probeUnhealthyBots pings each endpoint with unhealthy bots once and applies the
+// result to every bot using that endpoint.
+func probeUnhealthyBots() {
+	botList, err := repository.ListUnhealthyBots()
+	if err != nil {
+		log.Printf("[health] Error listing unhealthy bots:\n%v\n", err)
+		return
+	}
+
+	endpoints := make(map[string][]repository.Bot)
+	var order []string
+	for _, b := range botList {
+		if _, ok := endpoints[b.RPCEndpoint]; !ok {
+			order = append(order, b.RPCEndpoint)
+		}
+		endpoints[b.RPCEndpoint] = append(endpoints[b.RPCEndpoint], b)
+	}
+
+	for _, endpoint := range order {
+		bots := endpoints[endpoint]
+
+		// Suspect bots are pinged straight away, offline bots wait for the
+		// circuit to allow a ping.
+		if !allowCall(endpoint) {
+			continue
+		}
+
+		err := bots[0].Ping()
+		if err != nil {
+			circuitOpen := breakerFailure(endpoint)
+			for i := range bots {
+				markUnhealthy(&bots[i], circuitOpen, err)
+			}
+			continue
+		}
+
+		breakerSuccess(endpoint)
+		for i := range bots {
+			markHealthy(&bots[i])
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package gameworker
+
+import (
+	"log"
+
+	"github.com/mleonard87/merknera/metrics"
+)
+
+var (
+	gamesCreated = metrics.NewCounter(
+		"merknera_games_created_total",
+		"Games that have been created, by game type.",
+		"game_type",
+	)
+	gamesStarted = metrics.NewCounter(
+		"merknera_games_started_total",
+		"Games that have had their first move played, by game type.",
+		"game_type",
+	)
+	gamesCompleted = metrics.NewCounter(
+		"merknera_games_completed_total",
+		"Games that have been completed, by game type.",
+		"game_type",
+	)
+	moveQueueDepth = metrics.NewGauge(
+		"merknera_move_queue_depth",
+		"Moves waiting to be claimed by any worker node.",
+	)
+	workerPoolSize = metrics.NewGauge(
+		"merknera_worker_pool_size",
+		"The number of workers the pool on this node is set to.",
+	)
+	workerCount = metrics.NewGauge(
+		"merknera_workers",
+		"Workers on this node, by whether they are idle or busy playing a move.",
+		"state",
+	)
+)
+
+func init() {
+	metrics.OnScrape(func() {
+		status, err := GetDispatcherStatus()
+		if err != nil {
+			log.Printf("Error obtaining dispatcher status for metrics:\n%v\n", err)
+			return
+		}
+
+		moveQueueDepth.Set(float64(status.QueueDepth))
+		workerPoolSize.Set(float64(status.PoolSize))
+		workerCount.Set(float64(status.IdleWorkers), "idle")
+		workerCount.Set(float64(status.BusyWorkers), "busy")
+	})
+}
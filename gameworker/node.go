@@ -0,0 +1,107 @@
+package gameworker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_NODE_HEARTBEAT = "MERKNERA_NODE_HEARTBEAT"
+	ENVVAR_NODE_TIMEOUT   = "MERKNERA_NODE_TIMEOUT"
+
+	// The default number of seconds between heartbeats from this node.
+	DEFAULT_NODE_HEARTBEAT = 10
+	// The default number of seconds without a heartbeat after which a node is
+	// considered dead and its moves are given to other nodes.
+	DEFAULT_NODE_TIMEOUT = 60
+)
+
+// currentNode is the worker node registered for this process.
+var currentNode repository.WorkerNode
+
+// stopHeartbeat is closed to stop this node sending heartbeats and
+// heartbeatStopped is closed once the last heartbeat has been sent.
+var stopHeartbeat = make(chan bool)
+var heartbeatStopped = make(chan bool)
+
+// stopped is set to 1 once this node has started to stop. Any moves still being
+// played are then requeued so workers must not store the results of them.
+var stopped int32
+
+// startWorkerNode registers this process as a worker node and starts sending
+// heartbeats, which also keep the leases on the moves being played by this node
+// from expiring. Each node also watches for other nodes that have died and
+// requeues their moves.
+func startWorkerNode(lease time.Duration) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	node, err := repository.RegisterWorkerNode(hostname, os.Getpid())
+	if err != nil {
+		return err
+	}
+	currentNode = node
+	fmt.Printf("Registered worker node %d (%s:%d)\n", node.Id, node.Hostname, node.Pid)
+
+	heartbeat := time.Duration(envInt(ENVVAR_NODE_HEARTBEAT, DEFAULT_NODE_HEARTBEAT)) * time.Second
+	timeout := time.Duration(envInt(ENVVAR_NODE_TIMEOUT, DEFAULT_NODE_TIMEOUT)) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		defer close(heartbeatStopped)
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopHeartbeat:
+				return
+			}
+
+			err := currentNode.Heartbeat(lease)
+			if err == repository.ErrWorkerNodeNotActive {
+				// Another node has declared this one dead and given its moves
+				// to other nodes. Carrying on would mean playing moves this
+				// node no longer holds so it exits, to be restarted as a new
+				// node.
+				log.Fatalf("[node%d] This node has been declared dead and its moves given to other nodes, exiting\n", currentNode.Id)
+			}
+			if err != nil {
+				log.Printf("[node%d] Error sending heartbeat:\n%v\n", currentNode.Id, err)
+			}
+
+			requeued, err := repository.ReapDeadWorkerNodes(timeout)
+			if err != nil {
+				log.Printf("[node%d] Error reaping dead worker nodes:\n%v\n", currentNode.Id, err)
+			} else if requeued > 0 {
+				log.Printf("[node%d] Requeued %d moves held by dead worker nodes\n", currentNode.Id, requeued)
+				select {
+				case moveQueued <- true:
+				default:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// nodeStopped returns true once this node has started to stop.
+func nodeStopped() bool {
+	return atomic.LoadInt32(&stopped) == 1
+}
+
+// stopWorkerNode stops the heartbeats from this node and marks it as stopped,
+// putting any moves it is still playing back in the queue.
+func stopWorkerNode() error {
+	atomic.StoreInt32(&stopped, 1)
+	close(stopHeartbeat)
+	<-heartbeatStopped
+	return currentNode.Stop()
+}
@@ -0,0 +1,188 @@
+package gameworker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_WORKERS = "MERKNERA_WORKERS"
+
+	// The default number of workers playing moves on this node.
+	DEFAULT_WORKERS = 4
+	// The most workers that the pool may be resized to.
+	MAX_WORKERS = 100
+)
+
+// WorkerState is what a worker is doing right now.
+type WorkerState struct {
+	Id   int
+	Busy bool
+	// The move being played and when the worker started it, only set whilst
+	// the worker is busy.
+	GameMove      repository.GameMove
+	Priority      repository.MovePriority
+	StartDateTime time.Time
+}
+
+// DispatcherStatus is a snapshot of the worker pool on this node.
+type DispatcherStatus struct {
+	PoolSize    int
+	IdleWorkers int
+	BusyWorkers int
+	// The number of moves waiting to be claimed by any worker node.
+	QueueDepth int
+	Workers    []WorkerState
+}
+
+type poolWorker struct {
+	worker GameMoveWorker
+	state  WorkerState
+}
+
+// poolLock guards the pool. poolSize is the number of workers asked for, the
+// pool may briefly hold more whilst busy workers finish their moves.
+var poolLock sync.Mutex
+var poolWorkers = make(map[int]*poolWorker)
+var poolSize int
+var nextWorkerId int
+
+// poolResized wakes the dispatcher when the pool is shrunk so that idle workers
+// are stopped without waiting for a move to be claimed.
+var poolResized = make(chan bool, 1)
+
+// WorkerPoolSize is the number of workers the pool starts with.
+func WorkerPoolSize() int {
+	return envInt(ENVVAR_WORKERS, DEFAULT_WORKERS)
+}
+
+// ResizeWorkerPool changes the number of workers playing moves on this node.
+// New workers are started straight away. When shrinking, idle workers are
+// stopped straight away and busy workers are stopped once they finish their
+// current move.
+func ResizeWorkerPool(size int) error {
+	if size < 1 || size > MAX_WORKERS {
+		return fmt.Errorf("The worker pool size must be between 1 and %d.", MAX_WORKERS)
+	}
+	if WorkerQueue == nil {
+		return errors.New("The dispatcher has not been started.")
+	}
+
+	poolLock.Lock()
+	poolSize = size
+	for len(poolWorkers) < poolSize {
+		startPoolWorker()
+	}
+	poolLock.Unlock()
+
+	select {
+	case poolResized <- true:
+	default:
+	}
+
+	return nil
+}
+
+// startPoolWorker adds a worker to the pool. poolLock must be held.
+func startPoolWorker() {
+	nextWorkerId++
+	fmt.Println("Starting worker", nextWorkerId)
+	worker := NewGameMoveWorker(nextWorkerId, WorkerQueue)
+	poolWorkers[worker.Id] = &poolWorker{
+		worker: worker,
+		state:  WorkerState{Id: worker.Id},
+	}
+	worker.Start()
+}
+
+// retireWorker stops the idle worker owning the given work channel if the pool
+// is larger than it should be. True is returned if the worker was stopped.
+func retireWorker(work chan GameMoveRequest) bool {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	if len(poolWorkers) <= poolSize {
+		return false
+	}
+
+	for id, pw := range poolWorkers {
+		if pw.worker.GameMoveRequestWork == work {
+			delete(poolWorkers, id)
+			pw.worker.Stop()
+			return true
+		}
+	}
+
+	return false
+}
+
+// stopAllWorkers stops every worker in the pool.
+func stopAllWorkers() {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	for id, pw := range poolWorkers {
+		delete(poolWorkers, id)
+		pw.worker.Stop()
+	}
+	poolSize = 0
+}
+
+func setWorkerBusy(id int, work GameMoveRequest) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	if pw, ok := poolWorkers[id]; ok {
+		pw.state.Busy = true
+		pw.state.GameMove = work.GameMove
+		pw.state.Priority = work.Priority
+		pw.state.StartDateTime = time.Now()
+	}
+}
+
+func setWorkerIdle(id int) {
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	if pw, ok := poolWorkers[id]; ok {
+		pw.state = WorkerState{Id: id}
+	}
+}
+
+// GetDispatcherStatus returns the current state of the worker pool.
+func GetDispatcherStatus() (DispatcherStatus, error) {
+	queueDepth, err := repository.CountQueuedMoveJobs()
+	if err != nil {
+		return DispatcherStatus{}, err
+	}
+
+	poolLock.Lock()
+	defer poolLock.Unlock()
+
+	status := DispatcherStatus{
+		PoolSize:   poolSize,
+		QueueDepth: queueDepth,
+	}
+	for _, pw := range poolWorkers {
+		if pw.state.Busy {
+			status.BusyWorkers++
+		} else {
+			status.IdleWorkers++
+		}
+		status.Workers = append(status.Workers, pw.state)
+	}
+	sort.Sort(workerStatesById(status.Workers))
+
+	return status, nil
+}
+
+type workerStatesById []WorkerState
+
+func (w workerStatesById) Len() int           { return len(w) }
+func (w workerStatesById) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w workerStatesById) Less(i, j int) bool { return w[i].Id < w[j].Id }
@@ -0,0 +1,170 @@
+package gameworker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_QUALIFICATION_THRESHOLD = "MERKNERA_QUALIFICATION_THRESHOLD"
+	ENVVAR_QUALIFICATION_INTERVAL  = "MERKNERA_QUALIFICATION_INTERVAL"
+
+	// The default score (as a percentage) that a qualifying bot must achieve
+	// across its qualification games to replace the current ranked version.
+	DEFAULT_QUALIFICATION_THRESHOLD = 50.0
+	// The default number of seconds between checks for qualifying bots whose
+	// last qualification games ended without being completed, e.g. because an
+	// opponent was superseded.
+	DEFAULT_QUALIFICATION_INTERVAL = 60
+)
+
+func QualificationThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv(ENVVAR_QUALIFICATION_THRESHOLD), 64)
+	if err != nil || threshold < 0 {
+		return DEFAULT_QUALIFICATION_THRESHOLD
+	}
+
+	return threshold
+}
+
+// PromoteBot moves a bot into ranked play and adds its ladder games to the
+// backlog. It is used both when a bot qualifies and when a user promotes their
+// bot by hand.
+func PromoteBot(bot *repository.Bot) error {
+	if bot.Status == repository.BOT_STATUS_SUPERSEDED {
+		return errors.New("This version of the bot has been superseded and cannot be promoted.")
+	}
+
+	gameType, err := bot.GameType()
+	if err != nil {
+		return err
+	}
+
+	gameManager, err := games.GetGameManager(gameType)
+	if err != nil {
+		return err
+	}
+
+	err = bot.Promote()
+	if err != nil {
+		return err
+	}
+
+	bot.Logf("Promoted %s (version: %s) to ranked play", bot.Name, bot.Version)
+
+	pairings, err := gameManager.GenerateGames(*bot)
+	if err != nil {
+		return err
+	}
+
+	return repository.AddToBacklog(pairings)
+}
+
+// EvaluateQualification checks whether a qualifying bot has finished all of its
+// qualification games. If it has then it is either promoted to replace the
+// current ranked version or discarded depending on whether its score meets the
+// qualification threshold.
+func EvaluateQualification(bot repository.Bot) error {
+	if bot.Stage != repository.BOT_STAGE_QUALIFYING || bot.Status == repository.BOT_STATUS_SUPERSEDED {
+		return nil
+	}
+
+	record, err := bot.RecordForKind(repository.GAME_KIND_QUALIFICATION)
+	if err != nil {
+		return err
+	}
+
+	if record.Remaining > 0 {
+		return nil
+	}
+
+	threshold := QualificationThreshold()
+	if record.Played == 0 {
+		err = PromoteBot(&bot)
+		if err == repository.ErrBotAlreadyPromoted {
+			return nil
+		}
+		if err == nil {
+			bot.Log("No qualification games were played, replacing the previous version")
+		}
+		return err
+	}
+
+	if record.Score() >= threshold {
+		err = PromoteBot(&bot)
+		if err == repository.ErrBotAlreadyPromoted {
+			return nil
+		}
+		if err == nil {
+			bot.Logf("Qualified with a score of %.2f (threshold: %.2f), replacing the previous version", record.Score(), threshold)
+			log.Printf("%s (version: %s) qualified with a score of %.2f\n", bot.Name, bot.Version, record.Score())
+		}
+		return err
+	}
+
+	bot.Logf("Failed to qualify with a score of %.2f (threshold: %.2f), this version has been discarded", record.Score(), threshold)
+	log.Printf("%s (version: %s) failed to qualify with a score of %.2f\n", bot.Name, bot.Version, record.Score())
+	return bot.Discard()
+}
+
+// EvaluateQualifyingPlayers evaluates the qualification of each player of a
+// qualification game that has ended, whether or not it was completed.
+func EvaluateQualifyingPlayers(players []repository.GameBot) {
+	for _, p := range players {
+		pb, err := p.Bot()
+		if err != nil {
+			log.Printf("Error obtaining bot for qualifying player (game bot id: %d):\n%v\n", p.Id, err)
+			continue
+		}
+
+		err = EvaluateQualification(pb)
+		if err != nil {
+			log.Printf("Error evaluating qualification (bot id: %d):\n%v\n", pb.Id, err)
+		}
+	}
+}
+
+// StartQualificationSweep starts a background goroutine that evaluates every
+// qualifying bot from time to time. Qualification is evaluated as each game
+// completes but games may also end by being superseded, e.g. when an opponent
+// is replaced by a new version, which would otherwise leave the bot qualifying
+// forever.
+func StartQualificationSweep() {
+	interval := time.Duration(envInt(ENVVAR_QUALIFICATION_INTERVAL, DEFAULT_QUALIFICATION_INTERVAL)) * time.Second
+
+	fmt.Println("Starting qualification sweep")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sweepQualifyingBots()
+			case <-stopDispatcher:
+				return
+			}
+		}
+	}()
+}
+
+func sweepQualifyingBots() {
+	botList, err := repository.ListQualifyingBots()
+	if err != nil {
+		log.Printf("[qualification] Error listing qualifying bots:\n%v\n", err)
+		return
+	}
+
+	for _, b := range botList {
+		err = EvaluateQualification(b)
+		if err != nil {
+			log.Printf("[qualification] Error evaluating qualification (bot id: %d):\n%v\n", b.Id, err)
+		}
+	}
+}
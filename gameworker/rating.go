@@ -0,0 +1,116 @@
+package gameworker
+
+import (
+	"database/sql"
+
+	"github.com/mleonard87/merknera/rating"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// CurrentRating returns the bots rating from the rating engine of its game type,
+// or the engines initial rating if the bot has not yet played a rated game.
+func CurrentRating(bot repository.Bot) (rating.Rating, error) {
+	gameType, err := bot.GameType()
+	if err != nil {
+		return rating.Rating{}, err
+	}
+
+	engine, err := rating.GetEngine(gameType.RatingEngine)
+	if err != nil {
+		return rating.Rating{}, err
+	}
+
+	return currentRating(engine, bot)
+}
+
+func currentRating(engine rating.Engine, bot repository.Bot) (rating.Rating, error) {
+	br, err := bot.Rating(engine.Name())
+	if err == sql.ErrNoRows {
+		return engine.Initial(), nil
+	}
+	if err != nil {
+		return rating.Rating{}, err
+	}
+
+	return rating.Rating{Mu: br.Mu, Sigma: br.Sigma}, nil
+}
+
+// RateGameTx recalculates the ratings of every player in a rated game as part
+// of the transaction that completes it, using the rating engine of the games
+// type. The winning team finishes first and every other team joint second, if
+// there is no winner, i.e. winningTeam is 0, then all teams tie.
+func RateGameTx(tx *repository.Tx, game repository.Game, players []repository.GameBot, winningTeam int) error {
+	if !game.Rated {
+		return nil
+	}
+
+	gameType, err := game.GameType()
+	if err != nil {
+		return err
+	}
+
+	engine, err := rating.GetEngine(gameType.RatingEngine)
+	if err != nil {
+		return err
+	}
+
+	var bots []repository.Bot
+	for _, p := range players {
+		pb, err := p.Bot()
+		if err != nil {
+			return err
+		}
+		bots = append(bots, pb)
+	}
+
+	// The players ratings are held until the transaction ends so that games
+	// sharing players, possibly finishing on other worker nodes, update them
+	// one after another.
+	initial := engine.Initial()
+	locked, err := repository.LockRatingsTx(tx, engine.Name(), bots, initial.Mu, initial.Sigma)
+	if err != nil {
+		return err
+	}
+
+	// Group the players into their teams keeping the order in which each team
+	// was first seen.
+	var teamOrder []int
+	teamBots := make(map[int][]repository.Bot)
+	teamRatings := make(map[int][]rating.Rating)
+	for i, p := range players {
+		pb := bots[i]
+		br := locked[pb.Id]
+
+		if _, ok := teamBots[p.Team]; !ok {
+			teamOrder = append(teamOrder, p.Team)
+		}
+		teamBots[p.Team] = append(teamBots[p.Team], pb)
+		teamRatings[p.Team] = append(teamRatings[p.Team], rating.Rating{Mu: br.Mu, Sigma: br.Sigma})
+	}
+
+	var teams []rating.Team
+	for _, t := range teamOrder {
+		rank := 1
+		if winningTeam != 0 && t != winningTeam {
+			rank = 2
+		}
+		teams = append(teams, rating.Team{Rank: rank, Ratings: teamRatings[t]})
+	}
+
+	newRatings, err := engine.Rate(teams)
+	if err != nil {
+		return err
+	}
+
+	for i, t := range teamOrder {
+		for j, b := range teamBots[t] {
+			r := newRatings[i][j]
+			err = b.SaveRatingTx(tx, engine.Name(), r.Mu, r.Sigma)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
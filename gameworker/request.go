@@ -4,4 +4,8 @@ import "github.com/mleonard87/merknera/repository"
 
 type GameMoveRequest struct {
 	GameMove repository.GameMove
+	Job      repository.MoveJob
+	// The class the move was queued in. Continuation moves are claimed before
+	// first moves, which are claimed before moves in background games.
+	Priority repository.MovePriority
 }
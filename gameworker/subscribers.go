@@ -0,0 +1,188 @@
+package gameworker
+
+import (
+	"log"
+	"sync"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/repository"
+	"github.com/mleonard87/merknera/rpchelper"
+)
+
+func init() {
+	// Bot logs are written first so that they read in the order things
+	// happened.
+	for _, k := range []events.Kind{
+		events.BOT_REGISTERED,
+		events.BOT_STATUS_CHANGED,
+		events.MOVE_REQUESTED,
+		events.MOVE_COMPLETED,
+		events.GAME_COMPLETED,
+		events.GAME_SUSPENDED,
+	} {
+		events.Subscribe(k, logToBot)
+	}
+
+	events.Subscribe(events.GAME_CREATED, countGameCreated)
+	events.Subscribe(events.MOVE_REQUESTED, countGameStarted)
+	events.Subscribe(events.GAME_COMPLETED, countGameCompleted)
+	events.Subscribe(events.GAME_COMPLETED, qualifyPlayers)
+	events.Subscribe(events.GAME_COMPLETED, inBackground(notifyGameCompleted))
+	events.Subscribe(events.GAME_SUSPENDED, inBackground(notifyGameSuspended))
+}
+
+// notifications counts the notifications still being sent to bots.
+var notifications sync.WaitGroup
+
+// inBackground runs the handler in its own goroutine. Events are published by
+// the workers playing moves so a slow bot being notified would otherwise hold
+// up a worker, and the moves waiting for it, for as long as the call takes.
+func inBackground(h events.Handler) events.Handler {
+	return func(e events.Event) {
+		notifications.Add(1)
+		go func() {
+			defer notifications.Done()
+			h(e)
+		}()
+	}
+}
+
+// logToBot writes events to the logs of the bots they concern.
+func logToBot(e events.Event) {
+	switch e := e.(type) {
+	case events.BotRegistered:
+		if e.Reregistered {
+			e.Bot.Logf("Re-registered %s (version: %s)", e.Bot.Name, e.Bot.Version)
+		} else {
+			e.Bot.Logf("Registered %s (version: %s)", e.Bot.Name, e.Bot.Version)
+		}
+	case events.BotStatusChanged:
+		e.Bot.Logf("Health: %s -> %s (%s)", e.From, e.To, e.Reason)
+	case events.MoveRequested:
+		e.Bot.Logf("RPC call [BEGIN]: %s (gameId: %d)", e.Method, e.Game.Id)
+	case events.MoveCompleted:
+		if e.Err != nil {
+			e.Bot.Logf("RPC Call [END]: %s Error (gameId: %d): %s", e.Method, e.Game.Id, e.Err)
+		} else {
+			e.Bot.Logf("RPC call [ END ]: %s Success (gameId: %d)", e.Method, e.Game.Id)
+		}
+	case events.GameCompleted:
+		for _, p := range e.Players {
+			pb, err := p.Bot()
+			if err != nil {
+				log.Printf("Error obtaining bot for player (game bot id: %d):\n%v\n", p.Id, err)
+				continue
+			}
+			pb.Logf("Game complete (gameId: %d)", e.Game.Id)
+		}
+	case events.GameSuspended:
+		e.Bot.Logf("Error playing move (gameId: %d): %s", e.Game.Id, e.Err)
+
+		players, err := e.Game.Players()
+		if err != nil {
+			log.Printf("Error obtaining a player list for the game (game id: %d):\n%v\n", e.Game.Id, err)
+			return
+		}
+		for _, p := range players {
+			pb, err := p.Bot()
+			if err != nil {
+				log.Printf("Error obtaining bot for player (game bot id: %d):\n%v\n", p.Id, err)
+				continue
+			}
+			pb.Logf("Game suspended %s caused an error (gameId: %d)", e.Bot.Name, e.Game.Id)
+		}
+	}
+}
+
+func countGameCreated(e events.Event) {
+	if gc, ok := e.(events.GameCreated); ok {
+		gameType, err := gc.Game.GameType()
+		if err != nil {
+			log.Printf("Error retrieving GameType (game id: %d):\n%v\n", gc.Game.Id, err)
+			return
+		}
+		gamesCreated.Inc(gameType.Mnemonic)
+	}
+}
+
+func countGameStarted(e events.Event) {
+	if mr, ok := e.(events.MoveRequested); ok && mr.Game.Status == repository.GAME_STATUS_NOT_STARTED {
+		gamesStarted.Inc(mr.GameType.Mnemonic)
+	}
+}
+
+func countGameCompleted(e events.Event) {
+	if gc, ok := e.(events.GameCompleted); ok {
+		gamesCompleted.Inc(gc.GameType.Mnemonic)
+	}
+}
+
+func qualifyPlayers(e events.Event) {
+	if gc, ok := e.(events.GameCompleted); ok && gc.Game.Kind == repository.GAME_KIND_QUALIFICATION {
+		EvaluateQualifyingPlayers(gc.Players)
+	}
+}
+
+// notifyGameCompleted sends each player a Complete notification.
+func notifyGameCompleted(e events.Event) {
+	gc, ok := e.(events.GameCompleted)
+	if !ok {
+		return
+	}
+
+	gameManager, err := games.GetGameManager(gc.GameType)
+	if err != nil {
+		log.Printf("Error obtaining GameManager for game (gameType: %s):\n%v\n", gc.GameType.Mnemonic, err)
+		return
+	}
+
+	cm := gameManager.GetCompleteRPCMethodName()
+	for _, p := range gc.Players {
+		cp, err := gameManager.GetCompleteRPCParams(p, games.GameResult(gc.Result))
+		if err != nil {
+			log.Printf("Error obtaining complete RPC params for player (game bot id: %d):\n%v\n", p.Id, err)
+			continue
+		}
+
+		pb, err := p.Bot()
+		if err != nil {
+			log.Printf("Error obtaining bot for player (game bot id: %d):\n%v\n", p.Id, err)
+			continue
+		}
+
+		pb.Logf("RPC call [BEGIN]: %s (gameId: %d)", cm, gc.Game.Id)
+		err = rpchelper.DefaultPolicy().Notify(pb.RPCEndpoint, cm, cp, pb.RPCAttemptRecorder(repository.GameMove{}))
+		if err != nil {
+			log.Printf("Error notifying player for complete game (bot id: %d):\n%v\n", pb.Id, err)
+			continue
+		}
+		pb.Logf("RPC call [ END ]: %s (gameId: %d)", cm, gc.Game.Id)
+	}
+}
+
+// notifyGameSuspended tells the bot that caused the error what went wrong.
+func notifyGameSuspended(e events.Event) {
+	gs, ok := e.(events.GameSuspended)
+	if !ok {
+		return
+	}
+
+	gameManager, err := games.GetGameManager(gs.GameType)
+	if err != nil {
+		log.Printf("Error obtaining GameManager for game (gameType: %s):\n%v\n", gs.GameType.Mnemonic, err)
+		return
+	}
+
+	em := gameManager.GetErrorRPCMethodName()
+	ep := gameManager.GetErrorRPCParams(gs.GameMove, gs.Err.Error())
+
+	gs.Bot.Logf("RPC call [BEGIN]: %s (gameId: %d)", em, gs.Game.Id)
+	err = rpchelper.DefaultPolicy().Notify(gs.Bot.RPCEndpoint, em, ep, gs.Bot.RPCAttemptRecorder(gs.GameMove))
+	if err != nil {
+		gs.Bot.Logf("RPC call [ END ]: %s (gameId: %d) error: %s", em, gs.Game.Id, err)
+		log.Printf("Error notifying bot of error (game move id: %d):\n%v\n", gs.GameMove.Id, err)
+	} else {
+		gs.Bot.Logf("RPC call [ END ]: %s (gameId: %d) success", em, gs.Game.Id)
+	}
+}
@@ -1,9 +1,11 @@
 package gameworker
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 
+	"github.com/mleonard87/merknera/events"
 	"github.com/mleonard87/merknera/games"
 	"github.com/mleonard87/merknera/repository"
 	"github.com/mleonard87/merknera/rpchelper"
@@ -45,208 +47,28 @@ func (gmw GameMoveWorker) Start() {
 
 			select {
 			case work := <-gmw.GameMoveRequestWork:
-				// Lock the current game move - its possible that the same move can end up in the work
-				// queue more than once if bots keep registering on the server is bounced. Lock the
-				// game move so it will only be processed one at a time.
-				GetGameMoveLock(work.GameMove)
-				defer ReleaseGameMoveLock(work.GameMove)
-
-				// If for some reason the game move got added to the work queue twice and has already
-				// been processed just return.
-				if work.GameMove.Status != repository.GAMEMOVE_STATUS_AWAITING {
-					continue
-				}
-
-				gameBot, err := work.GameMove.GameBot()
-				if err != nil {
-					log.Printf("[wkr%d] Error retrieving GameBot:\n%v\n", gmw.Id, err)
-					continue
-				}
-
-				bot, err := gameBot.Bot()
-				if err != nil {
-					log.Printf("[wkr%d] Error retrieving GameBot Bot:\n%v\n", gmw.Id, err)
-					continue
-				}
-
-				game, err := gameBot.Game()
-				if err != nil {
-					log.Printf("[wkr%d] Error retrieving GameBot Game:\n%v\n", gmw.Id, err)
-					continue
-				}
-
-				gameType, err := game.GameType()
-				if err != nil {
-					log.Printf("[wkr%d] Error retrieving GameType:\n%v\n", gmw.Id, err)
-					continue
-				}
-
-				// If the Bot is marked as ERROR or OFFLINE then don't process this move.
-				if bot.Status != repository.BOT_STATUS_ONLINE {
-					continue
-				}
-
-				// Ping the bot to ensure its still online.
-				beforeStatus := bot.Status
-				success, err := bot.Ping()
-				if err != nil {
-					log.Printf("[wkr%d] Error Pinging Bot (bot id: %d):\n%v\n", gmw.Id, err, bot.Id)
-					continue
-				}
-				if success == false {
-					err = bot.MarkOffline()
-					if err != nil {
-						log.Printf("[wkr%d] Error marking bot offline (bot id: %d):\n%v\n", gmw.Id, err, bot.Id)
-					}
-					continue
-				}
-
-				// If the bots status has changed and its now online then re-queue any awaiting moves
-				// for this bot.
-				if beforeStatus != bot.Status && bot.Status == repository.BOT_STATUS_ONLINE {
-					awaitingMoves, err := bot.ListAwaitingMoves()
-					if err != nil {
-						log.Printf("[wkr%d] Error getting awaiting moves for bot (bot id: %d):\n%v\n", gmw.Id, err, bot.Id)
-						continue
-					}
-					for _, gm := range awaitingMoves {
-						QueueGameMove(gm)
-					}
-				}
-
-				gameManager, err := games.GetGameManager(gameType)
-				if err != nil {
-					log.Printf("[wkr%d] Error obtaining GameManager for game (gameType: %s):\n%v\n", gmw.Id, err, gameType)
-					continue
-				}
-
-				err = game.MarkInProgress()
-				if err != nil {
-					log.Printf("[wkr%d] Error marking game in progress (game id: %d):\n%v\n", gmw.Id, err, game.Id)
-					continue
-				}
-
-				method := gameManager.GetNextMoveRPCMethodName()
-
-				params, err := gameManager.GetNextMoveRPCParams(work.GameMove)
-				if err != nil {
-					log.Printf("[wkr%d] Error obtaining next move RPC params (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-					continue
-				}
-
-				reply := gameManager.GetNextMoveRPCResult(work.GameMove)
-
-				var rsr rpchelper.RPCServerResponse
-				rsr.Result = reply
-				log.Printf("[wkr%d] Calling %s for %s (move id: %d)\n", gmw.Id, method, bot.Name, work.GameMove.Id)
-				err = work.GameMove.SetStartDateTime()
-				if err != nil {
-					log.Printf("[wkr%d] Error setting start_datetime (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-					continue
-				}
-				bot.Logf("RPC call [BEGIN]: %s (gameId: %d)", method, game.Id)
-				rpcErr := rpchelper.Call(bot.RPCEndpoint, method, params, &rsr)
-				err = work.GameMove.SetEndDateTime()
-				if err != nil {
-					log.Printf("[wkr%d] Error setting end_datetime (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-					continue
-				}
-				log.Printf("[wkr%d] Call %s complete for %s (move id: %d)\n", gmw.Id, method, bot.Name, work.GameMove.Id)
-				if rpcErr != nil {
-					bot.Logf("RPC Call [END]: %s Error (gameId: %d): %s", method, game.Id, rpcErr)
-					sendError(gameManager, work.GameMove, rpcErr)
-					err = bot.MarkError()
+				setWorkerBusy(gmw.Id, work)
+				if gmw.processGameMove(work) {
+					// The worker is finished with the move whether or not it was
+					// played. If it wasn't it will be queued again, e.g. when its
+					// bot comes back online.
+					err := work.Job.Complete()
 					if err != nil {
-						log.Printf("[wkr%d] Error marking a bot as error status (bot id: %d):\n%v\n", gmw.Id, err, bot.Id)
+						log.Printf("[wkr%d] Error completing move job (job id: %d):\n%v\n", gmw.Id, work.Job.Id, err)
 					}
-					continue
 				} else {
-					bot.Logf("RPC call [ END ]: %s Success (gameId: %d)", method, game.Id)
-				}
-
-				if res, ok := rsr.Result.(map[string]interface{}); ok {
-					gs, gameResult, err := gameManager.ProcessMove(work.GameMove, res)
-					if err != nil {
-						bot.Logf("Error processing move (gameId: %d): %s", game.Id, err)
-						sendError(gameManager, work.GameMove, err)
-						err = bot.MarkError()
-						if err != nil {
-							log.Printf("[wkr%d] Error marking a bot as error status after process move (bot id: %d):\n%v\n", gmw.Id, err, bot.Id)
-						}
-						continue
-					}
-
-					if gameResult == games.GAME_RESULT_UNDECIDED {
-						nextBot, err := gameManager.GetGameBotForNextMove(work.GameMove)
-						if err != nil {
-							log.Printf("[wkr%d] Error obtaining game bot for next move (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-							continue
-						}
-						nextMove, err := repository.CreateGameMove(nextBot, gs)
-						if err != nil {
-							log.Printf("[wkr%d] Error creating next game move (current game move id: %d, next game bot id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id, nextBot.Id)
-							continue
-						}
-						QueueGameMove(nextMove)
-					} else {
-						if gameResult == games.GAME_RESULT_WIN {
-							err = work.GameMove.MarkAsWin()
-							if err != nil {
-								log.Printf("[wkr%d] Error marking game move as win (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-							}
-						}
-
-						err = game.MarkComplete()
-						if err != nil {
-							log.Printf("[wkr%d] Error marking game as complete (game id: %d):\n%v\n", gmw.Id, err, game.Id)
-						}
-						players, err := game.Players()
-						if err != nil {
-							log.Printf("[wkr%d] Error obtaining a player list for the game (game id: %d):\n%v\n", gmw.Id, err, game.Id)
-							continue
-						}
-
-						// Send each player a Complete notification.
-						cm := gameManager.GetCompleteRPCMethodName()
-						for _, p := range players {
-							bot.Logf("Game complete (gameId: %d)", game.Id)
-
-							cp, err := gameManager.GetCompleteRPCParams(p, gameResult)
-							if err != nil {
-								log.Printf("[wkr%d] Error obtaining complete RPC params for player (game bot id: %d):\n%v\n", gmw.Id, err, p.Id)
-								continue
-							}
-
-							pb, err := p.Bot()
-							if err != nil {
-								log.Printf("[wkr%d] Error obtaining bot for player (game bot id: %d):\n%v\n", gmw.Id, err, p.Id)
-								continue
-							}
-
-							pb.Logf("RPC call [BEGIN]: %s (gameId: %d)", cm, game.Id)
-							err = rpchelper.Notify(pb.RPCEndpoint, cm, cp)
-							if err != nil {
-								log.Printf("[wkr%d] Error notifying player for complete game (bot id: %d):\n%v\n", gmw.Id, err, pb.Id)
-								continue
-							}
-							pb.Logf("RPC call [ END ]: %s (gameId: %d)", cm, game.Id)
-						}
-					}
-
-					err = work.GameMove.SetGameState(gs)
+					// Nothing else would queue the move again so the job is kept
+					// and claimed again once its lease expires.
+					err := work.Job.Release()
 					if err != nil {
-						log.Printf("[wkr%d] Error setting game state (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-						continue
+						log.Printf("[wkr%d] Error releasing move job (job id: %d):\n%v\n", gmw.Id, work.Job.Id, err)
 					}
 				}
 
-				err = work.GameMove.MarkComplete()
-				if err != nil {
-					log.Printf("[wkr%d] Error marking game move as complete (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
-					continue
-				}
-
-				continue
+				// Moves for this bot may have been held back whilst it was busy.
+				notifyMoveQueued()
+				setWorkerIdle(gmw.Id)
+				inFlight.Done()
 
 			case <-gmw.QuitChan:
 				// We have been asked to stop.
@@ -257,45 +79,259 @@ func (gmw GameMoveWorker) Start() {
 	}()
 }
 
-func sendError(gm games.GameManager, gameMove repository.GameMove, originalErr error) {
-	em := gm.GetErrorRPCMethodName()
-	ep := gm.GetErrorRPCParams(gameMove, originalErr.Error())
+// processGameMove plays a single move, calling the bot for its next move and
+// then either creating the following move or completing the game. It returns
+// false if the move couldn't be played because of an internal error, in which
+// case the move's job must be kept so that it is played later.
+func (gmw GameMoveWorker) processGameMove(work GameMoveRequest) bool {
+	// If the game move has already been played, e.g. by a worker node whose lease on it
+	// expired, just return.
+	if work.GameMove.Status != repository.GAMEMOVE_STATUS_AWAITING {
+		return true
+	}
+
+	gameBot, err := work.GameMove.GameBot()
+	if err != nil {
+		log.Printf("[wkr%d] Error retrieving GameBot:\n%v\n", gmw.Id, err)
+		return false
+	}
+
+	bot, err := gameBot.Bot()
+	if err != nil {
+		log.Printf("[wkr%d] Error retrieving GameBot Bot:\n%v\n", gmw.Id, err)
+		return false
+	}
+
+	game, err := gameBot.Game()
+	if err != nil {
+		log.Printf("[wkr%d] Error retrieving GameBot Game:\n%v\n", gmw.Id, err)
+		return false
+	}
+
+	gameType, err := game.GameType()
+	if err != nil {
+		log.Printf("[wkr%d] Error retrieving GameType:\n%v\n", gmw.Id, err)
+		return false
+	}
+
+	// If the Bot is marked as ERROR or OFFLINE then don't process this move. Superseded
+	// versions are the exception, they continue to play regression games against newer
+	// versions of themselves. Suspect bots keep playing whilst they still respond.
+	if bot.Status != repository.BOT_STATUS_ONLINE && bot.Status != repository.BOT_STATUS_SUSPECT {
+		if bot.Status != repository.BOT_STATUS_SUPERSEDED || game.Kind != repository.GAME_KIND_REGRESSION {
+			return true
+		}
+	}
+
+	// Ping the bot to ensure its still online. If it isn't the move is left
+	// awaiting and is queued again once the bot responds, unless the bot is a
+	// superseded version.
+	if !CheckBotHealth(&bot) {
+		failUnreachableVersion(work, bot, fmt.Errorf("%s (version: %s) did not respond to a ping.", bot.Name, bot.Version))
+		return true
+	}
+
+	gameManager, err := games.GetGameManager(gameType)
+	if err != nil {
+		log.Printf("[wkr%d] Error obtaining GameManager for game (gameType: %s):\n%v\n", gmw.Id, err, gameType)
+		return false
+	}
+
+	err = game.MarkInProgress()
+	if err != nil {
+		log.Printf("[wkr%d] Error marking game in progress (game id: %d):\n%v\n", gmw.Id, err, game.Id)
+		return false
+	}
+
+	method := gameManager.GetNextMoveRPCMethodName()
 
-	fmt.Printf("")
+	params, err := gameManager.GetNextMoveRPCParams(work.GameMove)
+	if err != nil {
+		log.Printf("[wkr%d] Error obtaining next move RPC params (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
+		failMove(work, bot, repository.FAILED_MOVE_REASON_INTERNAL, err, "")
+		return true
+	}
 
-	gb, err := gameMove.GameBot()
+	var rsr rpchelper.RPCServerResponse
+	log.Printf("[wkr%d] Calling %s for %s (move id: %d)\n", gmw.Id, method, bot.Name, work.GameMove.Id)
+	err = work.GameMove.SetStartDateTime()
+	if err != nil {
+		log.Printf("[wkr%d] Error setting start_datetime (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
+		return false
+	}
+	events.Publish(events.MoveRequested{
+		Game:     game,
+		GameType: gameType,
+		GameMove: work.GameMove,
+		Bot:      bot,
+		Method:   method,
+	})
+	rpcErr := rpchelper.DefaultPolicy().Call(bot.RPCEndpoint, method, params, &rsr, bot.RPCAttemptRecorder(work.GameMove))
+	// If the node stopped whilst the bot was thinking the move has been put back
+	// in the queue for another node to play, so its result is thrown away.
+	if nodeStopped() {
+		log.Printf("[wkr%d] Node stopped whilst calling %s for %s, the move has been requeued (move id: %d)\n", gmw.Id, method, bot.Name, work.GameMove.Id)
+		return true
+	}
+	err = work.GameMove.SetEndDateTime()
 	if err != nil {
-		log.Println("Error in sendError (game move id %d):1:\n%s\n", gameMove.Id, err)
+		log.Printf("[wkr%d] Error setting end_datetime (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
+		return false
+	}
+	log.Printf("[wkr%d] Call %s complete for %s (move id: %d)\n", gmw.Id, method, bot.Name, work.GameMove.Id)
+	events.Publish(events.MoveCompleted{
+		Game:     game,
+		GameType: gameType,
+		GameMove: work.GameMove,
+		Bot:      bot,
+		Method:   method,
+		Err:      rpcErr,
+	})
+	if rpcErr != nil {
+		// If the bot couldn't be reached it isn't at fault so the move is left
+		// to be played once the bot responds again.
+		if rpchelper.IsTransportError(rpcErr) {
+			recordCallFailure(&bot, rpcErr)
+			failUnreachableVersion(work, bot, rpcErr)
+			return true
+		}
+		var lastResponse string
+		if pe, ok := rpcErr.(rpchelper.ProtocolError); ok {
+			lastResponse = string(pe.Body)
+		}
+		failMove(work, bot, repository.FAILED_MOVE_REASON_BOT_ERROR, rpcErr, lastResponse)
+		suspendGame(work, game, gameType, &bot, rpcErr)
+		return true
+	}
+
+	// A response without a result object, e.g. a null or missing result, can't
+	// be played so it is treated as a bad move rather than completing the move
+	// with nothing to follow it.
+	res, ok := rsr.Result.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("The response to %s did not contain a result object.", method)
+		lastResponse, _ := json.Marshal(rsr)
+		failMove(work, bot, repository.FAILED_MOVE_REASON_BOT_ERROR, err, string(lastResponse))
+		suspendGame(work, game, gameType, &bot, err)
+		return true
 	}
 
-	bot, err := gb.Bot()
+	gs, gameResult, err := gameManager.ProcessMove(work.GameMove, res)
 	if err != nil {
-		log.Println("Error in sendError (game move id %d):2:\n%s\n", gameMove.Id, err)
+		lastResponse, _ := json.Marshal(res)
+		failMove(work, bot, repository.FAILED_MOVE_REASON_BOT_ERROR, err, string(lastResponse))
+		suspendGame(work, game, gameType, &bot, err)
+		return true
+	}
+
+	outcome := repository.MoveOutcome{
+		GameState: gs,
+		Win:       gameResult == games.GAME_RESULT_WIN,
+	}
+	if gameResult == games.GAME_RESULT_UNDECIDED {
+		nextBot, err := gameManager.GetGameBotForNextMove(work.GameMove)
+		if err != nil {
+			log.Printf("[wkr%d] Error obtaining game bot for next move (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
+			failMove(work, bot, repository.FAILED_MOVE_REASON_INTERNAL, err, "")
+			return true
+		}
+		outcome.NextGameBot = &nextBot
+	}
+
+	var players []repository.GameBot
+	if outcome.NextGameBot == nil {
+		players, err = game.Players()
+		if err != nil {
+			log.Printf("[wkr%d] Error obtaining a player list for the game (game id: %d):\n%v\n", gmw.Id, err, game.Id)
+			return false
+		}
+
+		winningTeam := 0
+		if outcome.Win {
+			winningTeam = gameBot.Team
+		}
+		outcome.Rate = func(tx *repository.Tx) error {
+			return RateGameTx(tx, game, players, winningTeam)
+		}
 	}
 
-	g, err := gb.Game()
+	// The game state, the next move and its job, or the completion and rating
+	// of the game, and the completion of this move are stored together so that a
+	// crash part way through can't leave the game in between.
+	_, err = work.GameMove.ApplyOutcome(game, work.Job, outcome)
 	if err != nil {
-		log.Println("Error in sendError (game move id %d):3:\n%s\n", gameMove.Id, err)
+		if err == repository.ErrMoveJobLeaseLost {
+			log.Printf("[wkr%d] The move was given to another worker node before its outcome was stored (game move id: %d)\n", gmw.Id, work.GameMove.Id)
+		} else if err != repository.ErrMoveAlreadyApplied {
+			log.Printf("[wkr%d] Error applying the outcome of the game move (game move id: %d):\n%v\n", gmw.Id, err, work.GameMove.Id)
+			failMove(work, bot, repository.FAILED_MOVE_REASON_INTERNAL, err, "")
+		}
+		return true
 	}
 
-	players, err := g.Players()
+	if outcome.NextGameBot != nil {
+		notifyMoveQueued()
+		return true
+	}
+
+	// Qualification and the Complete notifications are handled by subscribers
+	// to this event.
+	events.Publish(events.GameCompleted{
+		Game:     game,
+		GameType: gameType,
+		Result:   string(gameResult),
+		Players:  players,
+	})
+	return true
+}
+
+// failMove records that the move couldn't be played. The move is left awaiting
+// play until it is retried, skipped or abandoned. Nothing is recorded if the
+// move has since been given to another worker node.
+func failMove(work GameMoveRequest, bot repository.Bot, reason repository.FailedMoveReason, cause error, lastResponse string) {
+	err := repository.RecordFailedMove(work.Job, work.GameMove, bot, reason, cause, lastResponse)
+	if err == repository.ErrMoveJobLeaseLost {
+		log.Printf("The move was given to another worker node before its failure was recorded (game move id: %d)\n", work.GameMove.Id)
+		return
+	}
 	if err != nil {
-		log.Println("Error in sendError (game move id %d):4:\n%s\n", gameMove.Id, err)
+		log.Printf("Error recording failed move (game move id: %d):\n%v\n", work.GameMove.Id, err)
 	}
+}
 
-	for _, p := range players {
-		pb, _ := p.Bot()
-		pb.Logf("Game suspended %s caused an error (gameId: %d)", bot.Name, g.Id)
+// failUnreachableVersion records the move as failed if the bot is a superseded
+// version. Superseded versions are never brought back online so nothing else
+// would queue the move again once the bot responds.
+func failUnreachableVersion(work GameMoveRequest, bot repository.Bot, cause error) {
+	if bot.Status != repository.BOT_STATUS_SUPERSEDED {
+		return
 	}
+	failMove(work, bot, repository.FAILED_MOVE_REASON_UNREACHABLE, cause, "")
+}
 
-	bot.Logf("RPC call [BEGIN]: %s (gameId: %d)", em, g.Id)
-	err = rpchelper.Notify(bot.RPCEndpoint, em, ep)
+// suspendGame marks the bot as in error after its move caused an error, leaving
+// the game unfinished until the bot is fixed. If the move has since been given
+// to another worker node the bot is left for that node to judge.
+func suspendGame(work GameMoveRequest, game repository.Game, gameType repository.GameType, bot *repository.Bot, cause error) {
+	from := bot.Status
+	err := bot.MarkErrorForJob(work.Job)
+	if err == repository.ErrMoveJobLeaseLost {
+		log.Printf("The move was given to another worker node before its bot was marked as error (game move id: %d)\n", work.GameMove.Id)
+		return
+	}
 	if err != nil {
-		bot.Logf("RPC call [ END ]: %s (gameId: %d) error: %s", em, g.Id, err)
-		log.Println("Error in sendError (game move id %d):5:\n%s\n", gameMove.Id, err)
-	} else {
-		bot.Logf("RPC call [ END ]: %s (gameId: %d) success", em, g.Id)
+		log.Printf("Error marking a bot as error status (bot id: %d):\n%v\n", bot.Id, err)
+		return
 	}
+
+	events.Publish(events.GameSuspended{
+		Game:     game,
+		GameType: gameType,
+		GameMove: work.GameMove,
+		Bot:      *bot,
+		Err:      cause,
+	})
+	publishStatusChange(bot, from, cause.Error())
 }
 
 // Stop tells the worker to stop listening for work requests.
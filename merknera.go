@@ -1,23 +1,40 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"os"
 
 	"github.com/graphql-go/handler"
+	"github.com/mleonard87/merknera/games"
 	"github.com/mleonard87/merknera/gameworker"
 	"github.com/mleonard87/merknera/graphql"
+	"github.com/mleonard87/merknera/metrics"
 	"github.com/mleonard87/merknera/repository"
+	"github.com/mleonard87/merknera/scheduler"
 	"github.com/mleonard87/merknera/schema"
 	"github.com/mleonard87/merknera/security"
 	"github.com/mleonard87/merknera/services"
+	"github.com/mleonard87/merknera/webhooks"
 	"github.com/mleonard87/rpc"
 	"github.com/mleonard87/rpc/json"
 )
 
+const (
+	ENVVAR_SHUTDOWN_TIMEOUT = "MERKNERA_SHUTDOWN_TIMEOUT"
+
+	// The default number of seconds to wait for moves that are being played to
+	// finish when shutting down. Moves that haven't finished are requeued.
+	DEFAULT_SHUTDOWN_TIMEOUT = 30
+)
+
 func registerRPCHandler() {
 	s := rpc.NewServer()
 	s.RegisterCodec(json.NewCodec(), "application/json")
@@ -47,6 +64,10 @@ func registerAboutHandler() {
 	})
 }
 
+func registerMetricsHandler() {
+	http.Handle("/metrics", metrics.Handler())
+}
+
 func registerLoginHandler() {
 	lih := security.LoginHandler{}
 	http.Handle("/login", lih)
@@ -54,26 +75,24 @@ func registerLoginHandler() {
 	http.Handle("/logout", loh)
 }
 
-func verifyBotsAndQueueMoves() {
+// verifyBots pings every bot to update its health. Moves queued before a restart
+// are held in the move job table so there is no need to queue them again.
+func verifyBots() {
 	botList, err := repository.ListBots()
 	if err != nil {
 		log.Fatal(err)
 	}
 	for _, b := range botList {
-		b.Ping()
+		gameworker.CheckBotHealth(&b)
 	}
+}
 
-	// Find all moves that are currently awaiting play and queue them.
-	awaitingMoves, err := repository.ListAwaitingMoves()
+func main() {
+	err := games.CreateGameTypes()
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, gm := range awaitingMoves {
-		gameworker.QueueGameMove(gm)
-	}
-}
 
-func main() {
 	registerRPCHandler()
 	registerGraphQLHandler()
 	graphiql := os.Getenv("MERKNERA_GRAPHIQL")
@@ -82,11 +101,59 @@ func main() {
 	}
 	registerAboutHandler()
 	registerLoginHandler()
+	registerMetricsHandler()
+
+	gameworker.StartGameMoveDispatcher(gameworker.WorkerPoolSize())
+
+	go verifyBots()
+	gameworker.StartHealthMonitor()
+	gameworker.StartQualificationSweep()
+	webhooks.StartWebhookDelivery()
+
+	scheduler.StartBacklogScheduler()
+	scheduler.StartLadderScheduler()
+
+	server := &http.Server{Addr: ":8080"}
+	go func() {
+		fmt.Println("Merknera is now listening on localhost:8080")
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	fmt.Printf("Received %s, shutting down\n", sig)
+	shutdown(server)
+}
 
-	gameworker.StartGameMoveDispatcher(4)
+// shutdown stops Merknera taking on new work, gives the moves that are being
+// played a chance to finish and then closes the HTTP server. The HTTP server is
+// closed last so that the GraphQL API stays available whilst moves are drained.
+func shutdown(server *http.Server) {
+	timeout := DEFAULT_SHUTDOWN_TIMEOUT
+	if v, err := strconv.Atoi(os.Getenv(ENVVAR_SHUTDOWN_TIMEOUT)); err == nil && v >= 0 {
+		timeout = v
+	}
+	deadline := time.Duration(timeout) * time.Second
 
-	go verifyBotsAndQueueMoves()
+	services.StopRegistrations()
+	scheduler.Stop()
+
+	err := gameworker.Shutdown(deadline)
+	if err != nil {
+		log.Printf("An error occurred in merknera.shutdown():1:\n%s\n", err)
+	}
+	webhooks.StopWebhookDelivery()
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("An error occurred in merknera.shutdown():2:\n%s\n", err)
+	}
 
-	fmt.Println("Merknera is now listening on localhost:8080")
-	http.ListenAndServe(":8080", nil)
+	fmt.Println("Merknera has shut down")
 }
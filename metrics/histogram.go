@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Histogram counts observations, e.g. latencies, into buckets.
+type Histogram struct {
+	vec     *vec
+	buckets []float64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds. A +Inf
+// bucket is always added.
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	if len(b) == 0 || !math.IsInf(b[len(b)-1], 1) {
+		b = append(b, math.Inf(1))
+	}
+
+	h := &Histogram{
+		vec:     newVec(name, help, "histogram", labelNames),
+		buckets: b,
+	}
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.lock.Lock()
+	defer h.vec.lock.Unlock()
+
+	s := h.vec.series(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.value += v
+	s.count++
+}
+
+// ObserveDuration records a duration in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.vec.lock.Lock()
+	defer h.vec.lock.Unlock()
+
+	h.vec.writeHeader(buf)
+	for _, s := range h.vec.sortedSeries() {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", h.vec.name, labels(h.vec.labelNames, s.labelValues, "le", formatFloat(upper)), s.buckets[i])
+		}
+		l := labels(h.vec.labelNames, s.labelValues, "", "")
+		fmt.Fprintf(buf, "%s_sum%s %s\n", h.vec.name, l, formatFloat(s.value))
+		fmt.Fprintf(buf, "%s_count%s %d\n", h.vec.name, l, s.count)
+	}
+}
@@ -0,0 +1,237 @@
+// Package metrics exposes counters, gauges and histograms in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric is anything that can write itself in the text format.
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+var registryLock sync.Mutex
+var registry []metric
+var registered = make(map[string]bool)
+var scrapeFuncs []func()
+
+func register(name string, m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if registered[name] {
+		log.Fatalf("The metric %s has already been registered.", name)
+	}
+	registered[name] = true
+	registry = append(registry, m)
+}
+
+// OnScrape registers a function that is called before the metrics are written,
+// e.g. to set gauges that are expensive to keep up to date.
+func OnScrape(f func()) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	scrapeFuncs = append(scrapeFuncs, f)
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryLock.Lock()
+		funcs := append([]func(){}, scrapeFuncs...)
+		metrics := append([]metric{}, registry...)
+		registryLock.Unlock()
+
+		for _, f := range funcs {
+			f()
+		}
+
+		var buf bytes.Buffer
+		for _, m := range metrics {
+			m.write(&buf)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// vec holds one value per combination of label values.
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	lock   sync.Mutex
+	values map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Only used by histograms.
+	buckets []uint64
+	count   uint64
+}
+
+func newVec(name string, help string, kind string, labelNames []string) *vec {
+	return &vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]*series),
+	}
+}
+
+// series returns the series for the label values. v.lock must be held.
+func (v *vec) series(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		log.Printf("The metric %s expects %d label values but was given %d.\n", v.name, len(v.labelNames), len(labelValues))
+		labelValues = make([]string, len(v.labelNames))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.values[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.values[key] = s
+	}
+
+	return s
+}
+
+// sortedSeries returns the series in a stable order. v.lock must be held.
+func (v *vec) sortedSeries() []*series {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seriesList := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		seriesList = append(seriesList, v.values[k])
+	}
+
+	return seriesList
+}
+
+func (v *vec) writeHeader(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+// labels formats the label pairs, with any extra pair appended, as {a="b"}.
+func labels(names []string, values []string, extraName string, extraValue string) string {
+	var pairs []string
+	for i, n := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", n, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, escapeLabelValue(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter is a value that only goes up, e.g. the number of games completed.
+type Counter struct {
+	vec *vec
+}
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labelNames)}
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+
+	c.vec.lock.Lock()
+	defer c.vec.lock.Unlock()
+	c.vec.series(labelValues).value += v
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	writeValues(c.vec, buf)
+}
+
+// Gauge is a value that can go up and down, e.g. the number of busy workers.
+type Gauge struct {
+	vec *vec
+}
+
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labelNames)}
+	register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.lock.Lock()
+	defer g.vec.lock.Unlock()
+	g.vec.series(labelValues).value = v
+}
+
+func (g *Gauge) write(buf *bytes.Buffer) {
+	writeValues(g.vec, buf)
+}
+
+func writeValues(v *vec, buf *bytes.Buffer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.writeHeader(buf)
+	for _, s := range v.sortedSeries() {
+		fmt.Fprintf(buf, "%s%s %s\n", v.name, labels(v.labelNames, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
@@ -0,0 +1,52 @@
+package rating
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	ELO_NAME           = "ELO"
+	ELO_INITIAL_RATING = 1500.0
+	ELO_K_FACTOR       = 32.0
+)
+
+func init() {
+	RegisterEngine(new(EloEngine))
+}
+
+// EloEngine rates two-player games using the Elo rating system.
+type EloEngine struct{}
+
+func (e EloEngine) Name() string {
+	return ELO_NAME
+}
+
+func (e EloEngine) Initial() Rating {
+	return Rating{Mu: ELO_INITIAL_RATING}
+}
+
+func (e EloEngine) Rate(teams []Team) ([][]Rating, error) {
+	if len(teams) != 2 || len(teams[0].Ratings) != 1 || len(teams[1].Ratings) != 1 {
+		return nil, errors.New("Elo ratings can only be calculated for games between exactly two bots.")
+	}
+
+	a := teams[0].Ratings[0]
+	b := teams[1].Ratings[0]
+
+	var score float64
+	switch {
+	case teams[0].Rank < teams[1].Rank:
+		score = 1
+	case teams[0].Rank == teams[1].Rank:
+		score = 0.5
+	}
+
+	expected := 1 / (1 + math.Pow(10, (b.Mu-a.Mu)/400))
+	change := ELO_K_FACTOR * (score - expected)
+
+	return [][]Rating{
+		{{Mu: a.Mu + change}},
+		{{Mu: b.Mu - change}},
+	}, nil
+}
@@ -0,0 +1,47 @@
+package rating
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rating is a bots skill estimate. Mu is the rating itself and Sigma the
+// uncertainty in it. Engines that have no notion of uncertainty, such as Elo,
+// leave Sigma as zero.
+type Rating struct {
+	Mu    float64
+	Sigma float64
+}
+
+// Team is a group of bots that finished a game in the same position. In games
+// without teams each team is a single bot. Rank is the finishing position with
+// 1 being first, teams with an equal rank tied.
+type Team struct {
+	Rank    int
+	Ratings []Rating
+}
+
+type Engine interface {
+	Name() string
+	// Initial is the rating given to a bot before it has played a rated game.
+	Initial() Rating
+	// Rate returns the new ratings of every bot after a game with the given
+	// finishing order, in the same order as the teams and ratings given.
+	Rate(teams []Team) ([][]Rating, error)
+}
+
+var registeredEngines = make(map[string]Engine)
+
+func RegisterEngine(e Engine) {
+	registeredEngines[e.Name()] = e
+}
+
+func GetEngine(name string) (Engine, error) {
+	e, ok := registeredEngines[name]
+	if !ok {
+		em := fmt.Sprintf("Unknown rating engine \"%s\".", name)
+		return nil, errors.New(em)
+	}
+
+	return e, nil
+}
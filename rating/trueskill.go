@@ -0,0 +1,95 @@
+package rating
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	TRUESKILL_NAME  = "TRUESKILL"
+	TRUESKILL_MU    = 25.0
+	TRUESKILL_SIGMA = TRUESKILL_MU / 3
+	TRUESKILL_BETA  = TRUESKILL_SIGMA / 2
+	// The smallest fraction a variance may shrink to in a single game so that
+	// it never reaches zero.
+	TRUESKILL_KAPPA = 0.0001
+)
+
+func init() {
+	RegisterEngine(new(TrueSkillEngine))
+}
+
+// TrueSkillEngine rates games with any number of bots or teams from their full
+// finishing order, allowing ties. It uses the Bradley-Terry full pairing
+// approximation from Weng and Lin's "A Bayesian Approximation Method for Online
+// Ranking" which, like TrueSkill, tracks both a rating and its uncertainty.
+type TrueSkillEngine struct{}
+
+func (e TrueSkillEngine) Name() string {
+	return TRUESKILL_NAME
+}
+
+func (e TrueSkillEngine) Initial() Rating {
+	return Rating{Mu: TRUESKILL_MU, Sigma: TRUESKILL_SIGMA}
+}
+
+func (e TrueSkillEngine) Rate(teams []Team) ([][]Rating, error) {
+	if len(teams) < 2 {
+		return nil, errors.New("At least two teams are required to calculate ratings.")
+	}
+
+	// A team's skill is the sum of its members.
+	mu := make([]float64, len(teams))
+	variance := make([]float64, len(teams))
+	for i, t := range teams {
+		if len(t.Ratings) == 0 {
+			return nil, errors.New("Every team must have at least one bot to calculate ratings.")
+		}
+		for _, r := range t.Ratings {
+			mu[i] += r.Mu
+			variance[i] += r.Sigma * r.Sigma
+		}
+	}
+
+	newRatings := make([][]Rating, len(teams))
+	for i, t := range teams {
+		var omega float64
+		var delta float64
+		for q := range teams {
+			if q == i {
+				continue
+			}
+
+			c := math.Sqrt(variance[i] + variance[q] + 2*TRUESKILL_BETA*TRUESKILL_BETA)
+			p := 1 / (1 + math.Exp((mu[q]-mu[i])/c))
+
+			var score float64
+			switch {
+			case t.Rank < teams[q].Rank:
+				score = 1
+			case t.Rank == teams[q].Rank:
+				score = 0.5
+			}
+
+			gamma := math.Sqrt(variance[i]) / c
+			omega += variance[i] / c * (score - p)
+			delta += gamma * variance[i] / (c * c) * p * (1 - p)
+		}
+
+		// Each bot takes a share of its team's update in proportion to how
+		// uncertain its own rating is.
+		for _, r := range t.Ratings {
+			var share float64
+			if variance[i] > 0 {
+				share = (r.Sigma * r.Sigma) / variance[i]
+			}
+			newVariance := r.Sigma * r.Sigma * math.Max(1-share*delta, TRUESKILL_KAPPA)
+			newRatings[i] = append(newRatings[i], Rating{
+				Mu:    r.Mu + share*omega,
+				Sigma: math.Sqrt(newVariance),
+			})
+		}
+	}
+
+	return newRatings, nil
+}
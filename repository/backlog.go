@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Pairing is a game between teams of bots that has yet to be created. Teams
+// play in the order they are given.
+type Pairing struct {
+	GameType GameType
+	Teams    [][]Bot
+	Kind     GameKind
+	Rated    bool
+}
+
+// BacklogPairing is a pairing held in the backlog until it is released and its
+// game created.
+type BacklogPairing struct {
+	Id int
+	Pairing
+	CreatedDateTime time.Time
+}
+
+// ErrBacklogPairingReleased is returned when releasing a pairing that has
+// already been released, e.g. by another worker node.
+var ErrBacklogPairingReleased = errors.New("This pairing has already been released from the backlog.")
+
+// AddToBacklog stores the pairings in the backlog. Their games are not created
+// until they are released by the backlog scheduler.
+func AddToBacklog(pairings []Pairing) error {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in backlog.AddToBacklog():1:\n%s\n", err)
+		return err
+	}
+
+	for _, p := range pairings {
+		var pairingId int
+		err = tx.QueryRow(`
+		INSERT INTO backlog_pairing (
+		  game_type_id
+		, kind
+		, rated
+		) VALUES (
+		  $1
+		, $2
+		, $3
+		) RETURNING id
+		`, p.GameType.Id, string(p.Kind), p.Rated).Scan(&pairingId)
+		if err != nil {
+			log.Printf("An error occurred in backlog.AddToBacklog():2:\n%s\n", err)
+			tx.Rollback()
+			return err
+		}
+
+		for t, team := range p.Teams {
+			for i, b := range team {
+				_, err = tx.Exec(`
+				INSERT INTO backlog_pairing_bot (
+				  backlog_pairing_id
+				, bot_id
+				, team
+				, position
+				) VALUES (
+				  $1
+				, $2
+				, $3
+				, $4
+				)
+				`, pairingId, b.Id, t+1, i+1)
+				if err != nil {
+					log.Printf("An error occurred in backlog.AddToBacklog():3:\n%s\n", err)
+					tx.Rollback()
+					return err
+				}
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in backlog.AddToBacklog():4:\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListBacklogPairings returns up to limit unreleased pairings from the backlog,
+// oldest first.
+func ListBacklogPairings(limit int) ([]BacklogPairing, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  bp.id
+	, bp.game_type_id
+	, bp.kind
+	, bp.rated
+	, bp.created_datetime
+	FROM backlog_pairing bp
+	WHERE bp.released_datetime IS NULL
+	ORDER BY bp.created_datetime, bp.id
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		log.Printf("An error occurred in backlog.ListBacklogPairings():1:\n%s\n", err)
+		return []BacklogPairing{}, err
+	}
+
+	var pairingList []BacklogPairing
+	var gameTypeIds []int
+	for rows.Next() {
+		var bp BacklogPairing
+		var gameTypeId int
+		var kind string
+		err := rows.Scan(&bp.Id, &gameTypeId, &kind, &bp.Rated, &bp.CreatedDateTime)
+		if err != nil {
+			rows.Close()
+			log.Printf("An error occurred in backlog.ListBacklogPairings():2:\n%s\n", err)
+			return pairingList, err
+		}
+		bp.Kind = GameKind(kind)
+		pairingList = append(pairingList, bp)
+		gameTypeIds = append(gameTypeIds, gameTypeId)
+	}
+	rows.Close()
+
+	for i := range pairingList {
+		bp := &pairingList[i]
+		bp.GameType, err = GetGameTypeById(gameTypeIds[i])
+		if err != nil {
+			log.Printf("An error occurred in backlog.ListBacklogPairings():3:\n%s\n", err)
+			return pairingList, err
+		}
+
+		bp.Teams, err = listPairingTeams(bp.Id)
+		if err != nil {
+			log.Printf("An error occurred in backlog.ListBacklogPairings():4:\n%s\n", err)
+			return pairingList, err
+		}
+	}
+
+	return pairingList, nil
+}
+
+func listPairingTeams(pairingId int) ([][]Bot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  bot_id
+	, team
+	FROM backlog_pairing_bot
+	WHERE backlog_pairing_id = $1
+	ORDER BY team, position
+	`, pairingId)
+	if err != nil {
+		return [][]Bot{}, err
+	}
+
+	var botIds []int
+	var botTeams []int
+	for rows.Next() {
+		var botId int
+		var team int
+		err := rows.Scan(&botId, &team)
+		if err != nil {
+			rows.Close()
+			return [][]Bot{}, err
+		}
+		botIds = append(botIds, botId)
+		botTeams = append(botTeams, team)
+	}
+	rows.Close()
+
+	var teams [][]Bot
+	for i, id := range botIds {
+		b, err := GetBotById(id)
+		if err != nil {
+			return teams, err
+		}
+		if i == 0 || botTeams[i] != botTeams[i-1] {
+			teams = append(teams, []Bot{})
+		}
+		teams[len(teams)-1] = append(teams[len(teams)-1], b)
+	}
+
+	return teams, nil
+}
+
+// BeginRelease starts the transaction that releases the pairing, locking it so
+// that it is only released once. If it has already been released, or is being
+// released by another worker node, ErrBacklogPairingReleased is returned.
+func (bp *BacklogPairing) BeginRelease() (*Tx, error) {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in backlog.BeginRelease():1:\n%s\n", err)
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+	SELECT id
+	FROM backlog_pairing
+	WHERE id = $1
+	AND released_datetime IS NULL
+	FOR UPDATE SKIP LOCKED
+	`, bp.Id).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, ErrBacklogPairingReleased
+	}
+	if err != nil {
+		log.Printf("An error occurred in backlog.BeginRelease():2:\n%s\n", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// FinishRelease marks the pairing as released with the game created for it and
+// commits the transaction. The transaction is rolled back if anything fails.
+func (bp *BacklogPairing) FinishRelease(tx *Tx, game Game) error {
+	_, err := tx.Exec(`
+	UPDATE backlog_pairing
+	SET
+	  released_datetime = now()
+	, game_id = $1
+	WHERE id = $2
+	`, game.Id, bp.Id)
+	if err != nil {
+		log.Printf("An error occurred in backlog.FinishRelease():1:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in backlog.FinishRelease():2:\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
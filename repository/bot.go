@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -16,12 +17,33 @@ import (
 type BotStatus string
 
 const (
-	BOT_STATUS_ONLINE     BotStatus = "ONLINE"
+	BOT_STATUS_ONLINE BotStatus = "ONLINE"
+	// A bot is suspect once a call to it has failed. It keeps playing but is
+	// taken offline if it keeps failing.
+	BOT_STATUS_SUSPECT    BotStatus = "SUSPECT"
 	BOT_STATUS_OFFLINE    BotStatus = "OFFLINE"
 	BOT_STATUS_ERROR      BotStatus = "ERROR"
 	BOT_STATUS_SUPERSEDED BotStatus = "SUPERSEDED"
 )
 
+// BotStage describes which games a bot takes part in. RANKED bots play on the
+// public ladder whereas SANDBOX bots only play unrated games against house bots
+// and bots that have opted in to play against the sandbox. QUALIFYING bots are
+// new versions playing unrated qualification games whilst the previous version
+// stays on the ladder, if they fail to qualify they are DISCARDED.
+type BotStage string
+
+const (
+	BOT_STAGE_RANKED     BotStage = "RANKED"
+	BOT_STAGE_SANDBOX    BotStage = "SANDBOX"
+	BOT_STAGE_QUALIFYING BotStage = "QUALIFYING"
+	BOT_STAGE_DISCARDED  BotStage = "DISCARDED"
+)
+
+// ErrBotAlreadyPromoted is returned by Promote when the bot has already left the
+// sandbox or qualification.
+var ErrBotAlreadyPromoted = errors.New("This bot has already been promoted.")
+
 type Bot struct {
 	Id                     int `json:"id"`
 	Name                   string
@@ -36,6 +58,9 @@ type Bot struct {
 	Description            string
 	Status                 BotStatus
 	LastOnlineDateTime     time.Time
+	Stage                  BotStage
+	SandboxOpponent        bool
+	MaxConcurrency         int
 	gamesWonCountLoaded    bool
 	gamesWonCount          int
 	gamesDrawnCountLoaded  bool
@@ -70,40 +95,28 @@ func (b *Bot) User() (User, error) {
 	return b.user, nil
 }
 
-// Ping will make an RPC call to the Status.Ping method. If this does not return
-// then mark te bot as offline and will not participate in any further games until
-// it is found to be online again.
-func (b *Bot) Ping() (bool, error) {
+// Ping makes an RPC call to the bot's Status.Ping method to check that the bot
+// can be reached. The bot's status is left for the caller to update.
+func (b *Bot) Ping() error {
 	b.Logf("RPC call [BEGIN]: Status.Ping %s", b.RPCEndpoint)
-	err := rpchelper.Ping(b.RPCEndpoint)
+	err := rpchelper.DefaultPolicy().Ping(b.RPCEndpoint, b.RPCAttemptRecorder(GameMove{}))
 	if err != nil {
-		err2 := b.MarkOffline()
-		if err2 != nil {
-			log.Printf("An error occurred in bot.Ping():1:\n%s\n", err2)
-			return false, err2
-		}
-		// This is actually fine. If we can't reach the bot it gets marked
-		// as offline and all is good.
-		b.Logf("RPC call [ END ]: Status.Ping Offline: ", err.Error())
-		return false, nil
-	}
-
-	err = b.MarkOnline()
-	if err != nil {
-		log.Printf("An error occurred in bot.Ping():3:\n%s\n", err)
-		return false, err
+		b.Logf("RPC call [ END ]: Status.Ping Offline: %s", err)
+		return err
 	}
 
 	b.Log("RPC call [ END ]: Status.Ping Online")
-	return true, nil
+	return nil
 }
 
 func (b *Bot) setStatus(status BotStatus) error {
-	db := GetDB()
+	return b.setStatusWith(GetDB(), status)
+}
 
+func (b *Bot) setStatusWith(q querier, status BotStatus) error {
 	var err error
 	if status == BOT_STATUS_ONLINE || status == BOT_STATUS_ERROR {
-		_, err = db.Exec(`
+		_, err = q.Exec(`
 		UPDATE bot
 		SET
 		  status = $1
@@ -112,7 +125,7 @@ func (b *Bot) setStatus(status BotStatus) error {
 		AND status != $4
 		`, string(status), time.Now(), b.Id, string(BOT_STATUS_SUPERSEDED))
 	} else {
-		_, err = db.Exec(`
+		_, err = q.Exec(`
 		UPDATE bot
 		SET status = $1
 		WHERE id = $2
@@ -146,6 +159,15 @@ func (b *Bot) MarkOnline() error {
 	return nil
 }
 
+func (b *Bot) MarkSuspect() error {
+	err := b.setStatus(BOT_STATUS_SUSPECT)
+	if err != nil {
+		return err
+	}
+	b.Status = BOT_STATUS_SUSPECT
+	return nil
+}
+
 func (b *Bot) MarkError() error {
 	err := b.setStatus(BOT_STATUS_ERROR)
 	if err != nil {
@@ -155,6 +177,76 @@ func (b *Bot) MarkError() error {
 	return nil
 }
 
+// MarkErrorForJob marks the bot as in error after its move, played under the
+// job, caused an error. If the job is no longer leased to the worker node that
+// played the move, e.g. because the node was stopped or declared dead,
+// ErrMoveJobLeaseLost is returned and the bot is left alone.
+func (b *Bot) MarkErrorForJob(job MoveJob) error {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in bot.MarkErrorForJob():1:\n%s\n", err)
+		return err
+	}
+
+	err = job.lockLease(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = b.setStatusWith(tx, BOT_STATUS_ERROR)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in bot.MarkErrorForJob():2:\n%s\n", err)
+		return err
+	}
+	b.Status = BOT_STATUS_ERROR
+
+	return nil
+}
+
+// SetSandboxOpponent sets whether this bot is willing to play unrated games
+// against bots in the sandbox.
+func (b *Bot) SetSandboxOpponent(enabled bool) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE bot
+	SET sandbox_opponent = $1
+	WHERE id = $2
+	`, enabled, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.SetSandboxOpponent():\n%s\n", err)
+		return err
+	}
+
+	b.SandboxOpponent = enabled
+
+	return nil
+}
+
+func (b *Bot) SetMaxConcurrency(maxConcurrency int) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE bot
+	SET max_concurrency = $1
+	WHERE id = $2
+	`, maxConcurrency, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.SetMaxConcurrency():\n%s\n", err)
+		return err
+	}
+
+	b.MaxConcurrency = maxConcurrency
+
+	return nil
+}
+
 func (b *Bot) DoesVersionExist(version string) (bool, error) {
 	var botId int
 	db := GetDB()
@@ -183,6 +275,9 @@ func (b *Bot) GamesPlayed() ([]Game, error) {
 	  g.id
 	, g.game_type_id
 	, g.status
+	, g.kind
+	, g.rated
+	, g.challenge_id
 	FROM game_bot gb
 	JOIN game g
 	  ON gb.game_id = g.id
@@ -199,12 +294,14 @@ func (b *Bot) GamesPlayed() ([]Game, error) {
 	for rows.Next() {
 		var game Game
 		var status string
-		err := rows.Scan(&game.Id, &game.gameTypeId, &status)
+		var kind string
+		err := rows.Scan(&game.Id, &game.gameTypeId, &status, &kind, &game.Rated, &game.challengeId)
 		if err != nil {
 			log.Printf("An error occurred in bot.ListBotsForGameType():\n%s\n", err)
 			return gameList, err
 		}
 		game.Status = GameStatus(status)
+		game.Kind = GameKind(kind)
 		gameList = append(gameList, game)
 	}
 
@@ -223,6 +320,7 @@ func (b *Bot) GamesPlayedCount() (int, error) {
 	JOIN game g
 	  ON gb.game_id = g.id
 	 AND g.status = $1
+	 AND g.rated = TRUE
 	WHERE bot_id = $2
 	`, string(GAME_STATUS_COMPLETE), b.Id).Scan(&count)
 	if err != nil {
@@ -248,8 +346,14 @@ func (b *Bot) GamesWonCount() (int, error) {
 	err := db.QueryRow(`
 	SELECT COUNT(*)
 	FROM game_bot gb
+	JOIN game g
+	  ON gb.game_id = g.id
+	 AND g.rated = TRUE
+	JOIN game_bot gbw
+	  ON g.id = gbw.game_id
+	 AND gb.team = gbw.team
 	JOIN move m
-	  ON gb.id = m.game_bot_id
+	  ON gbw.id = m.game_bot_id
 	 AND m.winner = true
 	WHERE gb.bot_id = $1
 	`, b.Id).Scan(&count)
@@ -282,6 +386,7 @@ func (b *Bot) GamesDrawnCount() (int, error) {
 	  JOIN game g
 	    ON gb.game_id = g.id
 	    AND g.status = $1
+	    AND g.rated = TRUE
 	  JOIN game_bot gb2
 	    ON g.id = gb2.game_id
 	  JOIN move m
@@ -458,6 +563,20 @@ func (b *Bot) Delete() error {
 		return err
 	}
 
+	_, err = tx.Exec(`
+	DELETE FROM backlog_pairing
+	WHERE id IN (
+	  SELECT backlog_pairing_id
+	  FROM backlog_pairing_bot
+	  WHERE bot_id = $1
+	)
+	`, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Delete():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
 	_, err = tx.Exec(`
 	DELETE FROM move
 	WHERE id IN (
@@ -473,7 +592,7 @@ func (b *Bot) Delete() error {
 	)
 	`, b.Id)
 	if err != nil {
-		log.Printf("An error occurred in bot.Delete():2:\n%s\n", err)
+		log.Printf("An error occurred in bot.Delete():3:\n%s\n", err)
 		tx.Rollback()
 		return err
 	}
@@ -484,7 +603,7 @@ func (b *Bot) Delete() error {
 	WHERE bot_id = $1
 	`, b.Id)
 	if err != nil {
-		log.Printf("An error occurred in bot.Delete():3:\n%s\n", err)
+		log.Printf("An error occurred in bot.Delete():4:\n%s\n", err)
 		tx.Rollback()
 		return err
 	}
@@ -494,7 +613,7 @@ func (b *Bot) Delete() error {
 		var gameId int
 		err := rows.Scan(&gameId)
 		if err != nil {
-			log.Printf("An error occurred in bot.Delete():4:\n%s\n", err)
+			log.Printf("An error occurred in bot.Delete():5:\n%s\n", err)
 			return err
 		}
 		gameIds = append(gameIds, gameId)
@@ -513,7 +632,7 @@ func (b *Bot) Delete() error {
 	)
 	`, b.Id)
 	if err != nil {
-		log.Printf("An error occurred in bot.Delete():5:\n%s\n", err)
+		log.Printf("An error occurred in bot.Delete():6:\n%s\n", err)
 		tx.Rollback()
 		return err
 	}
@@ -524,18 +643,49 @@ func (b *Bot) Delete() error {
 		WHERE id = $1
 		`, g)
 		if err != nil {
-			log.Printf("An error occurred in bot.Delete():6:\n%s\n", err)
+			log.Printf("An error occurred in bot.Delete():7:\n%s\n", err)
 			tx.Rollback()
 			return err
 		}
 	}
 
+	_, err = tx.Exec(`
+	DELETE FROM challenge
+	WHERE challenger_bot_id = $1
+	OR opponent_bot_id = $1
+	`, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Delete():8:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
 	_, err = tx.Exec(`
 	DELETE FROM bot_log
 	WHERE bot_id = $1
 	`, b.Id)
 	if err != nil {
-		log.Printf("An error occurred in bot.Delete():7:\n%s\n", err)
+		log.Printf("An error occurred in bot.Delete():9:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM bot_rating
+	WHERE bot_id = $1
+	`, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Delete():10:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM rpc_attempt
+	WHERE bot_id = $1
+	`, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Delete():11:\n%s\n", err)
 		tx.Rollback()
 		return err
 	}
@@ -545,7 +695,7 @@ func (b *Bot) Delete() error {
 	WHERE id = $1;
 	`, b.Id)
 	if err != nil {
-		log.Printf("An error occurred in bot.Delete():8:\n%s\n", err)
+		log.Printf("An error occurred in bot.Delete():12:\n%s\n", err)
 		tx.Rollback()
 		return err
 	}
@@ -554,25 +704,44 @@ func (b *Bot) Delete() error {
 	return nil
 }
 
-func RegisterBot(name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string) (Bot, error) {
-	var botId int
-	db := GetDB()
-
-	tx, err := db.Begin()
+// supersedeBotVersions marks every version of the named bot, other than the bot
+// with the id exceptBotId, as superseded along with any of their games and moves
+// that have not yet been completed. Their pairings still held in the backlog are
+// dropped. If a stage is given only versions of the bot in that stage are
+// superseded.
+func supersedeBotVersions(tx *Tx, name string, exceptBotId int, stage BotStage) error {
+	// Pairings still held in the backlog are dropped first so that any being
+	// released at the same time have their game created before it is superseded
+	// below.
+	_, err := tx.Exec(`
+	UPDATE backlog_pairing
+	SET released_datetime = now()
+	WHERE id IN (
+	  SELECT bpb.backlog_pairing_id
+	  FROM bot b
+	  JOIN backlog_pairing_bot bpb
+	    ON b.id = bpb.bot_id
+	  WHERE b.name = $1
+	  AND b.id != $2
+	  AND ($3 = '' OR b.stage = $3)
+	)
+	AND released_datetime IS NULL
+	`, strings.Trim(name, " "), exceptBotId, string(stage))
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():1:\n%s\n", err)
-		return Bot{}, err
+		log.Printf("An error occurred in bot.supersedeBotVersions():1:\n%s\n", err)
+		return err
 	}
 
 	_, err = tx.Exec(`
 	UPDATE bot
 	SET status = $1
 	WHERE name = $2
-	`, string(BOT_STATUS_SUPERSEDED), name)
+	AND id != $3
+	AND ($4 = '' OR stage = $4)
+	`, string(BOT_STATUS_SUPERSEDED), strings.Trim(name, " "), exceptBotId, string(stage))
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():2:\n%s\n", err)
-		tx.Rollback()
-		return Bot{}, err
+		log.Printf("An error occurred in bot.supersedeBotVersions():2:\n%s\n", err)
+		return err
 	}
 
 	_, err = tx.Exec(`
@@ -584,13 +753,14 @@ func RegisterBot(name string, version string, gameType GameType, user User, rpcE
 	  JOIN game_bot gb
 	    ON b.id = gb.bot_id
 	  WHERE b.name = $2
+	  AND b.id != $3
+	  AND ($4 = '' OR b.stage = $4)
 	)
-	AND status != $3
-	`, string(GAME_STATUS_SUPERSEDED), strings.Trim(name, " "), string(GAME_STATUS_COMPLETE))
+	AND status != $5
+	`, string(GAME_STATUS_SUPERSEDED), strings.Trim(name, " "), exceptBotId, string(stage), string(GAME_STATUS_COMPLETE))
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():3:\n%s\n", err)
-		tx.Rollback()
-		return Bot{}, err
+		log.Printf("An error occurred in bot.supersedeBotVersions():3:\n%s\n", err)
+		return err
 	}
 
 	_, err = tx.Exec(`
@@ -604,16 +774,22 @@ func RegisterBot(name string, version string, gameType GameType, user User, rpcE
 	  JOIN game_bot gb2
 	    ON gb1.game_id = gb2.game_id
 	  WHERE b.name = $2
+	  AND b.id != $3
+	  AND ($4 = '' OR b.stage = $4)
 	)
-	AND status != $3
-	`, string(GAMEMOVE_STATUS_SUPERSEDED), strings.Trim(name, " "), string(GAMEMOVE_STATUS_COMPLETE))
+	AND status != $5
+	`, string(GAMEMOVE_STATUS_SUPERSEDED), strings.Trim(name, " "), exceptBotId, string(stage), string(GAMEMOVE_STATUS_COMPLETE))
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():4:\n%s\n", err)
-		tx.Rollback()
-		return Bot{}, err
+		log.Printf("An error occurred in bot.supersedeBotVersions():4:\n%s\n", err)
+		return err
 	}
 
-	err = tx.QueryRow(`
+	return nil
+}
+
+func insertBot(tx *Tx, name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string, stage BotStage) (int, error) {
+	var botId int
+	err := tx.QueryRow(`
 	INSERT INTO bot (
 	  name
 	, version
@@ -624,6 +800,7 @@ func RegisterBot(name string, version string, gameType GameType, user User, rpcE
 	, website
 	, description
 	, status
+	, stage
 	) VALUES (
 	  $1
 	, $2
@@ -634,10 +811,85 @@ func RegisterBot(name string, version string, gameType GameType, user User, rpcE
 	, $7
 	, $8
 	, $9
+	, $10
 	) RETURNING id
-	`, strings.Trim(name, " "), strings.Trim(version, " "), gameType.Id, user.Id, rpcEndpoint, programmingLanguage, website, strings.Trim(description, " "), string(BOT_STATUS_ONLINE)).Scan(&botId)
+	`, strings.Trim(name, " "), strings.Trim(version, " "), gameType.Id, user.Id, rpcEndpoint, programmingLanguage, website, strings.Trim(description, " "), string(BOT_STATUS_ONLINE), string(stage)).Scan(&botId)
+	if err != nil {
+		log.Printf("An error occurred in bot.insertBot():\n%s\n", err)
+		return 0, err
+	}
+
+	return botId, nil
+}
+
+func RegisterBot(name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string) (Bot, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in bot.RegisterBot():1:\n%s\n", err)
+		return Bot{}, err
+	}
+
+	err = supersedeBotVersions(tx, name, 0, "")
+	if err != nil {
+		log.Printf("An error occurred in bot.RegisterBot():2:\n%s\n", err)
+		tx.Rollback()
+		return Bot{}, err
+	}
+
+	botId, err := insertBot(tx, name, version, gameType, user, rpcEndpoint, programmingLanguage, website, description, BOT_STAGE_RANKED)
+	if err != nil {
+		log.Printf("An error occurred in bot.RegisterBot():3:\n%s\n", err)
+		tx.Rollback()
+		return Bot{}, err
+	}
+
+	tx.Commit()
+
+	bot, err := GetBotById(botId)
+	if err != nil {
+		log.Printf("An error occurred in bot.RegisterBot():4:\n%s\n", err)
+		return Bot{}, err
+	}
+
+	return bot, nil
+}
+
+// RegisterSandboxBot registers a new version of a bot in the sandbox. Unlike
+// RegisterBot the existing versions of the bot are left untouched and continue
+// to play ranked games until the sandbox version is promoted.
+func RegisterSandboxBot(name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string) (Bot, error) {
+	return registerUnrankedBot(name, version, gameType, user, rpcEndpoint, programmingLanguage, website, description, BOT_STAGE_SANDBOX)
+}
+
+// RegisterQualifyingBot registers a new version of a bot that must play a set of
+// qualification games before it replaces the current ranked version. The ranked
+// version continues to play as normal in the meantime.
+func RegisterQualifyingBot(name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string) (Bot, error) {
+	return registerUnrankedBot(name, version, gameType, user, rpcEndpoint, programmingLanguage, website, description, BOT_STAGE_QUALIFYING)
+}
+
+func registerUnrankedBot(name string, version string, gameType GameType, user User, rpcEndpoint string, programmingLanguage string, website string, description string, stage BotStage) (Bot, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():5:\n%s\n", err)
+		log.Printf("An error occurred in bot.registerUnrankedBot():1:\n%s\n", err)
+		return Bot{}, err
+	}
+
+	// Only one version of a bot may be in each unranked stage at any time.
+	err = supersedeBotVersions(tx, name, 0, stage)
+	if err != nil {
+		log.Printf("An error occurred in bot.registerUnrankedBot():2:\n%s\n", err)
+		tx.Rollback()
+		return Bot{}, err
+	}
+
+	botId, err := insertBot(tx, name, version, gameType, user, rpcEndpoint, programmingLanguage, website, description, stage)
+	if err != nil {
+		log.Printf("An error occurred in bot.registerUnrankedBot():3:\n%s\n", err)
 		tx.Rollback()
 		return Bot{}, err
 	}
@@ -646,16 +898,206 @@ func RegisterBot(name string, version string, gameType GameType, user User, rpcE
 
 	bot, err := GetBotById(botId)
 	if err != nil {
-		log.Printf("An error occurred in bot.RegisterBot():6:\n%s\n", err)
+		log.Printf("An error occurred in bot.registerUnrankedBot():4:\n%s\n", err)
 		return Bot{}, err
 	}
 
 	return bot, nil
 }
 
+// Promote moves a bot from the sandbox, or from qualification, into ranked play.
+// Every other version of the bot is superseded exactly as if this version had
+// just been registered. If the bot has been promoted since it was loaded, e.g.
+// by another worker node, ErrBotAlreadyPromoted is returned.
+func (b *Bot) Promote() error {
+	if b.Stage != BOT_STAGE_SANDBOX && b.Stage != BOT_STAGE_QUALIFYING {
+		return errors.New("Only bots in the sandbox or in qualification can be promoted.")
+	}
+
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in bot.Promote():1:\n%s\n", err)
+		return err
+	}
+
+	res, err := tx.Exec(`
+	UPDATE bot
+	SET stage = $1
+	WHERE id = $2
+	AND stage IN ($3, $4)
+	AND status != $5
+	`, string(BOT_STAGE_RANKED), b.Id, string(BOT_STAGE_SANDBOX), string(BOT_STAGE_QUALIFYING), string(BOT_STATUS_SUPERSEDED))
+	if err != nil {
+		log.Printf("An error occurred in bot.Promote():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	promoted, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("An error occurred in bot.Promote():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+	if promoted == 0 {
+		tx.Rollback()
+		return ErrBotAlreadyPromoted
+	}
+
+	err = supersedeBotVersions(tx, b.Name, b.Id, "")
+	if err != nil {
+		log.Printf("An error occurred in bot.Promote():4:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	tx.Commit()
+
+	b.Stage = BOT_STAGE_RANKED
+
+	return nil
+}
+
+// Discard retires a bot that failed to qualify. The bot and any of its games
+// that are still outstanding are superseded, and its pairings still held in the
+// backlog dropped, but its completed games are kept.
+func (b *Bot) Discard() error {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in bot.Discard():1:\n%s\n", err)
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE backlog_pairing
+	SET released_datetime = now()
+	WHERE id IN (
+	  SELECT backlog_pairing_id
+	  FROM backlog_pairing_bot
+	  WHERE bot_id = $1
+	)
+	AND released_datetime IS NULL
+	`, b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Discard():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE game
+	SET status = $1
+	WHERE id IN (
+	  SELECT game_id
+	  FROM game_bot
+	  WHERE bot_id = $2
+	)
+	AND status != $3
+	`, string(GAME_STATUS_SUPERSEDED), b.Id, string(GAME_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in bot.Discard():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE move
+	SET status = $1
+	WHERE game_bot_id IN (
+	  SELECT gb2.id
+	  FROM game_bot gb1
+	  JOIN game_bot gb2
+	    ON gb1.game_id = gb2.game_id
+	  WHERE gb1.bot_id = $2
+	)
+	AND status != $3
+	`, string(GAMEMOVE_STATUS_SUPERSEDED), b.Id, string(GAMEMOVE_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in bot.Discard():4:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE bot
+	SET
+	  status = $1
+	, stage = $2
+	WHERE id = $3
+	`, string(BOT_STATUS_SUPERSEDED), string(BOT_STAGE_DISCARDED), b.Id)
+	if err != nil {
+		log.Printf("An error occurred in bot.Discard():5:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	tx.Commit()
+
+	b.Status = BOT_STATUS_SUPERSEDED
+	b.Stage = BOT_STAGE_DISCARDED
+
+	return nil
+}
+
+// RecordForKind returns the results of this bot in games of the given kind
+// regardless of whether or not those games were rated.
+func (b *Bot) RecordForKind(kind GameKind) (GameRecord, error) {
+	var gr GameRecord
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT
+	  COUNT(CASE WHEN g.status = $1 THEN 1 END)
+	, COUNT(CASE WHEN g.status = $1 AND w.team = gb.team THEN 1 END)
+	, COUNT(CASE WHEN g.status = $1 AND w.team IS NULL THEN 1 END)
+	, COUNT(CASE WHEN g.status IN ($2, $3) THEN 1 END)
+	FROM game_bot gb
+	JOIN game g
+	  ON gb.game_id = g.id
+	 AND g.kind = $4
+	LEFT JOIN (
+	  SELECT
+	    gb2.game_id
+	  , gb2.team
+	  FROM move m
+	  JOIN game_bot gb2
+	    ON m.game_bot_id = gb2.id
+	  WHERE m.winner = TRUE
+	) w
+	  ON g.id = w.game_id
+	WHERE gb.bot_id = $5
+	`, string(GAME_STATUS_COMPLETE), string(GAME_STATUS_NOT_STARTED), string(GAME_STATUS_IN_PROGRESS), string(kind), b.Id).Scan(&gr.Played, &gr.Won, &gr.Drawn, &gr.Remaining)
+	if err != nil {
+		log.Printf("An error occurred in bot.RecordForKind():1:\n%s\n", err)
+		return GameRecord{}, err
+	}
+
+	// Games still held in the backlog haven't been created yet but are still to
+	// be played.
+	var backlog int
+	err = db.QueryRow(`
+	SELECT COUNT(DISTINCT bp.id)
+	FROM backlog_pairing bp
+	JOIN backlog_pairing_bot bpb
+	  ON bp.id = bpb.backlog_pairing_id
+	WHERE bp.released_datetime IS NULL
+	AND bp.kind = $1
+	AND bpb.bot_id = $2
+	`, string(kind), b.Id).Scan(&backlog)
+	if err != nil {
+		log.Printf("An error occurred in bot.RecordForKind():2:\n%s\n", err)
+		return GameRecord{}, err
+	}
+	gr.Remaining += backlog
+
+	return gr, nil
+}
+
 func GetBotById(id int) (Bot, error) {
 	var bot Bot
 	var status string
+	var stage string
 	db := GetDB()
 	err := db.QueryRow(`
 	SELECT
@@ -670,14 +1112,18 @@ func GetBotById(id int) (Bot, error) {
 	, description
 	, status
 	, last_online_datetime
+	, stage
+	, sandbox_opponent
+	, max_concurrency
 	FROM bot
 	WHERE id = $1
-	`, id).Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+	`, id).Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
 	if err != nil {
 		log.Printf("An error occurred in bot.GetBotById():\n%s\n", err)
 		return Bot{}, err
 	}
 	bot.Status = BotStatus(status)
+	bot.Stage = BotStage(stage)
 
 	return bot, nil
 }
@@ -685,6 +1131,7 @@ func GetBotById(id int) (Bot, error) {
 func GetBotByName(name string) (Bot, error) {
 	var bot Bot
 	var status string
+	var stage string
 	db := GetDB()
 	err := db.QueryRow(`
 	SELECT
@@ -699,10 +1146,17 @@ func GetBotByName(name string) (Bot, error) {
 	, description
 	, status
 	, last_online_datetime
+	, stage
+	, sandbox_opponent
+	, max_concurrency
 	FROM bot
 	WHERE name = $1
 	AND status != $2
-	`, name, string(BOT_STATUS_SUPERSEDED)).Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+	ORDER BY
+	  CASE stage WHEN $3 THEN 0 ELSE 1 END
+	, id DESC
+	LIMIT 1
+	`, name, string(BOT_STATUS_SUPERSEDED), string(BOT_STAGE_RANKED)).Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			log.Printf("An error occurred in bot.GetBotByName():\n%s\n", err)
@@ -710,6 +1164,7 @@ func GetBotByName(name string) (Bot, error) {
 		return Bot{}, err
 	}
 	bot.Status = BotStatus(status)
+	bot.Stage = BotStage(stage)
 
 	return bot, nil
 }
@@ -729,8 +1184,12 @@ func ListBotsByName(name string) ([]Bot, error) {
 	, description
 	, status
 	, last_online_datetime
+	, stage
+	, sandbox_opponent
+	, max_concurrency
 	FROM bot
 	WHERE name = $1
+	ORDER BY id
 	`, name)
 	if err != nil {
 		return []Bot{}, err
@@ -740,12 +1199,14 @@ func ListBotsByName(name string) ([]Bot, error) {
 	for rows.Next() {
 		var bot Bot
 		var status string
-		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
 		if err != nil {
 			log.Printf("An error occurred in bot.ListBotsForGameType():\n%s\n", err)
 			return botList, err
 		}
 		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
 		botList = append(botList, bot)
 	}
 
@@ -767,11 +1228,15 @@ func ListBotsForGameType(gameType GameType) ([]Bot, error) {
 	, b.description
 	, b.status
 	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
 	FROM bot b
 	WHERE b.game_type_id = $1
 	AND b.status != $2
+	AND b.stage = $3
 	ORDER BY b.name, b.version
-	`, gameType.Id, string(BOT_STATUS_SUPERSEDED))
+	`, gameType.Id, string(BOT_STATUS_SUPERSEDED), string(BOT_STAGE_RANKED))
 	if err != nil {
 		return []Bot{}, err
 	}
@@ -780,12 +1245,14 @@ func ListBotsForGameType(gameType GameType) ([]Bot, error) {
 	for rows.Next() {
 		var bot Bot
 		var status string
-		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
 		if err != nil {
 			log.Printf("An error occurred in bot.ListBotsForGameType():\n%s\n", err)
 			return botList, err
 		}
 		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
 		botList = append(botList, bot)
 	}
 
@@ -807,10 +1274,14 @@ func ListBots() ([]Bot, error) {
 	, b.description
 	, b.status
 	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
 	FROM bot b
 	WHERE status != $1
+	AND stage = $2
 	ORDER BY b.name, b.version
-	`, string(BOT_STATUS_SUPERSEDED))
+	`, string(BOT_STATUS_SUPERSEDED), string(BOT_STAGE_RANKED))
 	if err != nil {
 		log.Printf("An error occurred in bot.ListBots():1:\n%s\n", err)
 		return []Bot{}, err
@@ -820,12 +1291,244 @@ func ListBots() ([]Bot, error) {
 	for rows.Next() {
 		var bot Bot
 		var status string
-		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
 		if err != nil {
 			log.Printf("An error occurred in bot.ListBots():2:\n%s\n", err)
 			return botList, err
 		}
 		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
+		botList = append(botList, bot)
+	}
+
+	return botList, nil
+}
+
+// ListQualifyingBots lists every bot that is still qualifying.
+func ListQualifyingBots() ([]Bot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  b.id
+	, b.name
+	, b.version
+	, b.game_type_id
+	, b.user_id
+	, b.rpc_endpoint
+	, b.programming_language
+	, b.website
+	, b.description
+	, b.status
+	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
+	FROM bot b
+	WHERE b.stage = $1
+	AND b.status != $2
+	ORDER BY b.id
+	`, string(BOT_STAGE_QUALIFYING), string(BOT_STATUS_SUPERSEDED))
+	if err != nil {
+		log.Printf("An error occurred in bot.ListQualifyingBots():1:\n%s\n", err)
+		return []Bot{}, err
+	}
+
+	var botList []Bot
+	for rows.Next() {
+		var bot Bot
+		var status string
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
+		if err != nil {
+			log.Printf("An error occurred in bot.ListQualifyingBots():2:\n%s\n", err)
+			return botList, err
+		}
+		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
+		botList = append(botList, bot)
+	}
+
+	return botList, nil
+}
+
+// ListUnhealthyBots returns every bot, in any stage, that is suspect or offline.
+func ListUnhealthyBots() ([]Bot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  b.id
+	, b.name
+	, b.version
+	, b.game_type_id
+	, b.user_id
+	, b.rpc_endpoint
+	, b.programming_language
+	, b.website
+	, b.description
+	, b.status
+	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
+	FROM bot b
+	WHERE status IN ($1, $2)
+	ORDER BY b.rpc_endpoint, b.id
+	`, string(BOT_STATUS_SUSPECT), string(BOT_STATUS_OFFLINE))
+	if err != nil {
+		log.Printf("An error occurred in bot.ListUnhealthyBots():1:\n%s\n", err)
+		return []Bot{}, err
+	}
+
+	var botList []Bot
+	for rows.Next() {
+		var bot Bot
+		var status string
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
+		if err != nil {
+			log.Printf("An error occurred in bot.ListUnhealthyBots():2:\n%s\n", err)
+			return botList, err
+		}
+		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
+		botList = append(botList, bot)
+	}
+
+	return botList, nil
+}
+
+func GetBotByNameAndVersion(name string, version string) (Bot, error) {
+	var bot Bot
+	var status string
+	var stage string
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT
+	  id
+	, name
+	, version
+	, game_type_id
+	, user_id
+	, rpc_endpoint
+	, programming_language
+	, website
+	, description
+	, status
+	, last_online_datetime
+	, stage
+	, sandbox_opponent
+	, max_concurrency
+	FROM bot
+	WHERE name = $1
+	AND version = $2
+	`, strings.Trim(name, " "), strings.Trim(version, " ")).Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
+	if err != nil {
+		log.Printf("An error occurred in bot.GetBotByNameAndVersion():\n%s\n", err)
+		return Bot{}, err
+	}
+	bot.Status = BotStatus(status)
+	bot.Stage = BotStage(stage)
+
+	return bot, nil
+}
+
+func ListSandboxBots() ([]Bot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  b.id
+	, b.name
+	, b.version
+	, b.game_type_id
+	, b.user_id
+	, b.rpc_endpoint
+	, b.programming_language
+	, b.website
+	, b.description
+	, b.status
+	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
+	FROM bot b
+	WHERE status != $1
+	AND stage = $2
+	ORDER BY b.name, b.version
+	`, string(BOT_STATUS_SUPERSEDED), string(BOT_STAGE_SANDBOX))
+	if err != nil {
+		log.Printf("An error occurred in bot.ListSandboxBots():1:\n%s\n", err)
+		return []Bot{}, err
+	}
+
+	var botList []Bot
+	for rows.Next() {
+		var bot Bot
+		var status string
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
+		if err != nil {
+			log.Printf("An error occurred in bot.ListSandboxBots():2:\n%s\n", err)
+			return botList, err
+		}
+		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
+		botList = append(botList, bot)
+	}
+
+	return botList, nil
+}
+
+// ListSandboxOpponentsForGameType returns the ranked bots that sandbox bots may
+// play against. These are house bots (bots owned by an administrator) and bots
+// whose owners have opted them in as sandbox opponents.
+func ListSandboxOpponentsForGameType(gameType GameType) ([]Bot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  b.id
+	, b.name
+	, b.version
+	, b.game_type_id
+	, b.user_id
+	, b.rpc_endpoint
+	, b.programming_language
+	, b.website
+	, b.description
+	, b.status
+	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
+	, b.max_concurrency
+	FROM bot b
+	JOIN merknera_user mu
+	  ON b.user_id = mu.id
+	WHERE b.game_type_id = $1
+	AND b.status = $2
+	AND b.stage = $3
+	AND (
+	  b.sandbox_opponent = TRUE
+	  OR mu.admin = TRUE
+	)
+	ORDER BY b.name, b.version
+	`, gameType.Id, string(BOT_STATUS_ONLINE), string(BOT_STAGE_RANKED))
+	if err != nil {
+		log.Printf("An error occurred in bot.ListSandboxOpponentsForGameType():1:\n%s\n", err)
+		return []Bot{}, err
+	}
+
+	var botList []Bot
+	for rows.Next() {
+		var bot Bot
+		var status string
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent, &bot.MaxConcurrency)
+		if err != nil {
+			log.Printf("An error occurred in bot.ListSandboxOpponentsForGameType():2:\n%s\n", err)
+			return botList, err
+		}
+		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
 		botList = append(botList, bot)
 	}
 
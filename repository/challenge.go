@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"log"
+	"time"
+)
+
+type Challenge struct {
+	Id              int `json:"id"`
+	userId          int
+	challengerBotId int
+	opponentBotId   int
+	GameCount       int
+	Rated           bool
+	CreatedDateTime time.Time
+}
+
+func (c *Challenge) User() (User, error) {
+	return GetUserById(c.userId)
+}
+
+func (c *Challenge) ChallengerBot() (Bot, error) {
+	return GetBotById(c.challengerBotId)
+}
+
+func (c *Challenge) OpponentBot() (Bot, error) {
+	return GetBotById(c.opponentBotId)
+}
+
+// AddGame associates a game that was created to satisfy this challenge with
+// the challenge.
+func (c *Challenge) AddGame(game Game) error {
+	return game.setChallenge(GetDB(), *c)
+}
+
+func (c *Challenge) AddGameTx(tx *Tx, game Game) error {
+	return game.setChallenge(tx, *c)
+}
+
+func (c *Challenge) Games() ([]Game, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT id
+	FROM game
+	WHERE challenge_id = $1
+	ORDER BY id
+	`, c.Id)
+	if err != nil {
+		log.Printf("An error occurred in challenge.Games():1:\n%s\n", err)
+		return []Game{}, err
+	}
+
+	var gameIds []int
+	for rows.Next() {
+		var gameId int
+		err := rows.Scan(&gameId)
+		if err != nil {
+			log.Printf("An error occurred in challenge.Games():2:\n%s\n", err)
+			return []Game{}, err
+		}
+		gameIds = append(gameIds, gameId)
+	}
+
+	var gameList []Game
+	for _, id := range gameIds {
+		g, err := GetGameById(id)
+		if err != nil {
+			log.Printf("An error occurred in challenge.Games():3:\n%s\n", err)
+			return gameList, err
+		}
+		gameList = append(gameList, g)
+	}
+
+	return gameList, nil
+}
+
+func CreateChallenge(user User, challenger Bot, opponent Bot, gameCount int, rated bool) (Challenge, error) {
+	return createChallenge(GetDB(), user, challenger, opponent, gameCount, rated)
+}
+
+// CreateChallengeTx creates the challenge as part of the transaction, so that
+// it can be created along with its games and within the users rate limit.
+func CreateChallengeTx(tx *Tx, user User, challenger Bot, opponent Bot, gameCount int, rated bool) (Challenge, error) {
+	return createChallenge(tx, user, challenger, opponent, gameCount, rated)
+}
+
+func createChallenge(q querier, user User, challenger Bot, opponent Bot, gameCount int, rated bool) (Challenge, error) {
+	var challengeId int
+	err := q.QueryRow(`
+	INSERT INTO challenge (
+	  merknera_user_id
+	, challenger_bot_id
+	, opponent_bot_id
+	, game_count
+	, rated
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	, $4
+	, $5
+	) RETURNING id
+	`, user.Id, challenger.Id, opponent.Id, gameCount, rated).Scan(&challengeId)
+	if err != nil {
+		log.Printf("An error occurred in challenge.CreateChallenge():1:\n%s\n", err)
+		return Challenge{}, err
+	}
+
+	challenge, err := getChallengeById(q, challengeId)
+	if err != nil {
+		log.Printf("An error occurred in challenge.CreateChallenge():2:\n%s\n", err)
+		return Challenge{}, err
+	}
+	return challenge, nil
+}
+
+func GetChallengeById(id int) (Challenge, error) {
+	return getChallengeById(GetDB(), id)
+}
+
+func getChallengeById(q querier, id int) (Challenge, error) {
+	var c Challenge
+	err := q.QueryRow(`
+	SELECT
+	  id
+	, merknera_user_id
+	, challenger_bot_id
+	, opponent_bot_id
+	, game_count
+	, rated
+	, created_datetime
+	FROM challenge
+	WHERE id = $1
+	`, id).Scan(&c.Id, &c.userId, &c.challengerBotId, &c.opponentBotId, &c.GameCount, &c.Rated, &c.CreatedDateTime)
+	if err != nil {
+		log.Printf("An error occurred in challenge.GetChallengeById():\n%s\n", err)
+		return Challenge{}, err
+	}
+
+	return c, nil
+}
+
+// LockChallengesTx stops the user issuing any other challenge until the
+// transaction ends, so that concurrent challenges are counted one after another
+// against the users rate limit.
+func LockChallengesTx(tx *Tx, user User) error {
+	_, err := tx.Exec(`
+	SELECT pg_advisory_xact_lock($1, $2)
+	`, ADVISORY_LOCK_USER_CHALLENGE, user.Id)
+	if err != nil {
+		log.Printf("An error occurred in challenge.LockChallengesTx():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CountChallengesSince returns the number of challenges the user has issued
+// since the given time. This is used to rate-limit challenges.
+func CountChallengesSince(user User, since time.Time) (int, error) {
+	return countChallengesSince(GetDB(), user, since)
+}
+
+func CountChallengesSinceTx(tx *Tx, user User, since time.Time) (int, error) {
+	return countChallengesSince(tx, user, since)
+}
+
+func countChallengesSince(q querier, user User, since time.Time) (int, error) {
+	var count int
+	err := q.QueryRow(`
+	SELECT COUNT(*)
+	FROM challenge
+	WHERE merknera_user_id = $1
+	AND created_datetime >= $2
+	`, user.Id, since).Scan(&count)
+	if err != nil {
+		log.Printf("An error occurred in challenge.CountChallengesSince():\n%s\n", err)
+		return 0, err
+	}
+
+	return count, nil
+}
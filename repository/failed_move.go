@@ -0,0 +1,587 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// FailedMove records a move that could not be played. The move is left awaiting
+// play until the failure is resolved by retrying, skipping or abandoning it.
+type FailedMove struct {
+	Id               int
+	moveId           int
+	botId            int
+	Reason           FailedMoveReason
+	Error            sql.NullString
+	Attempts         int
+	LastResponse     sql.NullString
+	Status           FailedMoveStatus
+	resolvedByUserId sql.NullInt64
+	CreatedDateTime  time.Time
+	ResolvedDateTime pq.NullTime
+}
+
+type FailedMoveReason string
+
+const (
+	// The bot's response caused an error, e.g. it made an invalid move.
+	FAILED_MOVE_REASON_BOT_ERROR FailedMoveReason = "BOT_ERROR"
+	// The move was claimed by worker nodes more times than it is allowed
+	// attempts without being played.
+	FAILED_MOVE_REASON_LEASE_EXPIRED FailedMoveReason = "LEASE_EXPIRED"
+	// Merknera itself failed whilst playing the move.
+	FAILED_MOVE_REASON_INTERNAL FailedMoveReason = "INTERNAL"
+	// A superseded version couldn't be reached during a regression game. These
+	// versions are never brought back online so the move isn't queued again.
+	FAILED_MOVE_REASON_UNREACHABLE FailedMoveReason = "UNREACHABLE"
+)
+
+type FailedMoveStatus string
+
+const (
+	FAILED_MOVE_STATUS_OPEN FailedMoveStatus = "OPEN"
+	// The move was queued to be played again. Failures are also marked as
+	// retried when the move is eventually played.
+	FAILED_MOVE_STATUS_RETRIED FailedMoveStatus = "RETRIED"
+	// The bot forfeited the game.
+	FAILED_MOVE_STATUS_SKIPPED FailedMoveStatus = "SKIPPED"
+	// The game was abandoned without a result.
+	FAILED_MOVE_STATUS_ABANDONED FailedMoveStatus = "ABANDONED"
+)
+
+// The most of a bot's response that is kept with a failed move. Longer responses
+// are cut short.
+const MAX_LAST_RESPONSE_LENGTH = 10000
+
+// ErrFailedMoveResolved is returned when resolving a failure that has already
+// been resolved.
+var ErrFailedMoveResolved = errors.New("This failed move has already been resolved.")
+
+func (f *FailedMove) GameMove() (GameMove, error) {
+	return GetGameMoveById(f.moveId)
+}
+
+func (f *FailedMove) Bot() (Bot, error) {
+	return GetBotById(f.botId)
+}
+
+// ResolvedBy returns the user that resolved the failure. ok is false if the
+// failure is still open or was resolved by the move being played.
+func (f *FailedMove) ResolvedBy() (user User, ok bool, err error) {
+	if !f.resolvedByUserId.Valid {
+		return User{}, false, nil
+	}
+
+	user, err = GetUserById(int(f.resolvedByUserId.Int64))
+	if err != nil {
+		return User{}, false, err
+	}
+
+	return user, true, nil
+}
+
+// RecordFailedMove records that the move, played under the job, couldn't be
+// played by the bot. If the move already has an open failure it is updated
+// with the latest error. If the job is no longer leased to the worker node that
+// played the move ErrMoveJobLeaseLost is returned and nothing is recorded, the
+// move being left to the node that now holds it.
+func RecordFailedMove(job MoveJob, gm GameMove, bot Bot, reason FailedMoveReason, cause error, lastResponse string) error {
+	var errorMessage sql.NullString
+	if cause != nil {
+		errorMessage = sql.NullString{String: truncate(sanitizeText(cause.Error()), 1000), Valid: true}
+	}
+
+	var response sql.NullString
+	if lastResponse != "" {
+		// The response comes straight from the bot so may be any size and
+		// contain bytes that can't be stored.
+		lastResponse = truncate(sanitizeText(lastResponse), MAX_LAST_RESPONSE_LENGTH)
+		response = sql.NullString{String: lastResponse, Valid: true}
+	}
+
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.RecordFailedMove():1:\n%s\n", err)
+		return err
+	}
+
+	err = job.lockLease(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO failed_move (
+	  move_id
+	, bot_id
+	, reason
+	, error
+	, attempts
+	, last_response
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	, $4
+	, $5
+	, $6
+	)
+	ON CONFLICT (move_id) WHERE status = 'OPEN' DO UPDATE
+	SET
+	  reason = EXCLUDED.reason
+	, error = EXCLUDED.error
+	, attempts = EXCLUDED.attempts
+	, last_response = EXCLUDED.last_response
+	`, gm.Id, bot.Id, string(reason), errorMessage, job.Attempts, response)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.RecordFailedMove():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.RecordFailedMove():3:\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// resolveFailedMoves marks any open failure of the move as resolved.
+func resolveFailedMoves(q querier, moveId int, status FailedMoveStatus, user *User) error {
+	var userId sql.NullInt64
+	if user != nil {
+		userId = sql.NullInt64{Int64: int64(user.Id), Valid: true}
+	}
+
+	_, err := q.Exec(`
+	UPDATE failed_move
+	SET
+	  status = $1
+	, resolved_by_user_id = $2
+	, resolved_datetime = now()
+	WHERE move_id = $3
+	AND status = $4
+	`, string(status), userId, moveId, string(FAILED_MOVE_STATUS_OPEN))
+	if err != nil {
+		log.Printf("An error occurred in failed_move.resolveFailedMoves():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// beginResolve starts the transaction that resolves the failure, locking the
+// move and checking that the failure is still open and the move still awaiting
+// play.
+func (f *FailedMove) beginResolve() (*Tx, error) {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var status string
+	var moveStatus string
+	err = tx.QueryRow(`
+	SELECT
+	  fm.status
+	, m.status
+	FROM failed_move fm
+	JOIN move m
+	  ON fm.move_id = m.id
+	WHERE fm.id = $1
+	FOR UPDATE
+	`, f.Id).Scan(&status, &moveStatus)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if FailedMoveStatus(status) != FAILED_MOVE_STATUS_OPEN || GameMoveStatus(moveStatus) != GAMEMOVE_STATUS_AWAITING {
+		tx.Rollback()
+		return nil, ErrFailedMoveResolved
+	}
+
+	return tx, nil
+}
+
+// Retry queues the move to be played again.
+func (f *FailedMove) Retry(user User) error {
+	tx, err := f.beginResolve()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Retry():1:\n%s\n", err)
+		return err
+	}
+
+	// A failed job would stop the move being queued again.
+	_, err = tx.Exec(`
+	DELETE FROM move_job
+	WHERE move_id = $1
+	AND status = $2
+	`, f.moveId, string(MOVE_JOB_STATUS_FAILED))
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Retry():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = EnqueueGameMoveTx(tx, GameMove{Id: f.moveId})
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Retry():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = resolveFailedMoves(tx, f.moveId, FAILED_MOVE_STATUS_RETRIED, &user)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Retry():4:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Retry():5:\n%s\n", err)
+		return err
+	}
+
+	f.Status = FAILED_MOVE_STATUS_RETRIED
+
+	return nil
+}
+
+// Skip forfeits the game for the bot whose move failed. The failed move is
+// completed and a winning move is recorded for the given player, copying the
+// game state so that the game reads as having ended there. The game is rated
+// with rate, if given, as part of the same transaction.
+func (f *FailedMove) Skip(user User, winner GameBot, rate RateFunc) error {
+	tx, err := f.beginResolve()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Skip():1:\n%s\n", err)
+		return err
+	}
+
+	gm := GameMove{Id: f.moveId}
+	err = gm.MarkCompleteTx(tx)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Skip():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO move (
+	  game_bot_id
+	, game_state
+	, status
+	, winner
+	, start_datetime
+	, end_datetime
+	)
+	SELECT
+	  $1
+	, m.game_state
+	, $2
+	, TRUE
+	, now()
+	, now()
+	FROM move m
+	WHERE m.id = $3
+	`, winner.Id, string(GAMEMOVE_STATUS_COMPLETE), f.moveId)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Skip():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE game
+	SET status = $1
+	WHERE id = (
+	  SELECT gb.game_id
+	  FROM move m
+	  JOIN game_bot gb
+	    ON m.game_bot_id = gb.id
+	  WHERE m.id = $2
+	)
+	`, string(GAME_STATUS_COMPLETE), f.moveId)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Skip():4:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	if rate != nil {
+		err = rate(tx)
+		if err != nil {
+			log.Printf("An error occurred in failed_move.Skip():5:\n%s\n", err)
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = f.finishResolve(tx, FAILED_MOVE_STATUS_SKIPPED, user)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Skip():6:\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Abandon supersedes the game, leaving it without a result.
+func (f *FailedMove) Abandon(user User) error {
+	tx, err := f.beginResolve()
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Abandon():1:\n%s\n", err)
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE game
+	SET status = $1
+	WHERE id = (
+	  SELECT gb.game_id
+	  FROM move m
+	  JOIN game_bot gb
+	    ON m.game_bot_id = gb.id
+	  WHERE m.id = $2
+	)
+	`, string(GAME_STATUS_SUPERSEDED), f.moveId)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Abandon():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE move
+	SET status = $1
+	WHERE game_bot_id IN (
+	  SELECT gb2.id
+	  FROM move m
+	  JOIN game_bot gb1
+	    ON m.game_bot_id = gb1.id
+	  JOIN game_bot gb2
+	    ON gb1.game_id = gb2.game_id
+	  WHERE m.id = $2
+	)
+	AND status != $3
+	`, string(GAMEMOVE_STATUS_SUPERSEDED), f.moveId, string(GAMEMOVE_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Abandon():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = f.finishResolve(tx, FAILED_MOVE_STATUS_ABANDONED, user)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.Abandon():4:\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// finishResolve removes any job for the move, marks the failure as resolved and
+// commits the transaction. The transaction is rolled back if anything fails.
+func (f *FailedMove) finishResolve(tx *Tx, status FailedMoveStatus, user User) error {
+	_, err := tx.Exec(`
+	DELETE FROM move_job
+	WHERE move_id = $1
+	`, f.moveId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = resolveFailedMoves(tx, f.moveId, status, &user)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	f.Status = status
+
+	return nil
+}
+
+func GetFailedMoveById(id int) (FailedMove, error) {
+	var f FailedMove
+	var reason string
+	var status string
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT
+	  id
+	, move_id
+	, bot_id
+	, reason
+	, error
+	, attempts
+	, last_response
+	, status
+	, resolved_by_user_id
+	, created_datetime
+	, resolved_datetime
+	FROM failed_move
+	WHERE id = $1
+	`, id).Scan(&f.Id, &f.moveId, &f.botId, &reason, &f.Error, &f.Attempts, &f.LastResponse, &status, &f.resolvedByUserId, &f.CreatedDateTime, &f.ResolvedDateTime)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.GetFailedMoveById():\n%s\n", err)
+		return FailedMove{}, err
+	}
+	f.Reason = FailedMoveReason(reason)
+	f.Status = FailedMoveStatus(status)
+
+	return f, nil
+}
+
+// FailedMoves returns every failure recorded for the move, most recent first.
+func (gm *GameMove) FailedMoves() ([]FailedMove, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  id
+	, move_id
+	, bot_id
+	, reason
+	, error
+	, attempts
+	, last_response
+	, status
+	, resolved_by_user_id
+	, created_datetime
+	, resolved_datetime
+	FROM failed_move
+	WHERE move_id = $1
+	ORDER BY id DESC
+	`, gm.Id)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.FailedMoves():1:\n%s\n", err)
+		return []FailedMove{}, err
+	}
+	defer rows.Close()
+
+	var failedList []FailedMove
+	for rows.Next() {
+		var f FailedMove
+		var reason string
+		var status string
+		err := rows.Scan(&f.Id, &f.moveId, &f.botId, &reason, &f.Error, &f.Attempts, &f.LastResponse, &status, &f.resolvedByUserId, &f.CreatedDateTime, &f.ResolvedDateTime)
+		if err != nil {
+			log.Printf("An error occurred in failed_move.FailedMoves():2:\n%s\n", err)
+			return failedList, err
+		}
+		f.Reason = FailedMoveReason(reason)
+		f.Status = FailedMoveStatus(status)
+		failedList = append(failedList, f)
+	}
+
+	return failedList, nil
+}
+
+// StuckGame is an unfinished game whose next move is awaiting play but isn't
+// queued, so the game won't progress without help.
+type StuckGame struct {
+	gameId   int
+	moveId   int
+	botId    int
+	failedId sql.NullInt64
+	// When the move got stuck: when it failed if it has an open failure,
+	// otherwise when it was last started or created.
+	SinceDateTime time.Time
+}
+
+func (s *StuckGame) Game() (Game, error) {
+	return GetGameById(s.gameId)
+}
+
+func (s *StuckGame) GameMove() (GameMove, error) {
+	return GetGameMoveById(s.moveId)
+}
+
+func (s *StuckGame) Bot() (Bot, error) {
+	return GetBotById(s.botId)
+}
+
+// FailedMove returns the open failure of the stuck move. ok is false if the move
+// hasn't failed, e.g. because its bot is offline.
+func (s *StuckGame) FailedMove() (f FailedMove, ok bool, err error) {
+	if !s.failedId.Valid {
+		return FailedMove{}, false, nil
+	}
+
+	f, err = GetFailedMoveById(int(s.failedId.Int64))
+	if err != nil {
+		return FailedMove{}, false, err
+	}
+
+	return f, true, nil
+}
+
+// ListStuckGames lists the unfinished games whose awaiting move has no job, or
+// a failed job. If userId is not 0 only games stuck on one of that user's bots
+// are listed.
+func ListStuckGames(userId int) ([]StuckGame, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  g.id
+	, m.id
+	, gb.bot_id
+	, fm.id
+	, COALESCE(fm.created_datetime, m.start_datetime, m.created_datetime)
+	FROM move m
+	JOIN game_bot gb
+	  ON m.game_bot_id = gb.id
+	JOIN game g
+	  ON gb.game_id = g.id
+	JOIN bot b
+	  ON gb.bot_id = b.id
+	LEFT JOIN move_job mj
+	  ON m.id = mj.move_id
+	LEFT JOIN failed_move fm
+	  ON m.id = fm.move_id
+	 AND fm.status = $1
+	WHERE m.status = $2
+	AND g.status IN ($3, $4)
+	AND (
+	  mj.id IS NULL
+	  OR mj.status = $5
+	)
+	AND ($6 = 0 OR b.user_id = $6)
+	ORDER BY 5
+	`, string(FAILED_MOVE_STATUS_OPEN), string(GAMEMOVE_STATUS_AWAITING), string(GAME_STATUS_NOT_STARTED), string(GAME_STATUS_IN_PROGRESS), string(MOVE_JOB_STATUS_FAILED), userId)
+	if err != nil {
+		log.Printf("An error occurred in failed_move.ListStuckGames():1:\n%s\n", err)
+		return []StuckGame{}, err
+	}
+	defer rows.Close()
+
+	var stuckList []StuckGame
+	for rows.Next() {
+		var s StuckGame
+		err := rows.Scan(&s.gameId, &s.moveId, &s.botId, &s.failedId, &s.SinceDateTime)
+		if err != nil {
+			log.Printf("An error occurred in failed_move.ListStuckGames():2:\n%s\n", err)
+			return stuckList, err
+		}
+		stuckList = append(stuckList, s)
+	}
+
+	return stuckList, nil
+}
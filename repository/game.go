@@ -8,11 +8,16 @@ import (
 
 type GameStatus string
 
+type GameKind string
+
 type Game struct {
-	Id         int
-	gameTypeId int
-	gameType   GameType
-	Status     GameStatus
+	Id          int
+	gameTypeId  int
+	gameType    GameType
+	Status      GameStatus
+	Kind        GameKind
+	Rated       bool
+	challengeId sql.NullInt64
 }
 
 const (
@@ -22,6 +27,14 @@ const (
 	GAME_STATUS_SUPERSEDED  GameStatus = "SUPERSEDED"
 )
 
+const (
+	GAME_KIND_LADDER        GameKind = "LADDER"
+	GAME_KIND_CHALLENGE     GameKind = "CHALLENGE"
+	GAME_KIND_SANDBOX       GameKind = "SANDBOX"
+	GAME_KIND_QUALIFICATION GameKind = "QUALIFICATION"
+	GAME_KIND_REGRESSION    GameKind = "REGRESSION"
+)
+
 func (g *Game) GameType() (GameType, error) {
 	if g.gameType == (GameType{}) {
 		gt, err := GetGameTypeById(g.gameTypeId)
@@ -123,6 +136,34 @@ func (g *Game) WinningMove() (GameMove, error) {
 	return gameMove, nil
 }
 
+// WinningTeam returns the team of the bot that made the winning move, every bot
+// on that team having won the game. If the game was a draw 0 is returned.
+func (g *Game) WinningTeam() (int, error) {
+	if g.Status != GAME_STATUS_COMPLETE {
+		return 0, errors.New("This game is not yet complete. You should not call WinningTeam() on an incomplete game.")
+	}
+	db := GetDB()
+	var team int
+	err := db.QueryRow(`
+	SELECT
+	  gb.team
+	FROM game_bot gb
+	JOIN move m
+	  ON gb.id = m.game_bot_id
+	 AND m.winner = TRUE
+	WHERE gb.game_id = $1
+	`, g.Id).Scan(&team)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		log.Printf("An error occurred in game.WinningTeam():\n%s\n", err)
+		return 0, err
+	}
+
+	return team, nil
+}
+
 func (g *Game) Players() ([]GameBot, error) {
 	db := GetDB()
 	rows, err := db.Query(`
@@ -171,8 +212,11 @@ func (g *Game) GameState() (string, error) {
 }
 
 func (g *Game) setStatus(status GameStatus) error {
-	db := GetDB()
-	_, err := db.Exec(`
+	return g.setStatusWith(GetDB(), status)
+}
+
+func (g *Game) setStatusWith(q querier, status GameStatus) error {
+	_, err := q.Exec(`
 	UPDATE game
 	SET status = $1
 	WHERE id = $2
@@ -194,6 +238,11 @@ func (g *Game) MarkComplete() error {
 	return g.setStatus(GAME_STATUS_COMPLETE)
 }
 
+// MarkCompleteTx marks the game as complete as part of the transaction.
+func (g *Game) MarkCompleteTx(tx *Tx) error {
+	return g.setStatusWith(tx, GAME_STATUS_COMPLETE)
+}
+
 func (g *Game) Moves() ([]GameMove, error) {
 	db := GetDB()
 	rows, err := db.Query(`
@@ -231,23 +280,67 @@ func (g *Game) Moves() ([]GameMove, error) {
 	return gameMoves, nil
 }
 
-func CreateGame(gameType GameType) (Game, error) {
-	var gameId int
+// Challenge returns the challenge that requested this game. Only games of kind
+// CHALLENGE have a challenge, for all other games the zero-value is returned.
+func (g *Game) Challenge() (Challenge, error) {
+	if !g.challengeId.Valid {
+		return Challenge{}, nil
+	}
 
-	db := GetDB()
-	err := db.QueryRow(`
+	c, err := GetChallengeById(int(g.challengeId.Int64))
+	if err != nil {
+		log.Printf("An error occurred in game.Challenge():\n%s\n", err)
+		return Challenge{}, err
+	}
+
+	return c, nil
+}
+
+func (g *Game) setChallenge(q querier, c Challenge) error {
+	_, err := q.Exec(`
+	UPDATE game
+	SET challenge_id = $1
+	WHERE id = $2
+	`, c.Id, g.Id)
+	if err != nil {
+		log.Printf("An error occurred in game.setChallenge():\n%s\n", err)
+		return err
+	}
+
+	g.challengeId = sql.NullInt64{Int64: int64(c.Id), Valid: true}
+
+	return nil
+}
+
+func CreateGame(gameType GameType, kind GameKind, rated bool) (Game, error) {
+	return createGame(GetDB(), gameType, kind, rated)
+}
+
+// CreateGameTx creates a game as part of the transaction. The game isn't
+// visible to anything else until the transaction is committed.
+func CreateGameTx(tx *Tx, gameType GameType, kind GameKind, rated bool) (Game, error) {
+	return createGame(tx, gameType, kind, rated)
+}
+
+func createGame(q querier, gameType GameType, kind GameKind, rated bool) (Game, error) {
+	var gameId int
+	err := q.QueryRow(`
 	INSERT INTO game (
 	  game_type_id
+	, kind
+	, rated
 	) VALUES (
 	  $1
+	, $2
+	, $3
 	) RETURNING id
-	`, gameType.Id).Scan(&gameId)
+	`, gameType.Id, string(kind), rated).Scan(&gameId)
 	if err != nil {
 		log.Printf("An error occurred in game.CreateGame():2:\n%s\n", err)
 		return Game{}, err
 	}
 
-	game, err := GetGameById(gameId)
+	game, err := getGameById(q, gameId)
 	if err != nil {
 		log.Printf("An error occurred in game.CreateGame():3:\n%s\n", err)
 		return game, err
@@ -256,26 +349,36 @@ func CreateGame(gameType GameType) (Game, error) {
 }
 
 func GetGameById(id int) (Game, error) {
+	return getGameById(GetDB(), id)
+}
+
+func getGameById(q querier, id int) (Game, error) {
 	var game Game
 	var status string
-	db := GetDB()
-	err := db.QueryRow(`
+	var kind string
+	err := q.QueryRow(`
 	SELECT
 	  g.id
 	, g.status
 	, g.game_type_id
+	, g.kind
+	, g.rated
+	, g.challenge_id
 	FROM game g
 	WHERE g.id = $1
-	`, id).Scan(&game.Id, &status, &game.gameTypeId)
+	`, id).Scan(&game.Id, &status, &game.gameTypeId, &kind, &game.Rated, &game.challengeId)
 	if err != nil {
 		log.Printf("An error occurred in game.GetGameById():\n%s\n", err)
 		return Game{}, err
 	}
 	game.Status = GameStatus(status)
+	game.Kind = GameKind(kind)
 
 	return game, nil
 }
 
+// ListGames returns all current games with the exception of sandbox and
+// regression games which are only listed by ListGamesByKind.
 func ListGames() ([]Game, error) {
 	db := GetDB()
 	rows, err := db.Query(`
@@ -283,11 +386,15 @@ func ListGames() ([]Game, error) {
 	  g.id
 	, g.game_type_id
 	, g.status
+	, g.kind
+	, g.rated
+	, g.challenge_id
 	FROM game g
 	WHERE g.status != $1
+	AND g.kind NOT IN ($2, $3)
 	ORDER BY
 	g.status
-	`, string(GAME_STATUS_SUPERSEDED))
+	`, string(GAME_STATUS_SUPERSEDED), string(GAME_KIND_SANDBOX), string(GAME_KIND_REGRESSION))
 	if err != nil {
 		log.Printf("An error occurred in game.ListGames():1:\n%s\n", err)
 		return []Game{}, err
@@ -297,14 +404,73 @@ func ListGames() ([]Game, error) {
 	for rows.Next() {
 		var game Game
 		var status string
-		err := rows.Scan(&game.Id, &game.gameTypeId, &status)
+		var kind string
+		err := rows.Scan(&game.Id, &game.gameTypeId, &status, &kind, &game.Rated, &game.challengeId)
 		if err != nil {
 			log.Printf("An error occurred in game.ListGames():2:\n%s\n", err)
 			return gameList, err
 		}
 		game.Status = GameStatus(status)
+		game.Kind = GameKind(kind)
+		gameList = append(gameList, game)
+	}
+
+	return gameList, nil
+}
+
+func ListGamesByKind(kind GameKind) ([]Game, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  g.id
+	, g.game_type_id
+	, g.status
+	, g.kind
+	, g.rated
+	, g.challenge_id
+	FROM game g
+	WHERE g.status != $1
+	AND g.kind = $2
+	ORDER BY
+	g.status
+	`, string(GAME_STATUS_SUPERSEDED), string(kind))
+	if err != nil {
+		log.Printf("An error occurred in game.ListGamesByKind():1:\n%s\n", err)
+		return []Game{}, err
+	}
+
+	var gameList []Game
+	for rows.Next() {
+		var game Game
+		var status string
+		var gameKind string
+		err := rows.Scan(&game.Id, &game.gameTypeId, &status, &gameKind, &game.Rated, &game.challengeId)
+		if err != nil {
+			log.Printf("An error occurred in game.ListGamesByKind():2:\n%s\n", err)
+			return gameList, err
+		}
+		game.Status = GameStatus(status)
+		game.Kind = GameKind(gameKind)
 		gameList = append(gameList, game)
 	}
 
 	return gameList, nil
 }
+
+// CountActiveGames returns the number of games that have been scheduled but are
+// not yet complete.
+func CountActiveGames() (int, error) {
+	var count int
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT COUNT(*)
+	FROM game
+	WHERE status IN ($1, $2)
+	`, string(GAME_STATUS_NOT_STARTED), string(GAME_STATUS_IN_PROGRESS)).Scan(&count)
+	if err != nil {
+		log.Printf("An error occurred in game.CountActiveGames():\n%s\n", err)
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "math"
+
+// GameRecord is a summary of the results of a bot over a set of games.
+type GameRecord struct {
+	Played    int
+	Won       int
+	Drawn     int
+	Remaining int
+}
+
+func (gr GameRecord) Lost() int {
+	return gr.Played - gr.Won - gr.Drawn
+}
+
+// Score is calculated in the same way as Bot.CurrentScore, that is the
+// percentage of played games that were won or drawn.
+func (gr GameRecord) Score() float64 {
+	if gr.Played == 0 {
+		return 0
+	}
+
+	score := ((float64(gr.Won) + float64(gr.Drawn)) / float64(gr.Played)) * 100.0
+
+	shift := math.Pow(10, float64(2))
+	return math.Floor((score*shift)+.5) / shift
+}
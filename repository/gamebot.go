@@ -9,6 +9,9 @@ type GameBot struct {
 	botId        int
 	bot          Bot
 	PlaySequence int
+	// Bots with the same team in a game play on the same side and share the
+	// result. Without teams every bot is on its own team.
+	Team int
 }
 
 func (gb *GameBot) Game() (Game, error) {
@@ -37,45 +40,106 @@ func (gb *GameBot) Bot() (Bot, error) {
 	return gb.bot, nil
 }
 
+// CreateGameBot adds a bot to a game on a team of its own.
 func CreateGameBot(game Game, bot Bot, sequence int) (GameBot, error) {
+	return CreateTeamGameBot(game, bot, sequence, sequence)
+}
+
+// CreateGameBotTx adds a bot to a game on a team of its own as part of the
+// transaction.
+func CreateGameBotTx(tx *Tx, game Game, bot Bot, sequence int) (GameBot, error) {
+	return createTeamGameBot(tx, game, bot, sequence, sequence)
+}
+
+func CreateTeamGameBot(game Game, bot Bot, sequence int, team int) (GameBot, error) {
+	return createTeamGameBot(GetDB(), game, bot, sequence, team)
+}
+
+// CreateTeamGameBotTx adds a bot to a team in a game as part of the
+// transaction.
+func CreateTeamGameBotTx(tx *Tx, game Game, bot Bot, sequence int, team int) (GameBot, error) {
+	return createTeamGameBot(tx, game, bot, sequence, team)
+}
+
+func createTeamGameBot(q querier, game Game, bot Bot, sequence int, team int) (GameBot, error) {
 	var gameBotId int
-	db := GetDB()
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 	INSERT INTO game_bot (
 	  game_id
 	, bot_id
 	, play_sequence
+	, team
 	) VALUES (
 	  $1
 	, $2
 	, $3
+	, $4
 	) RETURNING id
-	`, game.Id, bot.Id, sequence).Scan(&gameBotId)
+	`, game.Id, bot.Id, sequence, team).Scan(&gameBotId)
 	if err != nil {
-		log.Printf("An error occurred in gamebot.CreateGameBot():1:\n%s\n", err)
+		log.Printf("An error occurred in gamebot.CreateTeamGameBot():1:\n%s\n", err)
 		return GameBot{}, err
 	}
 
-	gameBot, err := GetGameBotById(gameBotId)
+	gameBot, err := getGameBotById(q, gameBotId)
 	if err != nil {
-		log.Printf("An error occurred in gamebot.CreateGameBot():2:\n%s\n", err)
+		log.Printf("An error occurred in gamebot.CreateTeamGameBot():2:\n%s\n", err)
 		return GameBot{}, err
 	}
 	return gameBot, nil
 }
 
+// Teammates returns the other bots on the same team in this game.
+func (gb *GameBot) Teammates() ([]GameBot, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  gb.id
+	, gb.play_sequence
+	, gb.game_id
+	, gb.bot_id
+	, gb.team
+	FROM game_bot gb
+	WHERE gb.game_id = $1
+	AND gb.team = $2
+	AND gb.id != $3
+	ORDER BY gb.play_sequence
+	`, gb.gameId, gb.Team, gb.Id)
+	if err != nil {
+		log.Printf("An error occurred in gamebot.Teammates():1:\n%s\n", err)
+		return []GameBot{}, err
+	}
+
+	var teammates []GameBot
+	for rows.Next() {
+		var gameBot GameBot
+		err := rows.Scan(&gameBot.Id, &gameBot.PlaySequence, &gameBot.gameId, &gameBot.botId, &gameBot.Team)
+		if err != nil {
+			log.Printf("An error occurred in gamebot.Teammates():2:\n%s\n", err)
+			return teammates, err
+		}
+		teammates = append(teammates, gameBot)
+	}
+
+	return teammates, nil
+}
+
 func GetGameBotById(id int) (GameBot, error) {
+	return getGameBotById(GetDB(), id)
+}
+
+func getGameBotById(q querier, id int) (GameBot, error) {
 	var gameBot GameBot
-	db := GetDB()
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 	SELECT
 	  gb.id
 	, gb.play_sequence
 	, gb.game_id
 	, gb.bot_id
+	, gb.team
 	FROM game_bot gb
 	WHERE gb.id = $1
-	`, id).Scan(&gameBot.Id, &gameBot.PlaySequence, &gameBot.gameId, &gameBot.botId)
+	`, id).Scan(&gameBot.Id, &gameBot.PlaySequence, &gameBot.gameId, &gameBot.botId, &gameBot.Team)
 	if err != nil {
 		log.Printf("An error occurred in gamebot.GetGameBotById():\n%s\n", err)
 		return GameBot{}, err
@@ -75,8 +75,16 @@ func (gm *GameMove) SetEndDateTime() error {
 }
 
 func (gm *GameMove) MarkComplete() error {
-	db := GetDB()
-	_, err := db.Exec(`
+	return gm.markComplete(GetDB())
+}
+
+// MarkCompleteTx marks the move as complete as part of the transaction.
+func (gm *GameMove) MarkCompleteTx(tx *Tx) error {
+	return gm.markComplete(tx)
+}
+
+func (gm *GameMove) markComplete(q querier) error {
+	_, err := q.Exec(`
 	UPDATE move
 	SET
 	  status = $1
@@ -88,6 +96,8 @@ func (gm *GameMove) MarkComplete() error {
 		return err
 	}
 
+	gm.Status = GAMEMOVE_STATUS_COMPLETE
+
 	return nil
 }
 
@@ -108,8 +118,16 @@ func (gm *GameMove) MarkSuperseded() error {
 }
 
 func (gm *GameMove) MarkAsWin() error {
-	db := GetDB()
-	_, err := db.Exec(`
+	return gm.markAsWin(GetDB())
+}
+
+// MarkAsWinTx marks the move as the winning move as part of the transaction.
+func (gm *GameMove) MarkAsWinTx(tx *Tx) error {
+	return gm.markAsWin(tx)
+}
+
+func (gm *GameMove) markAsWin(q querier) error {
+	_, err := q.Exec(`
 	UPDATE move
 	SET winner = true
 	WHERE id = $1
@@ -125,14 +143,23 @@ func (gm *GameMove) MarkAsWin() error {
 }
 
 func (gm *GameMove) SetGameState(gs interface{}) error {
+	return gm.setGameState(GetDB(), gs)
+}
+
+// SetGameStateTx stores the game state following the move as part of the
+// transaction.
+func (gm *GameMove) SetGameStateTx(tx *Tx, gs interface{}) error {
+	return gm.setGameState(tx, gs)
+}
+
+func (gm *GameMove) setGameState(q querier, gs interface{}) error {
 	gsB, err := json.Marshal(gs)
 	if err != nil {
 		log.Printf("An error occurred in gamemove.SetGameState():1:\n%s\n", err)
 		return err
 	}
 
-	db := GetDB()
-	_, err = db.Exec(`
+	_, err = q.Exec(`
 	UPDATE move
 	SET game_state = $1
 	WHERE id = $2
@@ -163,6 +190,17 @@ func (gm *GameMove) GameState() (string, error) {
 }
 
 func CreateGameMove(gameBot GameBot, currentGameState interface{}) (GameMove, error) {
+	return createGameMove(GetDB(), gameBot, currentGameState)
+}
+
+// CreateGameMoveTx creates the next move for the game bot as part of the
+// transaction. The move isn't visible to anything else until the transaction is
+// committed.
+func CreateGameMoveTx(tx *Tx, gameBot GameBot, currentGameState interface{}) (GameMove, error) {
+	return createGameMove(tx, gameBot, currentGameState)
+}
+
+func createGameMove(q querier, gameBot GameBot, currentGameState interface{}) (GameMove, error) {
 	gsB, err := json.Marshal(currentGameState)
 	if err != nil {
 		log.Printf("An error occurred in gamemove.CreateGameMove():1:\n%s\n", err)
@@ -170,8 +208,7 @@ func CreateGameMove(gameBot GameBot, currentGameState interface{}) (GameMove, er
 	}
 
 	var gameMoveId int
-	db := GetDB()
-	err = db.QueryRow(`
+	err = q.QueryRow(`
 	INSERT INTO move (
 	  game_bot_id
 	, game_state
@@ -185,7 +222,7 @@ func CreateGameMove(gameBot GameBot, currentGameState interface{}) (GameMove, er
 		return GameMove{}, err
 	}
 
-	gameMove, err := GetGameMoveById(gameMoveId)
+	gameMove, err := getGameMoveById(q, gameMoveId)
 	if err != nil {
 		log.Printf("An error occurred in gamemove.CreateGameMove():3:\n%s\n", err)
 		return GameMove{}, err
@@ -194,10 +231,13 @@ func CreateGameMove(gameBot GameBot, currentGameState interface{}) (GameMove, er
 }
 
 func GetGameMoveById(id int) (GameMove, error) {
+	return getGameMoveById(GetDB(), id)
+}
+
+func getGameMoveById(q querier, id int) (GameMove, error) {
 	var gameMove GameMove
 	var status string
-	db := GetDB()
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 	SELECT
 	  id
 	, game_bot_id
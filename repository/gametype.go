@@ -11,6 +11,8 @@ type GameType struct {
 	Id       int `json:"id"`
 	Mnemonic string
 	Name     string
+	// The name of the rating engine used to rate games of this type.
+	RatingEngine string
 }
 
 func CreateGameType(mnemonic string, name string) (GameType, error) {
@@ -46,9 +48,10 @@ func GetGameTypeByMnemonic(mnemonic string) (GameType, error) {
 	  id
 	, mnemonic
 	, name
+	, rating_engine
 	FROM game_type
 	WHERE mnemonic = $1
-	`, mnemonic).Scan(&gameType.Id, &gameType.Mnemonic, &gameType.Name)
+	`, mnemonic).Scan(&gameType.Id, &gameType.Mnemonic, &gameType.Name, &gameType.RatingEngine)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			em := fmt.Sprintf("Game \"%s\" is not known", mnemonic)
@@ -69,9 +72,10 @@ func GetGameTypeById(id int) (GameType, error) {
 	  gt.id
 	, gt.mnemonic
 	, gt.name
+	, gt.rating_engine
 	FROM game_type gt
 	WHERE gt.id = $1
-	`, id).Scan(&gameType.Id, &gameType.Mnemonic, &gameType.Name)
+	`, id).Scan(&gameType.Id, &gameType.Mnemonic, &gameType.Name, &gameType.RatingEngine)
 	if err != nil {
 		log.Printf("An error occurred in gametype.GetGameTypeById():\n%s\n", err)
 		return GameType{}, err
@@ -79,3 +83,49 @@ func GetGameTypeById(id int) (GameType, error) {
 
 	return gameType, nil
 }
+
+func ListGameTypes() ([]GameType, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  gt.id
+	, gt.mnemonic
+	, gt.name
+	, gt.rating_engine
+	FROM game_type gt
+	ORDER BY gt.name
+	`)
+	if err != nil {
+		log.Printf("An error occurred in gametype.ListGameTypes():1:\n%s\n", err)
+		return []GameType{}, err
+	}
+
+	var gameTypeList []GameType
+	for rows.Next() {
+		var gameType GameType
+		err := rows.Scan(&gameType.Id, &gameType.Mnemonic, &gameType.Name, &gameType.RatingEngine)
+		if err != nil {
+			log.Printf("An error occurred in gametype.ListGameTypes():2:\n%s\n", err)
+			return gameTypeList, err
+		}
+		gameTypeList = append(gameTypeList, gameType)
+	}
+
+	return gameTypeList, nil
+}
+
+func (gt *GameType) SetRatingEngine(engine string) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE game_type
+	SET rating_engine = $1
+	WHERE id = $2
+	`, engine, gt.Id)
+	if err != nil {
+		log.Printf("An error occurred in gametype.SetRatingEngine():\n%s\n", err)
+		return err
+	}
+	gt.RatingEngine = engine
+
+	return nil
+}
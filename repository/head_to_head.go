@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+)
+
+// HeadToHead is the record of one bot against another. Where a version is
+// empty the record covers every version of the bot.
+type HeadToHead struct {
+	BotName         string
+	BotVersion      string
+	OpponentName    string
+	OpponentVersion string
+	Record          GameRecord
+	AsPlayerOne     GameRecord
+	AsPlayerTwo     GameRecord
+	// The average time in milliseconds each bot took to make a move in these
+	// games. These are nil if no moves have been timed.
+	AverageMoveTime         *float64
+	OpponentAverageMoveTime *float64
+	gameIds                 []int
+}
+
+// headToHeadJoin joins each game to the game bot of the bot (gb) and of its
+// opponent (gbo) and headToHeadWhere restricts these to the bot names ($1, $3)
+// and, if not empty, the versions ($2, $4).
+const (
+	headToHeadJoin = `
+	FROM game g
+	JOIN game_bot gb
+	  ON g.id = gb.game_id
+	JOIN bot b
+	  ON gb.bot_id = b.id
+	JOIN game_bot gbo
+	  ON g.id = gbo.game_id
+	 AND gb.team != gbo.team
+	JOIN bot bo
+	  ON gbo.bot_id = bo.id
+	`
+	headToHeadWhere = `
+	WHERE b.name = $1
+	AND ($2 = '' OR b.version = $2)
+	AND bo.name = $3
+	AND ($4 = '' OR bo.version = $4)
+	`
+)
+
+func (h *HeadToHead) Games() ([]Game, error) {
+	var gameList []Game
+	for _, id := range h.gameIds {
+		game, err := GetGameById(id)
+		if err != nil {
+			return gameList, err
+		}
+		gameList = append(gameList, game)
+	}
+
+	return gameList, nil
+}
+
+// GetHeadToHead returns the record of the named bot against the named opponent
+// across all of their completed games, including those of superseded versions,
+// along with every game between them that hasn't been superseded. If a version
+// is given then only games played by that version are included.
+func GetHeadToHead(botName string, botVersion string, opponentName string, opponentVersion string) (HeadToHead, error) {
+	h := HeadToHead{
+		BotName:         botName,
+		BotVersion:      botVersion,
+		OpponentName:    opponentName,
+		OpponentVersion: opponentVersion,
+	}
+
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  gb.play_sequence
+	, COUNT(*)
+	, COUNT(CASE WHEN w.team = gb.team THEN 1 END)
+	, COUNT(CASE WHEN w.team IS NULL THEN 1 END)
+	`+headToHeadJoin+`
+	LEFT JOIN (
+	  SELECT
+	    gb2.game_id
+	  , gb2.team
+	  FROM move m
+	  JOIN game_bot gb2
+	    ON m.game_bot_id = gb2.id
+	  WHERE m.winner = TRUE
+	) w
+	  ON g.id = w.game_id
+	`+headToHeadWhere+`
+	AND g.status = $5
+	GROUP BY gb.play_sequence
+	`, botName, botVersion, opponentName, opponentVersion, string(GAME_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in head_to_head.GetHeadToHead():1:\n%s\n", err)
+		return h, err
+	}
+
+	for rows.Next() {
+		var playSequence int
+		var gr GameRecord
+		err := rows.Scan(&playSequence, &gr.Played, &gr.Won, &gr.Drawn)
+		if err != nil {
+			log.Printf("An error occurred in head_to_head.GetHeadToHead():2:\n%s\n", err)
+			return h, err
+		}
+
+		if playSequence == 1 {
+			h.AsPlayerOne = gr
+		} else {
+			h.AsPlayerTwo = gr
+		}
+		h.Record.Played += gr.Played
+		h.Record.Won += gr.Won
+		h.Record.Drawn += gr.Drawn
+	}
+
+	var averageMoveTime sql.NullFloat64
+	var opponentAverageMoveTime sql.NullFloat64
+	err = db.QueryRow(`
+	SELECT
+	  AVG(CASE WHEN m.game_bot_id = gb.id THEN EXTRACT(EPOCH FROM m.end_datetime - m.start_datetime) END) * 1000
+	, AVG(CASE WHEN m.game_bot_id = gbo.id THEN EXTRACT(EPOCH FROM m.end_datetime - m.start_datetime) END) * 1000
+	`+headToHeadJoin+`
+	JOIN move m
+	  ON m.game_bot_id IN (gb.id, gbo.id)
+	`+headToHeadWhere+`
+	AND m.status = $5
+	AND g.status != $6
+	`, botName, botVersion, opponentName, opponentVersion, string(GAMEMOVE_STATUS_COMPLETE), string(GAME_STATUS_SUPERSEDED)).Scan(&averageMoveTime, &opponentAverageMoveTime)
+	if err != nil {
+		log.Printf("An error occurred in head_to_head.GetHeadToHead():3:\n%s\n", err)
+		return h, err
+	}
+	if averageMoveTime.Valid {
+		h.AverageMoveTime = &averageMoveTime.Float64
+	}
+	if opponentAverageMoveTime.Valid {
+		h.OpponentAverageMoveTime = &opponentAverageMoveTime.Float64
+	}
+
+	rows, err = db.Query(`
+	SELECT
+	  g.id
+	`+headToHeadJoin+headToHeadWhere+`
+	AND g.status != $5
+	ORDER BY g.id DESC
+	`, botName, botVersion, opponentName, opponentVersion, string(GAME_STATUS_SUPERSEDED))
+	if err != nil {
+		log.Printf("An error occurred in head_to_head.GetHeadToHead():4:\n%s\n", err)
+		return h, err
+	}
+
+	for rows.Next() {
+		var gameId int
+		err := rows.Scan(&gameId)
+		if err != nil {
+			log.Printf("An error occurred in head_to_head.GetHeadToHead():5:\n%s\n", err)
+			return h, err
+		}
+		h.gameIds = append(h.gameIds, gameId)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import "log"
+
+// LadderPairing is a pair of ranked bots that could be scheduled to play a
+// ladder game against each other.
+type LadderPairing struct {
+	botId      int
+	opponentId int
+}
+
+func (lp *LadderPairing) Bot() (Bot, error) {
+	return GetBotById(lp.botId)
+}
+
+func (lp *LadderPairing) Opponent() (Bot, error) {
+	return GetBotById(lp.opponentId)
+}
+
+// TryLockLadderTx takes the lock held whilst scheduling a round of ladder games
+// until the transaction ends. It returns false without waiting if another
+// worker node is already scheduling a round.
+func TryLockLadderTx(tx *Tx) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(`
+	SELECT pg_try_advisory_xact_lock($1, 0)
+	`, ADVISORY_LOCK_LADDER).Scan(&locked)
+	if err != nil {
+		log.Printf("An error occurred in ladder.TryLockLadderTx():\n%s\n", err)
+		return false, err
+	}
+
+	return locked, nil
+}
+
+// ListLeastRecentlyPlayedPairings returns up to limit pairings of online ranked
+// bots for the game type, ordered so that bots that have never played each other
+// come first followed by those that played each other least recently. Pairs that
+// already have a game in progress are excluded.
+func ListLeastRecentlyPlayedPairings(gameType GameType, limit int) ([]LadderPairing, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  b1.id
+	, b2.id
+	FROM bot b1
+	JOIN bot b2
+	  ON b1.game_type_id = b2.game_type_id
+	 AND b1.id < b2.id
+	 AND b1.name != b2.name
+	WHERE b1.game_type_id = $1
+	AND b1.status = $2
+	AND b2.status = $2
+	AND b1.stage = $3
+	AND b2.stage = $3
+	AND NOT EXISTS (
+	  SELECT 1
+	  FROM game g
+	  JOIN game_bot gb1
+	    ON g.id = gb1.game_id
+	   AND gb1.bot_id = b1.id
+	  JOIN game_bot gb2
+	    ON g.id = gb2.game_id
+	   AND gb2.bot_id = b2.id
+	  WHERE g.status IN ($4, $5)
+	)
+	ORDER BY (
+	  SELECT MAX(g.created_datetime)
+	  FROM game g
+	  JOIN game_bot gb1
+	    ON g.id = gb1.game_id
+	   AND gb1.bot_id = b1.id
+	  JOIN game_bot gb2
+	    ON g.id = gb2.game_id
+	   AND gb2.bot_id = b2.id
+	  WHERE g.status != $6
+	) ASC NULLS FIRST
+	LIMIT $7
+	`, gameType.Id, string(BOT_STATUS_ONLINE), string(BOT_STAGE_RANKED), string(GAME_STATUS_NOT_STARTED), string(GAME_STATUS_IN_PROGRESS), string(GAME_STATUS_SUPERSEDED), limit)
+	if err != nil {
+		log.Printf("An error occurred in ladder.ListLeastRecentlyPlayedPairings():1:\n%s\n", err)
+		return []LadderPairing{}, err
+	}
+
+	var pairingList []LadderPairing
+	for rows.Next() {
+		var lp LadderPairing
+		err := rows.Scan(&lp.botId, &lp.opponentId)
+		if err != nil {
+			log.Printf("An error occurred in ladder.ListLeastRecentlyPlayedPairings():2:\n%s\n", err)
+			return pairingList, err
+		}
+		pairingList = append(pairingList, lp)
+	}
+
+	return pairingList, nil
+}
@@ -0,0 +1,404 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// MoveJob is a game move waiting to be played, or being played, by a worker. A
+// move can only have one job at a time so the same move is never played twice
+// at once.
+type MoveJob struct {
+	Id           int
+	moveId       int
+	workerNodeId int
+	Status       MoveJobStatus
+	Attempts     int
+	Priority     MovePriority
+}
+
+type MoveJobStatus string
+
+const (
+	MOVE_JOB_STATUS_QUEUED  MoveJobStatus = "QUEUED"
+	MOVE_JOB_STATUS_RUNNING MoveJobStatus = "RUNNING"
+	// A job is failed once its lease has expired more times than it is allowed
+	// attempts, e.g. because it keeps crashing the worker playing it.
+	MOVE_JOB_STATUS_FAILED MoveJobStatus = "FAILED"
+)
+
+// ErrMoveJobLeaseLost is returned when the result of a move is stored after the
+// job for it was taken away from the worker node playing it, e.g. because the
+// node was stopped or declared dead and the move given to another node.
+var ErrMoveJobLeaseLost = errors.New("The move job is no longer leased to this worker node.")
+
+// MovePriority decides the order in which queued moves are claimed, lower
+// priorities being claimed first.
+type MovePriority int
+
+const (
+	// A move in a game that is already under way.
+	MOVE_PRIORITY_CONTINUATION MovePriority = 0
+	// The first move of a game.
+	MOVE_PRIORITY_FIRST_MOVE MovePriority = 1
+	// A move in a game that nobody is waiting on, e.g. a sandbox game.
+	MOVE_PRIORITY_BACKGROUND MovePriority = 2
+)
+
+func (p MovePriority) String() string {
+	switch p {
+	case MOVE_PRIORITY_CONTINUATION:
+		return "CONTINUATION"
+	case MOVE_PRIORITY_FIRST_MOVE:
+		return "FIRST_MOVE"
+	case MOVE_PRIORITY_BACKGROUND:
+		return "BACKGROUND"
+	}
+
+	return "UNKNOWN"
+}
+
+func (j *MoveJob) GameMove() (GameMove, error) {
+	return GetGameMoveById(j.moveId)
+}
+
+// EnqueueGameMove creates a job to play the given move. Moves in background
+// games are given the lowest priority, then first moves, with moves in games
+// that are already under way claimed first. If the move already has a job then
+// nothing is done.
+func EnqueueGameMove(gm GameMove) error {
+	return enqueueGameMove(GetDB(), gm)
+}
+
+// EnqueueGameMoveTx creates a job to play the given move as part of the
+// transaction, so that the move and its job are created together.
+func EnqueueGameMoveTx(tx *Tx, gm GameMove) error {
+	return enqueueGameMove(tx, gm)
+}
+
+func enqueueGameMove(q querier, gm GameMove) error {
+	_, err := q.Exec(`
+	INSERT INTO move_job (
+	  move_id
+	, bot_id
+	, priority
+	)
+	SELECT
+	  m.id
+	, gb.bot_id
+	, CASE
+	    WHEN g.kind IN ($2, $3, $4) THEN $5
+	    WHEN EXISTS (
+	      SELECT 1
+	      FROM move om
+	      JOIN game_bot ogb
+	        ON om.game_bot_id = ogb.id
+	      WHERE ogb.game_id = g.id
+	      AND om.id != m.id
+	    ) THEN $6
+	    ELSE $7
+	  END
+	FROM move m
+	JOIN game_bot gb
+	  ON m.game_bot_id = gb.id
+	JOIN game g
+	  ON gb.game_id = g.id
+	WHERE m.id = $1
+	ON CONFLICT (move_id) DO NOTHING
+	`, gm.Id, string(GAME_KIND_SANDBOX), string(GAME_KIND_QUALIFICATION), string(GAME_KIND_REGRESSION), int(MOVE_PRIORITY_BACKGROUND), int(MOVE_PRIORITY_CONTINUATION), int(MOVE_PRIORITY_FIRST_MOVE))
+	if err != nil {
+		log.Printf("An error occurred in move_job.EnqueueGameMove():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimMoveJob takes the queued job with the highest priority, or a running job
+// whose lease has expired, and leases it to the worker node for the given
+// duration. So that lower priorities aren't starved a job's priority is raised
+// by one for every priorityAging it has been waiting. An aged job only draws
+// level with jobs of a higher priority, it doesn't overtake them, so a flood of
+// waiting first moves can't hold up games that are under way.
+//
+// Jobs of the same priority are shared fairly between bot owners. Each owner's
+// usage is the number of their moves being played or started within the
+// fairShareWindow, divided by their scheduling weight, and the job goes to the
+// owner with the least usage, then to the oldest job.
+//
+// Jobs locked by another worker are skipped, as are jobs for bots that already
+// have as many moves being played as they allow, up to maxBotConcurrency.
+// Claims for the same bot are serialized so that nodes claiming at the same
+// time can't exceed the bot's limit between them. If there is no job to claim
+// sql.ErrNoRows is returned.
+//
+// Before claiming, running jobs whose lease has expired too many times are
+// failed and recorded as failed moves.
+func ClaimMoveJob(node WorkerNode, lease time.Duration, maxAttempts int, maxBotConcurrency int, priorityAging time.Duration, fairShareWindow time.Duration) (MoveJob, error) {
+	db := GetDB()
+	_, err := db.Exec(`
+	WITH failed AS (
+	  UPDATE move_job
+	  SET status = $1
+	  WHERE status = $2
+	  AND lease_expires_datetime < now()
+	  AND attempts >= $3
+	  RETURNING
+	    move_id
+	  , bot_id
+	  , attempts
+	)
+	INSERT INTO failed_move (
+	  move_id
+	, bot_id
+	, reason
+	, error
+	, attempts
+	)
+	SELECT
+	  move_id
+	, bot_id
+	, $4
+	, $5
+	, attempts
+	FROM failed
+	ON CONFLICT (move_id) WHERE status = 'OPEN' DO UPDATE
+	SET
+	  reason = EXCLUDED.reason
+	, error = EXCLUDED.error
+	, attempts = EXCLUDED.attempts
+	`, string(MOVE_JOB_STATUS_FAILED), string(MOVE_JOB_STATUS_RUNNING), maxAttempts, string(FAILED_MOVE_REASON_LEASE_EXPIRED), "The move was claimed too many times without being played.")
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():1:\n%s\n", err)
+		return MoveJob{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():2:\n%s\n", err)
+		return MoveJob{}, err
+	}
+
+	var jobId int
+	var botId int
+	var botConcurrency int
+	err = tx.QueryRow(`
+	WITH owner_usage AS (
+	  SELECT
+	    um.user_id
+	  , COUNT(*) moves
+	  FROM (
+	    SELECT
+	      ub.user_id
+	    , m.id
+	    FROM move m
+	    JOIN game_bot ugb
+	      ON m.game_bot_id = ugb.id
+	    JOIN bot ub
+	      ON ugb.bot_id = ub.id
+	    WHERE m.start_datetime >= now() - $5 * INTERVAL '1 second'
+	    UNION
+	    SELECT
+	      ub.user_id
+	    , uj.move_id
+	    FROM move_job uj
+	    JOIN bot ub
+	      ON uj.bot_id = ub.id
+	    WHERE uj.status = $1
+	    AND uj.lease_expires_datetime >= now()
+	  ) um
+	  GROUP BY um.user_id
+	)
+	SELECT
+	  mj.id
+	, mj.bot_id
+	, LEAST(b.max_concurrency, $3)
+	FROM move_job mj
+	JOIN bot b
+	  ON mj.bot_id = b.id
+	JOIN merknera_user u
+	  ON b.user_id = u.id
+	LEFT JOIN owner_usage us
+	  ON b.user_id = us.user_id
+	WHERE (
+	  mj.status = $2
+	  OR (
+	    mj.status = $1
+	    AND mj.lease_expires_datetime < now()
+	  )
+	)
+	AND (
+	  SELECT COUNT(*)
+	  FROM move_job rj
+	  WHERE rj.bot_id = mj.bot_id
+	  AND rj.status = $1
+	  AND rj.lease_expires_datetime >= now()
+	) < LEAST(b.max_concurrency, $3)
+	ORDER BY
+	  GREATEST(mj.priority - FLOOR(EXTRACT(EPOCH FROM now() - mj.created_datetime) / $4), 0)
+	, mj.priority
+	, COALESCE(us.moves, 0)::FLOAT / u.scheduling_weight
+	, mj.id
+	LIMIT 1
+	FOR UPDATE OF mj SKIP LOCKED
+	`, string(MOVE_JOB_STATUS_RUNNING), string(MOVE_JOB_STATUS_QUEUED), maxBotConcurrency, priorityAging.Seconds(), fairShareWindow.Seconds()).Scan(&jobId, &botId, &botConcurrency)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("An error occurred in move_job.ClaimMoveJob():3:\n%s\n", err)
+		}
+		tx.Rollback()
+		return MoveJob{}, err
+	}
+
+	// The bot's running moves were counted without a lock so another node may
+	// have claimed a move for the bot since. Claims for the same bot are
+	// serialized from here and the moves counted again.
+	_, err = tx.Exec(`
+	SELECT pg_advisory_xact_lock($1, $2)
+	`, ADVISORY_LOCK_BOT_CLAIM, botId)
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():4:\n%s\n", err)
+		tx.Rollback()
+		return MoveJob{}, err
+	}
+
+	var running int
+	err = tx.QueryRow(`
+	SELECT COUNT(*)
+	FROM move_job
+	WHERE bot_id = $1
+	AND status = $2
+	AND lease_expires_datetime >= now()
+	`, botId, string(MOVE_JOB_STATUS_RUNNING)).Scan(&running)
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():5:\n%s\n", err)
+		tx.Rollback()
+		return MoveJob{}, err
+	}
+	if running >= botConcurrency {
+		// Another node claimed the bot's last free slot first. The job is left
+		// queued and the dispatcher tries again shortly.
+		tx.Rollback()
+		return MoveJob{}, sql.ErrNoRows
+	}
+
+	var job MoveJob
+	var status string
+	var priority int
+	err = tx.QueryRow(`
+	UPDATE move_job
+	SET
+	  status = $1
+	, attempts = attempts + 1
+	, lease_expires_datetime = now() + $2 * INTERVAL '1 second'
+	, worker_node_id = $3
+	WHERE id = $4
+	RETURNING
+	  id
+	, move_id
+	, worker_node_id
+	, status
+	, attempts
+	, priority
+	`, string(MOVE_JOB_STATUS_RUNNING), lease.Seconds(), node.Id, jobId).Scan(&job.Id, &job.moveId, &job.workerNodeId, &status, &job.Attempts, &priority)
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():6:\n%s\n", err)
+		tx.Rollback()
+		return MoveJob{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in move_job.ClaimMoveJob():7:\n%s\n", err)
+		return MoveJob{}, err
+	}
+	job.Status = MoveJobStatus(status)
+	job.Priority = MovePriority(priority)
+
+	return job, nil
+}
+
+// lockLease locks the job for the rest of the transaction, returning
+// ErrMoveJobLeaseLost if it is no longer being played by the worker node that
+// claimed it. Holding the lock stops the job being requeued until the
+// transaction ends.
+func (j *MoveJob) lockLease(tx *Tx) error {
+	var id int
+	err := tx.QueryRow(`
+	SELECT id
+	FROM move_job
+	WHERE id = $1
+	AND worker_node_id = $2
+	AND status = $3
+	FOR UPDATE
+	`, j.Id, j.workerNodeId, string(MOVE_JOB_STATUS_RUNNING)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrMoveJobLeaseLost
+	}
+	if err != nil {
+		log.Printf("An error occurred in move_job.lockLease():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Complete removes the job once a worker has finished with the move, whether or
+// not it could be played. Moves that could not be played are queued again when,
+// for example, their bot comes back online. If the job has since been given to
+// another worker node it is left for that node.
+func (j *MoveJob) Complete() error {
+	db := GetDB()
+	_, err := db.Exec(`
+	DELETE FROM move_job
+	WHERE id = $1
+	AND worker_node_id = $2
+	`, j.Id, j.workerNodeId)
+	if err != nil {
+		log.Printf("An error occurred in move_job.Complete():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Release gives up the worker node's lease on the job without finishing it, e.g.
+// because of an internal error. The node's heartbeat no longer extends the
+// lease so once it expires the job is claimed again, or failed and recorded as
+// a failed move if it has been claimed too many times.
+func (j *MoveJob) Release() error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE move_job
+	SET worker_node_id = NULL
+	WHERE id = $1
+	AND worker_node_id = $2
+	AND status = $3
+	`, j.Id, j.workerNodeId, string(MOVE_JOB_STATUS_RUNNING))
+	if err != nil {
+		log.Printf("An error occurred in move_job.Release():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CountQueuedMoveJobs returns the number of moves waiting to be claimed by a
+// worker.
+func CountQueuedMoveJobs() (int, error) {
+	var count int
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT COUNT(*)
+	FROM move_job
+	WHERE status = $1
+	`, string(MOVE_JOB_STATUS_QUEUED)).Scan(&count)
+	if err != nil {
+		log.Printf("An error occurred in move_job.CountQueuedMoveJobs():\n%s\n", err)
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrMoveAlreadyApplied is returned by ApplyOutcome when the move is no longer
+// awaiting play, e.g. because a worker node whose lease on it expired has since
+// applied it.
+var ErrMoveAlreadyApplied = errors.New("The move has already been played.")
+
+// MoveOutcome is everything that changes once a bot has played a move.
+type MoveOutcome struct {
+	// The game state following the move.
+	GameState interface{}
+	// The player to make the next move. If nil the move ended the game.
+	NextGameBot *GameBot
+	// True if the move won the game, only used if the move ended the game.
+	Win bool
+	// Rates the game if the move ended it, may be nil.
+	Rate RateFunc
+}
+
+// RateFunc updates the ratings of the players of a completed game as part of the
+// transaction that completes it, so that a game is never left complete without
+// its ratings updated.
+type RateFunc func(tx *Tx) error
+
+// ApplyOutcome stores the outcome of the move in a single transaction: the game
+// state is saved and either the next move is created and queued or the game is
+// completed and rated, then the move itself is completed along with any failure recorded
+// for it. If anything fails nothing is changed and the move is left awaiting
+// play. The next move is returned if one was created.
+//
+// The outcome is only stored whilst the job the move was played under is still
+// leased to this worker node, otherwise ErrMoveJobLeaseLost is returned.
+func (gm *GameMove) ApplyOutcome(game Game, job MoveJob, outcome MoveOutcome) (GameMove, error) {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():1:\n%s\n", err)
+		return GameMove{}, err
+	}
+
+	err = job.lockLease(tx)
+	if err != nil {
+		tx.Rollback()
+		return GameMove{}, err
+	}
+
+	// Lock the move so that it can only be applied once.
+	var status string
+	err = tx.QueryRow(`
+	SELECT status
+	FROM move
+	WHERE id = $1
+	FOR UPDATE
+	`, gm.Id).Scan(&status)
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():2:\n%s\n", err)
+		tx.Rollback()
+		return GameMove{}, err
+	}
+	if GameMoveStatus(status) != GAMEMOVE_STATUS_AWAITING {
+		tx.Rollback()
+		return GameMove{}, ErrMoveAlreadyApplied
+	}
+
+	err = gm.SetGameStateTx(tx, outcome.GameState)
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():3:\n%s\n", err)
+		tx.Rollback()
+		return GameMove{}, err
+	}
+
+	var nextMove GameMove
+	if outcome.NextGameBot != nil {
+		nextMove, err = CreateGameMoveTx(tx, *outcome.NextGameBot, outcome.GameState)
+		if err != nil {
+			log.Printf("An error occurred in move_outcome.ApplyOutcome():4:\n%s\n", err)
+			tx.Rollback()
+			return GameMove{}, err
+		}
+
+		err = EnqueueGameMoveTx(tx, nextMove)
+		if err != nil {
+			log.Printf("An error occurred in move_outcome.ApplyOutcome():5:\n%s\n", err)
+			tx.Rollback()
+			return GameMove{}, err
+		}
+	} else {
+		if outcome.Win {
+			err = gm.MarkAsWinTx(tx)
+			if err != nil {
+				log.Printf("An error occurred in move_outcome.ApplyOutcome():6:\n%s\n", err)
+				tx.Rollback()
+				return GameMove{}, err
+			}
+		}
+
+		err = game.MarkCompleteTx(tx)
+		if err != nil {
+			log.Printf("An error occurred in move_outcome.ApplyOutcome():7:\n%s\n", err)
+			tx.Rollback()
+			return GameMove{}, err
+		}
+
+		if outcome.Rate != nil {
+			err = outcome.Rate(tx)
+			if err != nil {
+				log.Printf("An error occurred in move_outcome.ApplyOutcome():8:\n%s\n", err)
+				tx.Rollback()
+				return GameMove{}, err
+			}
+		}
+	}
+
+	err = gm.MarkCompleteTx(tx)
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():9:\n%s\n", err)
+		tx.Rollback()
+		return GameMove{}, err
+	}
+
+	// The move may have failed before, e.g. before its bot was fixed and
+	// re-registered.
+	err = resolveFailedMoves(tx, gm.Id, FAILED_MOVE_STATUS_RETRIED, nil)
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():10:\n%s\n", err)
+		tx.Rollback()
+		return GameMove{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("An error occurred in move_outcome.ApplyOutcome():11:\n%s\n", err)
+		return GameMove{}, err
+	}
+
+	return nextMove, nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"log"
+	"sort"
+)
+
+// BotRating is a bots rating as calculated by a rating engine. Each engine keeps
+// its own rating so a game type can change engine without mixing rating scales.
+type BotRating struct {
+	botId        int
+	RatingEngine string
+	Mu           float64
+	Sigma        float64
+	GamesRated   int
+}
+
+// Rating returns the bots rating from the given engine. If the bot has not yet
+// been rated by the engine sql.ErrNoRows is returned.
+func (b *Bot) Rating(engine string) (BotRating, error) {
+	br := BotRating{
+		botId:        b.Id,
+		RatingEngine: engine,
+	}
+
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT
+	  mu
+	, sigma
+	, games_rated
+	FROM bot_rating
+	WHERE bot_id = $1
+	AND rating_engine = $2
+	AND games_rated > 0
+	`, b.Id, engine).Scan(&br.Mu, &br.Sigma, &br.GamesRated)
+	if err != nil {
+		return br, err
+	}
+
+	return br, nil
+}
+
+// LockRatingsTx locks the ratings of the bots from the given engine for the
+// rest of the transaction so that games finishing at the same time can't
+// overwrite each others ratings. Bots that have not yet been rated are given
+// the initial rating so that there is a row to lock, they are not counted as
+// rated until their rating is saved. The ratings are locked in bot id order so
+// that games sharing bots can't deadlock.
+func LockRatingsTx(tx *Tx, engine string, bots []Bot, initialMu float64, initialSigma float64) (map[int]BotRating, error) {
+	var botIds []int
+	for _, b := range bots {
+		botIds = append(botIds, b.Id)
+	}
+	sort.Ints(botIds)
+
+	ratings := make(map[int]BotRating)
+	for _, id := range botIds {
+		if _, ok := ratings[id]; ok {
+			continue
+		}
+
+		_, err := tx.Exec(`
+		INSERT INTO bot_rating (
+		  bot_id
+		, rating_engine
+		, mu
+		, sigma
+		) VALUES (
+		  $1
+		, $2
+		, $3
+		, $4
+		)
+		ON CONFLICT (bot_id, rating_engine) DO NOTHING
+		`, id, engine, initialMu, initialSigma)
+		if err != nil {
+			log.Printf("An error occurred in rating.LockRatingsTx():1:\n%s\n", err)
+			return ratings, err
+		}
+
+		br := BotRating{
+			botId:        id,
+			RatingEngine: engine,
+		}
+		err = tx.QueryRow(`
+		SELECT
+		  mu
+		, sigma
+		, games_rated
+		FROM bot_rating
+		WHERE bot_id = $1
+		AND rating_engine = $2
+		FOR UPDATE
+		`, id, engine).Scan(&br.Mu, &br.Sigma, &br.GamesRated)
+		if err != nil {
+			log.Printf("An error occurred in rating.LockRatingsTx():2:\n%s\n", err)
+			return ratings, err
+		}
+		ratings[id] = br
+	}
+
+	return ratings, nil
+}
+
+// SaveRating stores the bots new rating after a rated game.
+func (b *Bot) SaveRating(engine string, mu float64, sigma float64) error {
+	return b.saveRating(GetDB(), engine, mu, sigma)
+}
+
+func (b *Bot) SaveRatingTx(tx *Tx, engine string, mu float64, sigma float64) error {
+	return b.saveRating(tx, engine, mu, sigma)
+}
+
+func (b *Bot) saveRating(q querier, engine string, mu float64, sigma float64) error {
+	_, err := q.Exec(`
+	INSERT INTO bot_rating (
+	  bot_id
+	, rating_engine
+	, mu
+	, sigma
+	, games_rated
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	, $4
+	, 1
+	)
+	ON CONFLICT (bot_id, rating_engine) DO UPDATE
+	SET
+	  mu = EXCLUDED.mu
+	, sigma = EXCLUDED.sigma
+	, games_rated = bot_rating.games_rated + 1
+	, updated_datetime = now()
+	`, b.Id, engine, mu, sigma)
+	if err != nil {
+		log.Printf("An error occurred in rating.SaveRating():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
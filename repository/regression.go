@@ -0,0 +1,92 @@
+package repository
+
+import "log"
+
+// RegressionResult is the record of one version of a bot against another
+// version of the same bot in regression games.
+type RegressionResult struct {
+	botId         int
+	opponentBotId int
+	Record        GameRecord
+}
+
+func (rr *RegressionResult) Bot() (Bot, error) {
+	return GetBotById(rr.botId)
+}
+
+func (rr *RegressionResult) Opponent() (Bot, error) {
+	return GetBotById(rr.opponentBotId)
+}
+
+// ListRegressionResults returns the results of every completed regression game
+// between versions of the named bot, grouped by version and opposing version.
+func ListRegressionResults(name string) ([]RegressionResult, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  gb.bot_id
+	, gbo.bot_id
+	, COUNT(*)
+	, COUNT(CASE WHEN w.team = gb.team THEN 1 END)
+	, COUNT(CASE WHEN w.team IS NULL THEN 1 END)
+	FROM game g
+	JOIN game_bot gb
+	  ON g.id = gb.game_id
+	JOIN bot b
+	  ON gb.bot_id = b.id
+	JOIN game_bot gbo
+	  ON g.id = gbo.game_id
+	 AND gb.team != gbo.team
+	LEFT JOIN (
+	  SELECT
+	    gb2.game_id
+	  , gb2.team
+	  FROM move m
+	  JOIN game_bot gb2
+	    ON m.game_bot_id = gb2.id
+	  WHERE m.winner = TRUE
+	) w
+	  ON g.id = w.game_id
+	WHERE g.kind = $1
+	AND g.status = $2
+	AND b.name = $3
+	GROUP BY gb.bot_id, gbo.bot_id
+	ORDER BY gb.bot_id, gbo.bot_id
+	`, string(GAME_KIND_REGRESSION), string(GAME_STATUS_COMPLETE), name)
+	if err != nil {
+		log.Printf("An error occurred in regression.ListRegressionResults():1:\n%s\n", err)
+		return []RegressionResult{}, err
+	}
+
+	var resultList []RegressionResult
+	for rows.Next() {
+		var rr RegressionResult
+		err := rows.Scan(&rr.botId, &rr.opponentBotId, &rr.Record.Played, &rr.Record.Won, &rr.Record.Drawn)
+		if err != nil {
+			log.Printf("An error occurred in regression.ListRegressionResults():2:\n%s\n", err)
+			return resultList, err
+		}
+		resultList = append(resultList, rr)
+	}
+
+	return resultList, nil
+}
+
+// ListPreviousVersions returns up to limit versions of the named bot that were
+// registered before the given bot, most recent first.
+func ListPreviousVersions(bot Bot, limit int) ([]Bot, error) {
+	versions, err := ListBotsByName(bot.Name)
+	if err != nil {
+		log.Printf("An error occurred in regression.ListPreviousVersions():\n%s\n", err)
+		return []Bot{}, err
+	}
+
+	var previous []Bot
+	for i := len(versions) - 1; i >= 0 && len(previous) < limit; i-- {
+		if versions[i].Id < bot.Id {
+			previous = append(previous, versions[i])
+		}
+	}
+
+	return previous, nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/mleonard87/merknera/metrics"
+	"github.com/mleonard87/merknera/rpchelper"
+)
+
+var (
+	rpcDuration = metrics.NewHistogram(
+		"merknera_rpc_duration_seconds",
+		"Time taken by each attempt at an RPC call to a bot, by method.",
+		metrics.DefaultBuckets,
+		"method",
+	)
+	rpcErrors = metrics.NewCounter(
+		"merknera_rpc_errors_total",
+		"Failed attempts at RPC calls to bots, by method and bot.",
+		"method",
+		"bot",
+	)
+)
+
+// RPCAttempt is a single attempt at an RPC call to a bot. A call that failed
+// because the bot couldn't be reached may be attempted several times.
+type RPCAttempt struct {
+	Id            int
+	botId         int
+	moveId        sql.NullInt64
+	Method        string
+	Attempt       int
+	StartDateTime time.Time
+	DurationMs    int
+	Error         sql.NullString
+}
+
+// RecordRPCAttempt stores an attempt at an RPC call to the bot. The move may be
+// the zero value if the call wasn't made while playing a move.
+func (b *Bot) RecordRPCAttempt(move GameMove, method string, attempt int, startDateTime time.Time, duration time.Duration, attemptErr error) error {
+	var moveId sql.NullInt64
+	if move.Id > 0 {
+		moveId = sql.NullInt64{Int64: int64(move.Id), Valid: true}
+	}
+
+	var errorMessage sql.NullString
+	if attemptErr != nil {
+		errorMessage = sql.NullString{String: truncate(sanitizeText(attemptErr.Error()), 1000), Valid: true}
+	}
+
+	db := GetDB()
+	_, err := db.Exec(`
+	INSERT INTO rpc_attempt (
+	  bot_id
+	, move_id
+	, method
+	, attempt
+	, start_datetime
+	, duration_ms
+	, error
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	, $4
+	, $5
+	, $6
+	, $7
+	)
+	`, b.Id, moveId, method, attempt, startDateTime.UTC(), int(duration/time.Millisecond), errorMessage)
+	if err != nil {
+		log.Printf("An error occurred in rpc_attempt.RecordRPCAttempt():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// RPCAttemptRecorder returns a function that records each attempt at an RPC
+// call to the bot. Failed attempts are also written to the bot's log. Bots are
+// pinged before every move and whilst they are unhealthy so successful attempts
+// that aren't part of a move, e.g. pings, are only counted and not stored.
+func (b *Bot) RPCAttemptRecorder(move GameMove) rpchelper.AttemptFunc {
+	return func(a rpchelper.Attempt) {
+		rpcDuration.ObserveDuration(a.Duration, a.Method)
+		if a.Err != nil {
+			rpcErrors.Inc(a.Method, b.Name)
+			b.Logf("RPC call attempt %d: %s failed: %s", a.Number, a.Method, a.Err)
+		}
+		if move.Id > 0 || a.Err != nil {
+			b.RecordRPCAttempt(move, a.Method, a.Number, a.StartDateTime, a.Duration, a.Err)
+		}
+	}
+}
+
+func (gm *GameMove) RPCAttempts() ([]RPCAttempt, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  ra.id
+	, ra.bot_id
+	, ra.move_id
+	, ra.method
+	, ra.attempt
+	, ra.start_datetime
+	, ra.duration_ms
+	, ra.error
+	FROM rpc_attempt ra
+	WHERE ra.move_id = $1
+	ORDER BY ra.start_datetime
+	`, gm.Id)
+	if err != nil {
+		log.Printf("An error occurred in rpc_attempt.RPCAttempts():1:\n%s\n", err)
+		return []RPCAttempt{}, err
+	}
+	defer rows.Close()
+
+	var attempts []RPCAttempt
+	for rows.Next() {
+		var a RPCAttempt
+		err := rows.Scan(&a.Id, &a.botId, &a.moveId, &a.Method, &a.Attempt, &a.StartDateTime, &a.DurationMs, &a.Error)
+		if err != nil {
+			log.Printf("An error occurred in rpc_attempt.RPCAttempts():2:\n%s\n", err)
+			return attempts, err
+		}
+		attempts = append(attempts, a)
+	}
+
+	return attempts, nil
+}
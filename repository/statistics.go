@@ -0,0 +1,176 @@
+package repository
+
+import "log"
+
+// GameTypeStatistics summarises every completed game of a game type so that
+// the balance of the game, e.g. any first-player advantage, can be checked.
+type GameTypeStatistics struct {
+	gameTypeId          int
+	GamesCompleted      int
+	PlaySequenceResults []PlaySequenceResult
+	GameLengths         []GameLengthFrequency
+	Openings            []OpeningFrequency
+}
+
+// PlaySequenceResult is the combined record of every bot that played in a given
+// position (e.g. first).
+type PlaySequenceResult struct {
+	PlaySequence int
+	Record       GameRecord
+}
+
+// GameLengthFrequency is the number of games that lasted the given number of
+// moves.
+type GameLengthFrequency struct {
+	Moves int
+	Games int
+}
+
+// OpeningFrequency is the number of games that began with a given opening,
+// identified by the game state after the first move, along with the record of
+// the first player in those games.
+type OpeningFrequency struct {
+	GameState string
+	Record    GameRecord
+}
+
+func (s *GameTypeStatistics) GameType() (GameType, error) {
+	return GetGameTypeById(s.gameTypeId)
+}
+
+// GetGameTypeStatistics returns the statistics for all completed games of the
+// given game type.
+func GetGameTypeStatistics(gameType GameType) (GameTypeStatistics, error) {
+	stats := GameTypeStatistics{
+		gameTypeId: gameType.Id,
+	}
+
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  gb.play_sequence
+	, COUNT(*)
+	, COUNT(CASE WHEN w.team = gb.team THEN 1 END)
+	, COUNT(CASE WHEN w.team IS NULL THEN 1 END)
+	FROM game g
+	JOIN game_bot gb
+	  ON g.id = gb.game_id
+	LEFT JOIN (
+	  SELECT
+	    gb2.game_id
+	  , gb2.team
+	  FROM move m
+	  JOIN game_bot gb2
+	    ON m.game_bot_id = gb2.id
+	  WHERE m.winner = TRUE
+	) w
+	  ON g.id = w.game_id
+	WHERE g.game_type_id = $1
+	AND g.status = $2
+	GROUP BY gb.play_sequence
+	ORDER BY gb.play_sequence
+	`, gameType.Id, string(GAME_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in statistics.GetGameTypeStatistics():1:\n%s\n", err)
+		return stats, err
+	}
+
+	for rows.Next() {
+		var psr PlaySequenceResult
+		err := rows.Scan(&psr.PlaySequence, &psr.Record.Played, &psr.Record.Won, &psr.Record.Drawn)
+		if err != nil {
+			log.Printf("An error occurred in statistics.GetGameTypeStatistics():2:\n%s\n", err)
+			return stats, err
+		}
+		stats.PlaySequenceResults = append(stats.PlaySequenceResults, psr)
+	}
+
+	rows, err = db.Query(`
+	SELECT
+	  l.moves
+	, COUNT(*)
+	FROM (
+	  SELECT
+	    g.id
+	  , COUNT(m.id) moves
+	  FROM game g
+	  JOIN game_bot gb
+	    ON g.id = gb.game_id
+	  JOIN move m
+	    ON gb.id = m.game_bot_id
+	  WHERE g.game_type_id = $1
+	  AND g.status = $2
+	  GROUP BY g.id
+	) l
+	GROUP BY l.moves
+	ORDER BY l.moves
+	`, gameType.Id, string(GAME_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in statistics.GetGameTypeStatistics():3:\n%s\n", err)
+		return stats, err
+	}
+
+	for rows.Next() {
+		var glf GameLengthFrequency
+		err := rows.Scan(&glf.Moves, &glf.Games)
+		if err != nil {
+			log.Printf("An error occurred in statistics.GetGameTypeStatistics():4:\n%s\n", err)
+			return stats, err
+		}
+		stats.GameLengths = append(stats.GameLengths, glf)
+		stats.GamesCompleted += glf.Games
+	}
+
+	// The game state of a move is the state the bot is asked to play from so
+	// the state after the opening move is held by the second move of the game.
+	rows, err = db.Query(`
+	SELECT
+	  o.game_state
+	, COUNT(*)
+	, COUNT(CASE WHEN w.team = o.first_team THEN 1 END)
+	, COUNT(CASE WHEN w.team IS NULL THEN 1 END)
+	FROM (
+	  SELECT
+	    g.id game_id
+	  , m.game_state::TEXT game_state
+	  , FIRST_VALUE(gb.team) OVER (PARTITION BY g.id ORDER BY m.id) first_team
+	  , ROW_NUMBER() OVER (PARTITION BY g.id ORDER BY m.id) move_number
+	  FROM game g
+	  JOIN game_bot gb
+	    ON g.id = gb.game_id
+	  JOIN move m
+	    ON gb.id = m.game_bot_id
+	  WHERE g.game_type_id = $1
+	  AND g.status = $2
+	) o
+	LEFT JOIN (
+	  SELECT
+	    gb2.game_id
+	  , gb2.team
+	  FROM move m
+	  JOIN game_bot gb2
+	    ON m.game_bot_id = gb2.id
+	  WHERE m.winner = TRUE
+	) w
+	  ON o.game_id = w.game_id
+	WHERE o.move_number = 2
+	GROUP BY o.game_state
+	ORDER BY COUNT(*) DESC, o.game_state
+	`, gameType.Id, string(GAME_STATUS_COMPLETE))
+	if err != nil {
+		log.Printf("An error occurred in statistics.GetGameTypeStatistics():5:\n%s\n", err)
+		return stats, err
+	}
+
+	for rows.Next() {
+		var of OpeningFrequency
+		err := rows.Scan(&of.GameState, &of.Record.Played, &of.Record.Won, &of.Record.Drawn)
+		if err != nil {
+			log.Printf("An error occurred in statistics.GetGameTypeStatistics():6:\n%s\n", err)
+			return stats, err
+		}
+		stats.Openings = append(stats.Openings, of)
+	}
+
+	return stats, nil
+}
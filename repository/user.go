@@ -10,10 +10,15 @@ import (
 )
 
 type User struct {
-	Id       int `json:"id"`
-	Name     string
-	Email    string
-	ImageUrl sql.NullString
+	Id               int `json:"id"`
+	Name             string
+	Email            string
+	ImageUrl         sql.NullString
+	AcceptChallenges bool
+	Admin            bool
+	// The user's share of the worker pool relative to other users with moves
+	// waiting to be played.
+	SchedulingWeight int
 }
 
 // Token generator taken from https://stackoverflow.com/questions/22892120/how-to-generate-a-random-string-of-a-fixed-length-in-golang
@@ -45,6 +50,45 @@ func (u *User) Update(name string, imageUrl string) error {
 	return nil
 }
 
+// SetAcceptChallenges sets whether other users may challenge this users bots to
+// games.
+func (u *User) SetAcceptChallenges(accept bool) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE merknera_user
+	SET accept_challenges = $1
+	WHERE id = $2
+	`, accept, u.Id)
+	if err != nil {
+		log.Printf("An error occurred in user.SetAcceptChallenges():\n%s\n", err)
+		return err
+	}
+
+	u.AcceptChallenges = accept
+
+	return nil
+}
+
+// SetSchedulingWeight sets the user's share of the worker pool. A user with a
+// weight of 2 may have twice as many moves being played as a user with a weight
+// of 1 when both have moves waiting.
+func (u *User) SetSchedulingWeight(weight int) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE merknera_user
+	SET scheduling_weight = $1
+	WHERE id = $2
+	`, weight, u.Id)
+	if err != nil {
+		log.Printf("An error occurred in user.SetSchedulingWeight():\n%s\n", err)
+		return err
+	}
+
+	u.SchedulingWeight = weight
+
+	return nil
+}
+
 var src = rand.NewSource(time.Now().UnixNano())
 
 func generateToken(n int) string {
@@ -158,6 +202,8 @@ func (u *User) ListBots() ([]Bot, error) {
 	, b.description
 	, b.status
 	, b.last_online_datetime
+	, b.stage
+	, b.sandbox_opponent
 	FROM bot b
 	WHERE b.user_id = $1
 	AND b.status != $2
@@ -171,12 +217,14 @@ func (u *User) ListBots() ([]Bot, error) {
 	for rows.Next() {
 		var bot Bot
 		var status string
-		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime)
+		var stage string
+		err := rows.Scan(&bot.Id, &bot.Name, &bot.Version, &bot.gameTypeId, &bot.userId, &bot.RPCEndpoint, &bot.ProgrammingLanguage, &bot.Website, &bot.Description, &status, &bot.LastOnlineDateTime, &stage, &bot.SandboxOpponent)
 		if err != nil {
 			log.Printf("An error occurred in user.ListBots():\n%s\n", err)
 			return botList, err
 		}
 		bot.Status = BotStatus(status)
+		bot.Stage = BotStage(stage)
 		botList = append(botList, bot)
 	}
 
@@ -219,9 +267,12 @@ func GetUserById(id int) (User, error) {
 	, name
 	, email
 	, image_url
+	, accept_challenges
+	, admin
+	, scheduling_weight
 	FROM merknera_user
 	WHERE id = $1
-	`, id).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl)
+	`, id).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl, &user.AcceptChallenges, &user.Admin, &user.SchedulingWeight)
 	if err != nil {
 		log.Printf("An error occurred in user.GetUserById():\n%s\n", err)
 		return User{}, err
@@ -239,9 +290,12 @@ func GetUserByEmail(email string) (User, error) {
 	, name
 	, email
 	, image_url
+	, accept_challenges
+	, admin
+	, scheduling_weight
 	FROM merknera_user
 	WHERE email = $1
-	`, email).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl)
+	`, email).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl, &user.AcceptChallenges, &user.Admin, &user.SchedulingWeight)
 	if err != nil {
 		log.Printf("An error occurred in user.GetUserByEmail():\n%s\n", err)
 		return User{}, err
@@ -259,12 +313,15 @@ func GetUserByToken(token string) (User, error) {
 	, mu.name
 	, mu.email
 	, mu.image_url
+	, mu.accept_challenges
+	, mu.admin
+	, mu.scheduling_weight
 	FROM merknera_user_token mut
 	JOIN merknera_user mu
 	  ON mut.merknera_user_id = mu.id
 	WHERE mut.token = $1
 	  AND mut.status = $2
-	`, token, string(USER_TOKEN_STATUS_CURRENT)).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl)
+	`, token, string(USER_TOKEN_STATUS_CURRENT)).Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl, &user.AcceptChallenges, &user.Admin, &user.SchedulingWeight)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			em := fmt.Sprintf("User with Token \"%s\" is not currently registered with Merknera", token)
@@ -285,6 +342,9 @@ func ListUsers() ([]User, error) {
 	, u.name
 	, u.email
 	, u.image_url
+	, u.accept_challenges
+	, u.admin
+	, u.scheduling_weight
 	FROM merknera_user u
 	ORDER BY u.name
 	`)
@@ -296,7 +356,7 @@ func ListUsers() ([]User, error) {
 	var userList []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl)
+		err := rows.Scan(&user.Id, &user.Name, &user.Email, &user.ImageUrl, &user.AcceptChallenges, &user.Admin, &user.SchedulingWeight)
 		if err != nil {
 			log.Printf("An error occurred in user.ListUsers():2:\n%s\n", err)
 			return userList, err
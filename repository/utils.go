@@ -1,12 +1,18 @@
 package repository
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	_ "github.com/lib/pq"
+	"github.com/mleonard87/merknera/metrics"
 )
 
 const (
@@ -16,6 +22,19 @@ const (
 	ENVVAR_DBNAME = "MERKNERA_DBNAME"
 )
 
+// Advisory lock classes, passed as the first key to pg_advisory_xact_lock so
+// that locks taken for different reasons on the same id don't collide.
+const (
+	// Held whilst claiming a move for the bot with the id of the second key.
+	ADVISORY_LOCK_BOT_CLAIM = 1
+	// Held whilst issuing a challenge for the user with the id of the second
+	// key.
+	ADVISORY_LOCK_USER_CHALLENGE = 2
+	// Held whilst scheduling a round of ladder games, the second key is always
+	// 0.
+	ADVISORY_LOCK_LADDER = 3
+)
+
 var DB *sql.DB
 
 func init() {
@@ -34,6 +53,120 @@ func init() {
 	}
 }
 
-func GetDB() *sql.DB {
-	return DB
+var dbQueryDuration = metrics.NewHistogram(
+	"merknera_db_query_duration_seconds",
+	"Time taken by database queries, by the repository function making them.",
+	metrics.DefaultBuckets,
+	"function",
+)
+
+// Database wraps the connection pool so that the time taken by each query is
+// recorded.
+type Database struct {
+	*sql.DB
+}
+
+// Tx wraps a transaction so that the time taken by each query is recorded.
+type Tx struct {
+	*sql.Tx
+}
+
+// querier is implemented by both Database and Tx so that a query can be made on
+// its own or as part of a larger transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func GetDB() *Database {
+	return &Database{DB}
+}
+
+func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(time.Now())
+	return db.DB.Exec(query, args...)
+}
+
+func (db *Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(time.Now())
+	return db.DB.Query(query, args...)
+}
+
+func (db *Database) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(time.Now())
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db *Database) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx}, nil
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(time.Now())
+	return tx.Tx.Exec(query, args...)
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(time.Now())
+	return tx.Tx.Query(query, args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(time.Now())
+	return tx.Tx.QueryRow(query, args...)
+}
+
+// observeQuery records the time since start against the repository function
+// that made the query. It must be deferred directly from the query method.
+func observeQuery(start time.Time) {
+	function := "unknown"
+	if pc, _, _, ok := runtime.Caller(2); ok {
+		if f := runtime.FuncForPC(pc); f != nil {
+			function = f.Name()
+			if i := strings.LastIndex(function, "/"); i >= 0 {
+				function = function[i+1:]
+			}
+		}
+	}
+
+	dbQueryDuration.ObserveDuration(time.Since(start), function)
+}
+
+// truncate shortens s to at most max bytes without splitting a character.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+
+	return s[:max]
+}
+
+// sanitizeText makes s safe to store in a text column, replacing invalid UTF-8
+// and removing NUL bytes, neither of which Postgres will accept.
+func sanitizeText(s string) string {
+	if utf8.ValidString(s) && strings.IndexByte(s, 0) < 0 {
+		return s
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == 0 {
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
 }
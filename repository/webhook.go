@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook is a URL that a user has asked to be sent events about their bots.
+type Webhook struct {
+	Id              int
+	userId          int
+	URL             string
+	Secret          string
+	CreatedDateTime time.Time
+}
+
+type WebhookDelivery struct {
+	Id                  int
+	webhookId           int
+	Event               string
+	Payload             string
+	Status              WebhookDeliveryStatus
+	Attempts            int
+	ResponseStatus      sql.NullInt64
+	Error               sql.NullString
+	NextAttemptDateTime time.Time
+	LastAttemptDateTime pq.NullTime
+	CreatedDateTime     time.Time
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WEBHOOK_DELIVERY_STATUS_PENDING   WebhookDeliveryStatus = "PENDING"
+	WEBHOOK_DELIVERY_STATUS_DELIVERED WebhookDeliveryStatus = "DELIVERED"
+	// A delivery is failed once it has used up all of its attempts.
+	WEBHOOK_DELIVERY_STATUS_FAILED WebhookDeliveryStatus = "FAILED"
+)
+
+func (w *Webhook) User() (User, error) {
+	return GetUserById(w.userId)
+}
+
+func (u *User) CreateWebhook(url string, secret string) (Webhook, error) {
+	var webhookId int
+	db := GetDB()
+	err := db.QueryRow(`
+	INSERT INTO webhook (
+	  merknera_user_id
+	, url
+	, secret
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	) RETURNING id
+	`, u.Id, url, secret).Scan(&webhookId)
+	if err != nil {
+		log.Printf("An error occurred in webhook.CreateWebhook():1:\n%s\n", err)
+		return Webhook{}, err
+	}
+
+	webhook, err := GetWebhookById(webhookId)
+	if err != nil {
+		log.Printf("An error occurred in webhook.CreateWebhook():2:\n%s\n", err)
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// DeleteWebhook deletes one of the user's webhooks along with its delivery
+// history. Webhooks belonging to other users are left alone.
+func (u *User) DeleteWebhook(webhookId int) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	DELETE FROM webhook
+	WHERE id = $1
+	AND merknera_user_id = $2
+	`, webhookId, u.Id)
+	if err != nil {
+		log.Printf("An error occurred in webhook.DeleteWebhook():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func GetWebhookById(id int) (Webhook, error) {
+	var webhook Webhook
+	db := GetDB()
+	err := db.QueryRow(`
+	SELECT
+	  id
+	, merknera_user_id
+	, url
+	, secret
+	, created_datetime
+	FROM webhook
+	WHERE id = $1
+	`, id).Scan(&webhook.Id, &webhook.userId, &webhook.URL, &webhook.Secret, &webhook.CreatedDateTime)
+	if err != nil {
+		log.Printf("An error occurred in webhook.GetWebhookById():\n%s\n", err)
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (u *User) ListWebhooks() ([]Webhook, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  id
+	, merknera_user_id
+	, url
+	, secret
+	, created_datetime
+	FROM webhook
+	WHERE merknera_user_id = $1
+	ORDER BY id
+	`, u.Id)
+	if err != nil {
+		log.Printf("An error occurred in webhook.ListWebhooks():1:\n%s\n", err)
+		return []Webhook{}, err
+	}
+	defer rows.Close()
+
+	var webhookList []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(&webhook.Id, &webhook.userId, &webhook.URL, &webhook.Secret, &webhook.CreatedDateTime)
+		if err != nil {
+			log.Printf("An error occurred in webhook.ListWebhooks():2:\n%s\n", err)
+			return webhookList, err
+		}
+		webhookList = append(webhookList, webhook)
+	}
+
+	return webhookList, nil
+}
+
+// CreateDelivery records an event to be delivered to the webhook. It is sent by
+// the next check for due deliveries.
+func (w *Webhook) CreateDelivery(event string, payload string) error {
+	db := GetDB()
+	_, err := db.Exec(`
+	INSERT INTO webhook_delivery (
+	  webhook_id
+	, event
+	, payload
+	) VALUES (
+	  $1
+	, $2
+	, $3
+	)
+	`, w.Id, event, payload)
+	if err != nil {
+		log.Printf("An error occurred in webhook.CreateDelivery():\n%s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimWebhookDelivery takes the oldest pending delivery that is due and pushes
+// its next attempt back by the lease so that no other worker node sends it at
+// the same time. If there is no delivery due sql.ErrNoRows is returned.
+func ClaimWebhookDelivery(lease time.Duration) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var status string
+	db := GetDB()
+	err := db.QueryRow(`
+	UPDATE webhook_delivery
+	SET next_attempt_datetime = now() + $1 * INTERVAL '1 second'
+	WHERE id = (
+	  SELECT wd.id
+	  FROM webhook_delivery wd
+	  WHERE wd.status = $2
+	  AND wd.next_attempt_datetime <= now()
+	  ORDER BY wd.next_attempt_datetime
+	  LIMIT 1
+	  FOR UPDATE SKIP LOCKED
+	)
+	RETURNING
+	  id
+	, webhook_id
+	, event
+	, payload
+	, status
+	, attempts
+	, response_status
+	, error
+	, next_attempt_datetime
+	, last_attempt_datetime
+	, created_datetime
+	`, lease.Seconds(), string(WEBHOOK_DELIVERY_STATUS_PENDING)).Scan(&d.Id, &d.webhookId, &d.Event, &d.Payload, &status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.NextAttemptDateTime, &d.LastAttemptDateTime, &d.CreatedDateTime)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("An error occurred in webhook.ClaimWebhookDelivery():\n%s\n", err)
+		}
+		return WebhookDelivery{}, err
+	}
+	d.Status = WebhookDeliveryStatus(status)
+
+	return d, nil
+}
+
+func (d *WebhookDelivery) Webhook() (Webhook, error) {
+	return GetWebhookById(d.webhookId)
+}
+
+// RecordAttempt stores the outcome of an attempt at sending the delivery. If
+// nextAttempt is nil the delivery won't be tried again, so it is marked as
+// delivered if the attempt succeeded or as failed if it didn't.
+func (d *WebhookDelivery) RecordAttempt(responseStatus int, attemptErr error, nextAttempt *time.Time) error {
+	status := WEBHOOK_DELIVERY_STATUS_PENDING
+	if nextAttempt == nil {
+		if attemptErr == nil {
+			status = WEBHOOK_DELIVERY_STATUS_DELIVERED
+		} else {
+			status = WEBHOOK_DELIVERY_STATUS_FAILED
+		}
+		now := time.Now()
+		nextAttempt = &now
+	}
+
+	var rs sql.NullInt64
+	if responseStatus > 0 {
+		rs = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+
+	var errorMessage sql.NullString
+	if attemptErr != nil {
+		errorMessage = sql.NullString{String: truncate(sanitizeText(attemptErr.Error()), 1000), Valid: true}
+	}
+
+	db := GetDB()
+	_, err := db.Exec(`
+	UPDATE webhook_delivery
+	SET
+	  status = $1
+	, attempts = attempts + 1
+	, response_status = $2
+	, error = $3
+	, next_attempt_datetime = $4
+	, last_attempt_datetime = now()
+	WHERE id = $5
+	`, string(status), rs, errorMessage, nextAttempt.UTC(), d.Id)
+	if err != nil {
+		log.Printf("An error occurred in webhook.RecordAttempt():\n%s\n", err)
+		return err
+	}
+
+	d.Status = status
+	d.Attempts++
+
+	return nil
+}
+
+// Deliveries returns the most recent deliveries to the webhook, newest first.
+func (w *Webhook) Deliveries(limit int) ([]WebhookDelivery, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  id
+	, webhook_id
+	, event
+	, payload
+	, status
+	, attempts
+	, response_status
+	, error
+	, next_attempt_datetime
+	, last_attempt_datetime
+	, created_datetime
+	FROM webhook_delivery
+	WHERE webhook_id = $1
+	ORDER BY id DESC
+	LIMIT $2
+	`, w.Id, limit)
+	if err != nil {
+		log.Printf("An error occurred in webhook.Deliveries():1:\n%s\n", err)
+		return []WebhookDelivery{}, err
+	}
+	defer rows.Close()
+
+	var deliveryList []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var status string
+		err := rows.Scan(&d.Id, &d.webhookId, &d.Event, &d.Payload, &status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.NextAttemptDateTime, &d.LastAttemptDateTime, &d.CreatedDateTime)
+		if err != nil {
+			log.Printf("An error occurred in webhook.Deliveries():2:\n%s\n", err)
+			return deliveryList, err
+		}
+		d.Status = WebhookDeliveryStatus(status)
+		deliveryList = append(deliveryList, d)
+	}
+
+	return deliveryList, nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// WorkerNode is a Merknera process playing moves. Several nodes may share one
+// database, each claiming moves from the move job table.
+type WorkerNode struct {
+	Id                int
+	Hostname          string
+	Pid               int
+	Status            WorkerNodeStatus
+	StartedDateTime   time.Time
+	HeartbeatDateTime time.Time
+}
+
+type WorkerNodeStatus string
+
+const (
+	WORKER_NODE_STATUS_ACTIVE WorkerNodeStatus = "ACTIVE"
+	// A node is stopped once it has shut down cleanly.
+	WORKER_NODE_STATUS_STOPPED WorkerNodeStatus = "STOPPED"
+	// A node is dead once it has stopped sending heartbeats. Any moves it held
+	// are given to other nodes.
+	WORKER_NODE_STATUS_DEAD WorkerNodeStatus = "DEAD"
+)
+
+// ErrWorkerNodeNotActive is returned by Heartbeat once the node is no longer
+// active, e.g. because it missed too many heartbeats and was declared dead.
+var ErrWorkerNodeNotActive = errors.New("The worker node is no longer active.")
+
+func RegisterWorkerNode(hostname string, pid int) (WorkerNode, error) {
+	var node WorkerNode
+	var status string
+	db := GetDB()
+	err := db.QueryRow(`
+	INSERT INTO worker_node (
+	  hostname
+	, pid
+	) VALUES (
+	  $1
+	, $2
+	) RETURNING
+	  id
+	, hostname
+	, pid
+	, status
+	, started_datetime
+	, heartbeat_datetime
+	`, hostname, pid).Scan(&node.Id, &node.Hostname, &node.Pid, &status, &node.StartedDateTime, &node.HeartbeatDateTime)
+	if err != nil {
+		log.Printf("An error occurred in worker_node.RegisterWorkerNode():\n%s\n", err)
+		return WorkerNode{}, err
+	}
+	node.Status = WorkerNodeStatus(status)
+
+	return node, nil
+}
+
+// Heartbeat records that the node is still alive and extends the lease on every
+// move it is currently playing. A node that has been declared dead has had its
+// moves given to other nodes so it isn't brought back, ErrWorkerNodeNotActive
+// is returned instead.
+func (n *WorkerNode) Heartbeat(lease time.Duration) error {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Heartbeat():1:\n%s\n", err)
+		return err
+	}
+
+	res, err := tx.Exec(`
+	UPDATE worker_node
+	SET heartbeat_datetime = now()
+	WHERE id = $1
+	AND status = $2
+	`, n.Id, string(WORKER_NODE_STATUS_ACTIVE))
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Heartbeat():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Heartbeat():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+	if updated == 0 {
+		tx.Rollback()
+		return ErrWorkerNodeNotActive
+	}
+
+	_, err = tx.Exec(`
+	UPDATE move_job
+	SET lease_expires_datetime = now() + $1 * INTERVAL '1 second'
+	WHERE worker_node_id = $2
+	AND status = $3
+	`, lease.Seconds(), n.Id, string(MOVE_JOB_STATUS_RUNNING))
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Heartbeat():4:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Stop marks the node as stopped and puts any moves it is still playing back in
+// the queue so that they can be resumed by another node. As the moves were
+// interrupted rather than failed the attempt is not counted against them.
+func (n *WorkerNode) Stop() error {
+	db := GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Stop():1:\n%s\n", err)
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE move_job
+	SET
+	  status = $1
+	, worker_node_id = NULL
+	, lease_expires_datetime = NULL
+	, attempts = GREATEST(attempts - 1, 0)
+	WHERE worker_node_id = $2
+	AND status = $3
+	`, string(MOVE_JOB_STATUS_QUEUED), n.Id, string(MOVE_JOB_STATUS_RUNNING))
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Stop():2:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE worker_node
+	SET status = $1
+	WHERE id = $2
+	`, string(WORKER_NODE_STATUS_STOPPED), n.Id)
+	if err != nil {
+		log.Printf("An error occurred in worker_node.Stop():3:\n%s\n", err)
+		tx.Rollback()
+		return err
+	}
+
+	n.Status = WORKER_NODE_STATUS_STOPPED
+
+	return tx.Commit()
+}
+
+// ReapDeadWorkerNodes marks every node that hasn't sent a heartbeat within the
+// timeout as dead and puts the moves they were playing back in the queue. The
+// number of moves requeued is returned.
+func ReapDeadWorkerNodes(timeout time.Duration) (int, error) {
+	db := GetDB()
+	res, err := db.Exec(`
+	WITH dead AS (
+	  UPDATE worker_node
+	  SET status = $1
+	  WHERE status = $2
+	  AND heartbeat_datetime < now() - $3 * INTERVAL '1 second'
+	  RETURNING id
+	)
+	UPDATE move_job
+	SET
+	  status = $4
+	, worker_node_id = NULL
+	, lease_expires_datetime = NULL
+	WHERE worker_node_id IN (SELECT id FROM dead)
+	AND status = $5
+	`, string(WORKER_NODE_STATUS_DEAD), string(WORKER_NODE_STATUS_ACTIVE), timeout.Seconds(), string(MOVE_JOB_STATUS_QUEUED), string(MOVE_JOB_STATUS_RUNNING))
+	if err != nil {
+		log.Printf("An error occurred in worker_node.ReapDeadWorkerNodes():1:\n%s\n", err)
+		return 0, err
+	}
+
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("An error occurred in worker_node.ReapDeadWorkerNodes():2:\n%s\n", err)
+		return 0, err
+	}
+
+	return int(requeued), nil
+}
+
+func ListWorkerNodes() ([]WorkerNode, error) {
+	db := GetDB()
+	rows, err := db.Query(`
+	SELECT
+	  id
+	, hostname
+	, pid
+	, status
+	, started_datetime
+	, heartbeat_datetime
+	FROM worker_node
+	ORDER BY id DESC
+	`)
+	if err != nil {
+		log.Printf("An error occurred in worker_node.ListWorkerNodes():1:\n%s\n", err)
+		return []WorkerNode{}, err
+	}
+
+	var nodeList []WorkerNode
+	for rows.Next() {
+		var node WorkerNode
+		var status string
+		err := rows.Scan(&node.Id, &node.Hostname, &node.Pid, &status, &node.StartedDateTime, &node.HeartbeatDateTime)
+		if err != nil {
+			log.Printf("An error occurred in worker_node.ListWorkerNodes():2:\n%s\n", err)
+			return nodeList, err
+		}
+		node.Status = WorkerNodeStatus(status)
+		nodeList = append(nodeList, node)
+	}
+
+	return nodeList, nil
+}
@@ -0,0 +1,163 @@
+package rpchelper
+
+import (
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ENVVAR_RPC_CONNECT_TIMEOUT  = "MERKNERA_RPC_CONNECT_TIMEOUT"
+	ENVVAR_RPC_RESPONSE_TIMEOUT = "MERKNERA_RPC_RESPONSE_TIMEOUT"
+	ENVVAR_RPC_RETRIES          = "MERKNERA_RPC_RETRIES"
+	ENVVAR_RPC_BACKOFF          = "MERKNERA_RPC_BACKOFF"
+	ENVVAR_RPC_MAX_BACKOFF      = "MERKNERA_RPC_MAX_BACKOFF"
+
+	// Timeouts are in seconds.
+	DEFAULT_RPC_CONNECT_TIMEOUT  = 5
+	DEFAULT_RPC_RESPONSE_TIMEOUT = 30
+	DEFAULT_RPC_RETRIES          = 2
+	// Backoffs are in milliseconds.
+	DEFAULT_RPC_BACKOFF     = 500
+	DEFAULT_RPC_MAX_BACKOFF = 5000
+)
+
+// Policy controls how long an RPC call to a bot may take and how it is retried
+// if the bot can't be reached.
+type Policy struct {
+	// ConnectTimeout is how long to wait for a connection to the bot.
+	ConnectTimeout time.Duration
+	// ResponseTimeout is how long to wait for the bot to respond once the
+	// request has been sent.
+	ResponseTimeout time.Duration
+	// Retries is the number of times a call is retried after a transport
+	// failure, so a call is attempted at most Retries + 1 times.
+	Retries int
+	// Backoff is the delay before the first retry. It doubles for each
+	// subsequent retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// Attempt records a single attempt at an RPC call.
+type Attempt struct {
+	Method        string
+	Number        int
+	StartDateTime time.Time
+	Duration      time.Duration
+	// Err is nil if the attempt succeeded.
+	Err error
+}
+
+// AttemptFunc is called after every attempt at an RPC call.
+type AttemptFunc func(Attempt)
+
+var defaultPolicy *Policy
+var defaultPolicyOnce sync.Once
+
+// DefaultPolicy returns the policy configured through the environment.
+func DefaultPolicy() *Policy {
+	defaultPolicyOnce.Do(func() {
+		defaultPolicy = &Policy{
+			ConnectTimeout:  time.Duration(envInt(ENVVAR_RPC_CONNECT_TIMEOUT, DEFAULT_RPC_CONNECT_TIMEOUT, 1)) * time.Second,
+			ResponseTimeout: time.Duration(envInt(ENVVAR_RPC_RESPONSE_TIMEOUT, DEFAULT_RPC_RESPONSE_TIMEOUT, 1)) * time.Second,
+			Retries:         envInt(ENVVAR_RPC_RETRIES, DEFAULT_RPC_RETRIES, 0),
+			Backoff:         time.Duration(envInt(ENVVAR_RPC_BACKOFF, DEFAULT_RPC_BACKOFF, 0)) * time.Millisecond,
+			MaxBackoff:      time.Duration(envInt(ENVVAR_RPC_MAX_BACKOFF, DEFAULT_RPC_MAX_BACKOFF, 0)) * time.Millisecond,
+		}
+	})
+
+	return defaultPolicy
+}
+
+func envInt(name string, defaultValue int, min int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i < min {
+		log.Printf("Invalid value \"%s\" for %s, using the default of %d\n", v, name, defaultValue)
+		return defaultValue
+	}
+
+	return i
+}
+
+// httpClient returns a client shared by all calls made with this policy so
+// that connections to bots can be reused.
+func (p *Policy) httpClient() *http.Client {
+	p.clientOnce.Do(func() {
+		dialer := &net.Dialer{
+			Timeout: p.ConnectTimeout,
+		}
+		p.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				Dial:                  dialer.Dial,
+				TLSHandshakeTimeout:   p.ConnectTimeout,
+				ResponseHeaderTimeout: p.ResponseTimeout,
+			},
+			// Covers reading the body as well as waiting for the headers.
+			Timeout: p.ConnectTimeout + p.ResponseTimeout,
+		}
+	})
+
+	return p.client
+}
+
+// backoff returns how long to wait before the given retry. Jitter is added so
+// that bots that failed together aren't all retried at the same moment.
+func (p *Policy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// do runs the attempt function until it succeeds, fails with an error that
+// shouldn't be retried or the retries are used up.
+func (p *Policy) do(method string, onAttempt AttemptFunc, attempt func() error) error {
+	var err error
+	for n := 1; n <= p.Retries+1; n++ {
+		if n > 1 {
+			time.Sleep(p.backoff(n - 1))
+		}
+
+		start := time.Now()
+		err = attempt()
+		if onAttempt != nil {
+			onAttempt(Attempt{
+				Method:        method,
+				Number:        n,
+				StartDateTime: start,
+				Duration:      time.Since(start),
+				Err:           err,
+			})
+		}
+
+		if err == nil || !IsTransportError(err) {
+			return err
+		}
+	}
+
+	return err
+}
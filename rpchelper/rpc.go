@@ -3,12 +3,9 @@ package rpchelper
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"time"
 )
 
 const (
@@ -29,79 +26,98 @@ type RPCServerResponse struct {
 	Id             int         `json:"id"`
 }
 
-func Ping(rpcEndpoint string) error {
-	rcr := new(RPCClientRequest)
-	rcr.JsonRpcVersion = "2.0"
-	rcr.Id = 1
-	rcr.Method = PING_METHOD_NAME
-
-	jsonBody, err := json.Marshal(*rcr)
-	if err != nil {
-		return err
-	}
+// TransportError is returned when a bot couldn't be reached or didn't respond
+// in time. Calls that fail with a TransportError are retried.
+type TransportError struct {
+	Err error
+}
 
-	timeout := time.Duration(30 * time.Second)
-	client := &http.Client{
-		Timeout: timeout,
-	}
+func (e TransportError) Error() string {
+	return e.Err.Error()
+}
 
-	req, err := http.NewRequest("POST", rpcEndpoint, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return err
-	}
-	req.Header.Add("Content-Type", "application/json")
+// ProtocolError is returned when a bot responded but the response wasn't
+// valid. Calls that fail with a ProtocolError are not retried as the bot will
+// most likely respond in the same way again.
+type ProtocolError struct {
+	Err error
+	// The body of the response, if there was one.
+	Body []byte
+}
 
-	res, err := client.Do(req)
-	if err != nil {
-		return err
-	}
+func (e ProtocolError) Error() string {
+	return e.Err.Error()
+}
 
-	if res.StatusCode != http.StatusOK {
-		em := fmt.Sprintf("Response status not OK (200). Received %d", res.Status)
-		return errors.New(em)
-	}
+// IsTransportError returns true if the error means the bot couldn't be reached.
+func IsTransportError(err error) bool {
+	_, ok := err.(TransportError)
+	return ok
+}
 
-	return nil
+func Ping(rpcEndpoint string) error {
+	return DefaultPolicy().Ping(rpcEndpoint, nil)
 }
 
 func Call(rpcEndpoint string, method string, args interface{}, reply *RPCServerResponse) error {
-	rcr := new(RPCClientRequest)
-	rcr.JsonRpcVersion = "2.0"
-	rcr.Id = 1
-	rcr.Method = method
-	rcr.Params = args
-
-	jsonBody, err := json.Marshal(*rcr)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return DefaultPolicy().Call(rpcEndpoint, method, args, reply, nil)
+}
 
-	client := &http.Client{}
+func Notify(rpcEndpoint string, method string, args interface{}) error {
+	return DefaultPolicy().Notify(rpcEndpoint, method, args, nil)
+}
 
-	req, err := http.NewRequest("POST", rpcEndpoint, bytes.NewBuffer(jsonBody))
+func (p *Policy) Ping(rpcEndpoint string, onAttempt AttemptFunc) error {
+	jsonBody, err := marshalRequest(PING_METHOD_NAME, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
 
-	res, err := client.Do(req)
+	return p.do(PING_METHOD_NAME, onAttempt, func() error {
+		_, err := p.post(rpcEndpoint, jsonBody)
+		return err
+	})
+}
+
+func (p *Policy) Call(rpcEndpoint string, method string, args interface{}, reply *RPCServerResponse, onAttempt AttemptFunc) error {
+	jsonBody, err := marshalRequest(method, args)
 	if err != nil {
 		return err
 	}
 
-	defer res.Body.Close()
-	nextMoveResponse, err := ioutil.ReadAll(res.Body)
+	return p.do(method, onAttempt, func() error {
+		body, err := p.post(rpcEndpoint, jsonBody)
+		if err != nil {
+			return err
+		}
 
-	err = json.Unmarshal(nextMoveResponse, &reply)
+		err = json.Unmarshal(body, reply)
+		if err != nil {
+			return ProtocolError{Err: fmt.Errorf("Could not parse the response to %s: %s", method, err), Body: body}
+		}
+
+		// The bot responded but reported that it couldn't make the call.
+		if reply.Error != "" {
+			return ProtocolError{Err: fmt.Errorf("The response to %s was an error: %s", method, reply.Error), Body: body}
+		}
+
+		return nil
+	})
+}
+
+func (p *Policy) Notify(rpcEndpoint string, method string, args interface{}, onAttempt AttemptFunc) error {
+	jsonBody, err := marshalRequest(method, args)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return p.do(method, onAttempt, func() error {
+		_, err := p.post(rpcEndpoint, jsonBody)
+		return err
+	})
 }
 
-func Notify(rpcEndpoint string, method string, args interface{}) error {
+func marshalRequest(method string, args interface{}) ([]byte, error) {
 	rcr := new(RPCClientRequest)
 	rcr.JsonRpcVersion = "2.0"
 	rcr.Id = 1
@@ -110,19 +126,39 @@ func Notify(rpcEndpoint string, method string, args interface{}) error {
 
 	jsonBody, err := json.Marshal(*rcr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, ProtocolError{Err: err}
 	}
 
-	client := &http.Client{}
+	return jsonBody, nil
+}
 
+// post sends a single request to the bot and returns the response body.
+func (p *Policy) post(rpcEndpoint string, jsonBody []byte) ([]byte, error) {
 	req, err := http.NewRequest("POST", rpcEndpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		log.Fatal(err)
+		return nil, ProtocolError{Err: err}
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 
-	client.Do(req)
+	res, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, TransportError{err}
+	}
+	defer res.Body.Close()
 
-	return nil
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, TransportError{err}
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		// The bot, or something in front of it, is temporarily unavailable.
+		return nil, TransportError{fmt.Errorf("Response status not OK (200). Received %s", res.Status)}
+	default:
+		return nil, ProtocolError{Err: fmt.Errorf("Response status not OK (200). Received %s", res.Status), Body: body}
+	}
 }
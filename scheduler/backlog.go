@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_BACKLOG_INTERVAL     = "MERKNERA_BACKLOG_INTERVAL"
+	ENVVAR_BACKLOG_RELEASE_RATE = "MERKNERA_BACKLOG_RELEASE_RATE"
+	ENVVAR_BACKLOG_CONCURRENCY  = "MERKNERA_BACKLOG_CONCURRENCY"
+
+	// The default number of seconds between each release of pairings from the
+	// backlog.
+	DEFAULT_BACKLOG_INTERVAL = 5
+	// The default maximum number of pairings released from the backlog each
+	// interval.
+	DEFAULT_BACKLOG_RELEASE_RATE = 10
+	// The default maximum number of games that may be incomplete at once.
+	// Pairings are held in the backlog until there is room for their games.
+	DEFAULT_BACKLOG_CONCURRENCY = 20
+)
+
+// StartBacklogScheduler starts a background goroutine that periodically
+// releases pairings from the backlog, creating their games, at most
+// MERKNERA_BACKLOG_RELEASE_RATE at a time and only whilst fewer than
+// MERKNERA_BACKLOG_CONCURRENCY games are incomplete.
+func StartBacklogScheduler() {
+	interval := envInt(ENVVAR_BACKLOG_INTERVAL, DEFAULT_BACKLOG_INTERVAL)
+	if interval == 0 {
+		interval = DEFAULT_BACKLOG_INTERVAL
+	}
+
+	fmt.Println("Starting backlog scheduler")
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := releaseBacklogGames()
+				if err != nil {
+					log.Printf("[backlog] Error releasing games from the backlog:\n%v\n", err)
+				}
+			case <-stopSchedulers:
+				fmt.Println("Backlog scheduler stopping")
+				return
+			}
+		}
+	}()
+}
+
+func releaseBacklogGames() error {
+	active, err := repository.CountActiveGames()
+	if err != nil {
+		return err
+	}
+
+	capacity := envInt(ENVVAR_BACKLOG_CONCURRENCY, DEFAULT_BACKLOG_CONCURRENCY) - active
+	rate := envInt(ENVVAR_BACKLOG_RELEASE_RATE, DEFAULT_BACKLOG_RELEASE_RATE)
+	if rate < capacity {
+		capacity = rate
+	}
+	if capacity <= 0 {
+		return nil
+	}
+
+	pairingList, err := repository.ListBacklogPairings(capacity)
+	if err != nil {
+		return err
+	}
+
+	// A pairing that can't be released is left in the backlog and retried next
+	// time without holding up the rest.
+	for _, bp := range pairingList {
+		err = releasePairing(bp)
+		if err != nil {
+			log.Printf("[backlog] Error releasing pairing %d from the backlog:\n%v\n", bp.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// releasePairing creates the game for a pairing held in the backlog and queues
+// its first move. The game is created in the same transaction that marks the
+// pairing as released so that each pairing has exactly one game, even with more
+// than one worker node releasing pairings.
+func releasePairing(bp repository.BacklogPairing) error {
+	gameManager, err := games.GetGameManager(bp.GameType)
+	if err != nil {
+		return err
+	}
+
+	tx, err := bp.BeginRelease()
+	if err == repository.ErrBacklogPairingReleased {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	game, err := gameManager.CreateTeamGame(tx, bp.Teams, bp.Kind, bp.Rated)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = bp.FinishRelease(tx, game)
+	if err != nil {
+		return err
+	}
+	events.Publish(events.GameCreated{Game: game})
+
+	kindName := strings.ToLower(string(bp.Kind))
+	for t, team := range bp.Teams {
+		for _, b := range team {
+			if len(team) == 1 {
+				b.Logf("Scheduled %s game with %s. You are player %d (gameId: %d)", kindName, opponentNames(bp.Teams, t), t+1, game.Id)
+			} else {
+				b.Logf("Scheduled %s game with %s. You are on team %d (gameId: %d)", kindName, opponentNames(bp.Teams, t), t+1, game.Id)
+			}
+		}
+	}
+
+	gameMove, err := game.NextGameMove()
+	if err != nil {
+		return err
+	}
+	gameworker.QueueGameMove(gameMove)
+
+	return nil
+}
+
+// opponentNames lists the bots on every team other than the given one.
+func opponentNames(teams [][]repository.Bot, team int) string {
+	var names []string
+	for t, bots := range teams {
+		if t == team {
+			continue
+		}
+		for _, b := range bots {
+			names = append(names, b.Name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
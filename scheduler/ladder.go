@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_LADDER_INTERVAL      = "MERKNERA_LADDER_INTERVAL"
+	ENVVAR_MAX_CONCURRENT_GAMES = "MERKNERA_MAX_CONCURRENT_GAMES"
+
+	// The default number of seconds between each round of ladder scheduling.
+	// Setting MERKNERA_LADDER_INTERVAL to 0 disables the ladder scheduler.
+	DEFAULT_LADDER_INTERVAL = 60
+	// The default maximum number of games, of any kind, that may be active at
+	// once before the ladder scheduler stops creating new games.
+	DEFAULT_MAX_CONCURRENT_GAMES = 50
+)
+
+func envInt(name string, defaultValue int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return defaultValue
+	}
+
+	return v
+}
+
+// stopSchedulers is closed to stop every scheduler, e.g. on shutdown.
+var stopSchedulers = make(chan bool)
+
+// Stop stops the schedulers creating and releasing games. Any round that is
+// already running is allowed to finish.
+func Stop() {
+	close(stopSchedulers)
+}
+
+func MaxConcurrentGames() int {
+	return envInt(ENVVAR_MAX_CONCURRENT_GAMES, DEFAULT_MAX_CONCURRENT_GAMES)
+}
+
+// StartLadderScheduler starts a background goroutine that periodically creates
+// ladder games between online ranked bots so that the ladder keeps playing
+// without bots having to re-register.
+func StartLadderScheduler() {
+	interval := envInt(ENVVAR_LADDER_INTERVAL, DEFAULT_LADDER_INTERVAL)
+	if interval == 0 {
+		fmt.Println("Ladder scheduler disabled")
+		return
+	}
+
+	fmt.Println("Starting ladder scheduler")
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := scheduleLadderGames()
+				if err != nil {
+					log.Printf("[ladder] Error scheduling ladder games:\n%v\n", err)
+				}
+			case <-stopSchedulers:
+				fmt.Println("Ladder scheduler stopping")
+				return
+			}
+		}
+	}()
+}
+
+// ladderGame is a ladder game that has been created but not yet announced.
+type ladderGame struct {
+	game     repository.Game
+	bot      repository.Bot
+	opponent repository.Bot
+}
+
+// scheduleLadderGames fills the free capacity, up to the global cap on
+// concurrent games, with games between the pairs of bots that have gone the
+// longest without playing each other. Each bot is given at most one new game per
+// round so that the load is spread across the ladder.
+//
+// Every worker node runs the ladder scheduler so a round is scheduled under a
+// lock, with the games created in the same transaction. A node that finds
+// another node already scheduling skips the round, otherwise the same pairs
+// would be given a game by each node.
+func scheduleLadderGames() error {
+	db := repository.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	locked, err := repository.TryLockLadderTx(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !locked {
+		tx.Rollback()
+		return nil
+	}
+
+	created, err := createLadderGames(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, lg := range created {
+		events.Publish(events.GameCreated{Game: lg.game})
+
+		lg.bot.Logf("Scheduled ladder game with %s (gameId: %d)", lg.opponent.Name, lg.game.Id)
+		lg.opponent.Logf("Scheduled ladder game with %s (gameId: %d)", lg.bot.Name, lg.game.Id)
+
+		gameMove, err := lg.game.NextGameMove()
+		if err != nil {
+			return err
+		}
+		gameworker.QueueGameMove(gameMove)
+	}
+
+	return nil
+}
+
+// createLadderGames creates the games for a round of ladder scheduling as part
+// of the transaction, which must hold the ladder lock.
+func createLadderGames(tx *repository.Tx) ([]ladderGame, error) {
+	active, err := repository.CountActiveGames()
+	if err != nil {
+		return []ladderGame{}, err
+	}
+
+	capacity := MaxConcurrentGames() - active
+	if capacity <= 0 {
+		return []ladderGame{}, nil
+	}
+
+	gameTypes, err := repository.ListGameTypes()
+	if err != nil {
+		return []ladderGame{}, err
+	}
+
+	var created []ladderGame
+	for _, gt := range gameTypes {
+		if capacity <= 0 {
+			break
+		}
+
+		gameManager, err := games.GetGameManager(gt)
+		if err != nil {
+			// Game types that are no longer registered can't be scheduled.
+			continue
+		}
+
+		// The ladder pairs bots one against one so team games aren't
+		// scheduled, they are played through the backlog instead.
+		if gameManager.TeamSize() != 1 {
+			continue
+		}
+
+		pairings, err := repository.ListLeastRecentlyPlayedPairings(gt, capacity)
+		if err != nil {
+			return []ladderGame{}, err
+		}
+
+		scheduled := make(map[int]bool)
+		for _, lp := range pairings {
+			if capacity <= 0 {
+				break
+			}
+
+			bot, err := lp.Bot()
+			if err != nil {
+				return []ladderGame{}, err
+			}
+
+			opponent, err := lp.Opponent()
+			if err != nil {
+				return []ladderGame{}, err
+			}
+
+			if scheduled[bot.Id] || scheduled[opponent.Id] {
+				continue
+			}
+
+			players := []repository.Bot{bot, opponent}
+			if rand.Intn(2) == 1 {
+				players = []repository.Bot{opponent, bot}
+			}
+
+			game, err := gameManager.CreateGame(tx, players, repository.GAME_KIND_LADDER, true)
+			if err != nil {
+				return []ladderGame{}, err
+			}
+			created = append(created, ladderGame{game: game, bot: bot, opponent: opponent})
+
+			scheduled[bot.Id] = true
+			scheduled[opponent.Id] = true
+			capacity--
+		}
+	}
+
+	return created, nil
+}
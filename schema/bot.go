@@ -3,6 +3,7 @@ package schema
 import (
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/relay"
+	"github.com/mleonard87/merknera/gameworker"
 	"github.com/mleonard87/merknera/repository"
 )
 
@@ -141,6 +142,43 @@ func BotType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"stage": &graphql.Field{
+						Type:        graphql.String,
+						Description: "RANKED if the bot plays on the public ladder or SANDBOX if it only plays unrated practice games.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								return string(bot.Stage), nil
+							}
+							return nil, nil
+						},
+					},
+					"sandboxOpponent": &graphql.Field{
+						Type:        graphql.Boolean,
+						Description: "True if this bot has opted in to play practice games against bots in the sandbox.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								return bot.SandboxOpponent, nil
+							}
+							return nil, nil
+						},
+					},
+					"qualification": &graphql.Field{
+						Type:        QualificationType(),
+						Description: "The qualification progress of this bot if it was registered as a staged rollout, otherwise null.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								record, err := bot.RecordForKind(repository.GAME_KIND_QUALIFICATION)
+								if err != nil {
+									return nil, err
+								}
+								if record.Played == 0 && record.Remaining == 0 {
+									return nil, nil
+								}
+								return record, nil
+							}
+							return nil, nil
+						},
+					},
 					"gamesPlayed": &graphql.Field{
 						Type:        graphql.Int,
 						Description: "The number of games this bot has played.",
@@ -181,6 +219,47 @@ func BotType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"maxConcurrency": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of moves this bot may be asked to play at once. This is the limit the bot declared at registration capped by the server maximum.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								if bot.MaxConcurrency > gameworker.MaxBotConcurrency() {
+									return gameworker.MaxBotConcurrency(), nil
+								}
+								return bot.MaxConcurrency, nil
+							}
+							return nil, nil
+						},
+					},
+					"rating": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The rating of this bot from the rating engine used by its game type.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								r, err := gameworker.CurrentRating(bot)
+								if err != nil {
+									return nil, err
+								}
+								return r.Mu, nil
+							}
+							return nil, nil
+						},
+					},
+					"ratingDeviation": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The uncertainty in the rating of this bot. This is always 0 for rating engines, such as Elo, that do not measure uncertainty.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if bot, ok := p.Source.(repository.Bot); ok {
+								r, err := gameworker.CurrentRating(bot)
+								if err != nil {
+									return nil, err
+								}
+								return r.Sigma, nil
+							}
+							return nil, nil
+						},
+					},
 					"lastOnlineDatetime": &graphql.Field{
 						Type:        graphql.String,
 						Description: "The last known date/time that this bot was online.",
@@ -221,6 +300,29 @@ func BotType() *graphql.Object {
 				},
 			},
 		)
+
+		// Versions and regressionMatrix refer back to the Bot type so can only be
+		// added once the type has been created.
+		botType.AddFieldConfig("versions", &graphql.Field{
+			Type:        graphql.NewList(botType),
+			Description: "Every registered version of this bot, including superseded and discarded versions, so that their records can be compared.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if bot, ok := p.Source.(repository.Bot); ok {
+					return repository.ListBotsByName(bot.Name)
+				}
+				return nil, nil
+			},
+		})
+		botType.AddFieldConfig("regressionMatrix", &graphql.Field{
+			Type:        graphql.NewList(RegressionResultType()),
+			Description: "The win/draw/loss record of every version of this bot against every other version it has played in regression games.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if bot, ok := p.Source.(repository.Bot); ok {
+					return repository.ListRegressionResults(bot.Name)
+				}
+				return nil, nil
+			},
+		})
 	}
 
 	return botType
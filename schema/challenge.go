@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/relay"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var challengeType *graphql.Object
+
+func ChallengeType() *graphql.Object {
+	if challengeType == nil {
+		challengeType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Challenge",
+				Description: "A request by a user for one of their bots to play a game or series of games against a specific opponent.",
+				Fields: graphql.Fields{
+					"id": relay.GlobalIDField("Challenge", nil),
+					"challengeId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The unique ID of the challenge.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"user": &graphql.Field{
+						Type:        UserType(),
+						Description: "The user that issued the challenge.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.User()
+							}
+							return nil, nil
+						},
+					},
+					"bot": &graphql.Field{
+						Type:        BotType(),
+						Description: "The bot that issued the challenge.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.ChallengerBot()
+							}
+							return nil, nil
+						},
+					},
+					"opponent": &graphql.Field{
+						Type:        BotType(),
+						Description: "The bot that was challenged.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.OpponentBot()
+							}
+							return nil, nil
+						},
+					},
+					"gameCount": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games requested.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.GameCount, nil
+							}
+							return nil, nil
+						},
+					},
+					"rated": &graphql.Field{
+						Type:        graphql.Boolean,
+						Description: "True if the games count towards each bots score.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.Rated, nil
+							}
+							return nil, nil
+						},
+					},
+					"games": &graphql.Field{
+						Type:        graphql.NewList(GameType()),
+						Description: "The games scheduled for this challenge.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								return c.Games()
+							}
+							return nil, nil
+						},
+					},
+					"createdDatetime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date/time the challenge was issued.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if c, ok := p.Source.(repository.Challenge); ok {
+								t := c.CreatedDateTime
+								return t.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+				Interfaces: []*graphql.Interface{
+					nodeDefinitions.NodeInterface,
+				},
+			},
+		)
+	}
+
+	return challengeType
+}
@@ -0,0 +1,149 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/gameworker"
+)
+
+var workerType *graphql.Object
+
+func WorkerType() *graphql.Object {
+	if workerType == nil {
+		workerType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Worker",
+				Description: "A worker in the pool playing moves on this worker node.",
+				Fields: graphql.Fields{
+					"workerId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The ID of the worker, unique to this worker node.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(gameworker.WorkerState); ok {
+								return w.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"status": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Either BUSY if the worker is playing a move or IDLE.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(gameworker.WorkerState); ok {
+								if w.Busy {
+									return "BUSY", nil
+								}
+								return "IDLE", nil
+							}
+							return nil, nil
+						},
+					},
+					"gameMove": &graphql.Field{
+						Type:        GameMoveType(),
+						Description: "The move the worker is playing or null if it is idle.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(gameworker.WorkerState); ok {
+								if w.Busy {
+									return w.GameMove, nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"priority": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The priority the move was queued with, either CONTINUATION, FIRST_MOVE or BACKGROUND, or null if the worker is idle.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(gameworker.WorkerState); ok {
+								if w.Busy {
+									return w.Priority.String(), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"startDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time that the worker started playing its move or null if it is idle.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(gameworker.WorkerState); ok {
+								if w.Busy {
+									return w.StartDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return workerType
+}
+
+var dispatcherType *graphql.Object
+
+func DispatcherType() *graphql.Object {
+	if dispatcherType == nil {
+		dispatcherType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Dispatcher",
+				Description: "The live state of the dispatcher and worker pool on this worker node.",
+				Fields: graphql.Fields{
+					"poolSize": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of workers the pool is set to. Whilst the pool is shrinking it may briefly hold more workers than this.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(gameworker.DispatcherStatus); ok {
+								return d.PoolSize, nil
+							}
+							return nil, nil
+						},
+					},
+					"idleWorkers": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of workers waiting for a move.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(gameworker.DispatcherStatus); ok {
+								return d.IdleWorkers, nil
+							}
+							return nil, nil
+						},
+					},
+					"busyWorkers": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of workers playing a move.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(gameworker.DispatcherStatus); ok {
+								return d.BusyWorkers, nil
+							}
+							return nil, nil
+						},
+					},
+					"queueDepth": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of moves waiting to be claimed by any worker node.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(gameworker.DispatcherStatus); ok {
+								return d.QueueDepth, nil
+							}
+							return nil, nil
+						},
+					},
+					"workers": &graphql.Field{
+						Type:        graphql.NewList(WorkerType()),
+						Description: "Every worker in the pool.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(gameworker.DispatcherStatus); ok {
+								return d.Workers, nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return dispatcherType
+}
@@ -0,0 +1,213 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var failedMoveType *graphql.Object
+var stuckGameType *graphql.Object
+
+func FailedMoveType() *graphql.Object {
+	if failedMoveType == nil {
+		failedMoveType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "FailedMove",
+				Description: "A move that could not be played. The move waits until it is retried, skipped or abandoned.",
+				Fields: graphql.Fields{
+					"failedMoveId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The unique ID of the failed move.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return f.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"gameMove": &graphql.Field{
+						Type:        GameMoveType(),
+						Description: "The move that failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return f.GameMove()
+							}
+							return nil, nil
+						},
+					},
+					"bot": &graphql.Field{
+						Type:        BotType(),
+						Description: "The bot whose move failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return f.Bot()
+							}
+							return nil, nil
+						},
+					},
+					"reason": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Either BOT_ERROR, LEASE_EXPIRED, INTERNAL or UNREACHABLE.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return string(f.Reason), nil
+							}
+							return nil, nil
+						},
+					},
+					"error": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Why the move failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								if f.Error.Valid {
+									return f.Error.String, nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"attempts": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of times the move had been claimed by a worker when it failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return f.Attempts, nil
+							}
+							return nil, nil
+						},
+					},
+					"lastResponse": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The last response from the bot or null if there wasn't one.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								if f.LastResponse.Valid {
+									return f.LastResponse.String, nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"status": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Either OPEN, RETRIED, SKIPPED or ABANDONED.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return string(f.Status), nil
+							}
+							return nil, nil
+						},
+					},
+					"resolvedBy": &graphql.Field{
+						Type:        UserType(),
+						Description: "The user that resolved the failed move or null if it is open or was resolved by the move being played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								u, ok, err := f.ResolvedBy()
+								if err != nil || !ok {
+									return nil, err
+								}
+								return u, nil
+							}
+							return nil, nil
+						},
+					},
+					"createdDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time that the move failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								return f.CreatedDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+					"resolvedDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time that the failed move was resolved or null if it is open.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if f, ok := p.Source.(repository.FailedMove); ok {
+								if f.ResolvedDateTime.Valid {
+									return f.ResolvedDateTime.Time.UTC().Format("2006-01-02T15:04:05Z"), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return failedMoveType
+}
+
+func StuckGameType() *graphql.Object {
+	if stuckGameType == nil {
+		stuckGameType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "StuckGame",
+				Description: "An unfinished game whose next move is not queued to be played, so the game won't progress without help.",
+				Fields: graphql.Fields{
+					"game": &graphql.Field{
+						Type:        GameType(),
+						Description: "The stuck game.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.StuckGame); ok {
+								return s.Game()
+							}
+							return nil, nil
+						},
+					},
+					"gameMove": &graphql.Field{
+						Type:        GameMoveType(),
+						Description: "The move the game is waiting on.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.StuckGame); ok {
+								return s.GameMove()
+							}
+							return nil, nil
+						},
+					},
+					"bot": &graphql.Field{
+						Type:        BotType(),
+						Description: "The bot due to play the move. If the bot is offline the game continues once it responds again.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.StuckGame); ok {
+								return s.Bot()
+							}
+							return nil, nil
+						},
+					},
+					"failedMove": &graphql.Field{
+						Type:        FailedMoveType(),
+						Description: "Why the move failed or null if it hasn't failed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.StuckGame); ok {
+								f, ok, err := s.FailedMove()
+								if err != nil || !ok {
+									return nil, err
+								}
+								return f, nil
+							}
+							return nil, nil
+						},
+					},
+					"sinceDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "When the move failed or, if it hasn't, when it was last started or created.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.StuckGame); ok {
+								return s.SinceDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return stuckGameType
+}
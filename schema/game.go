@@ -81,6 +81,43 @@ func GameType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"kind": &graphql.Field{
+						Type:        graphql.String,
+						Description: "How this game came to be scheduled (e.g. LADDER or CHALLENGE).",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if g, ok := p.Source.(repository.Game); ok {
+								return string(g.Kind), nil
+							}
+							return nil, nil
+						},
+					},
+					"rated": &graphql.Field{
+						Type:        graphql.Boolean,
+						Description: "True if the result of this game counts towards the score of each bot.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if g, ok := p.Source.(repository.Game); ok {
+								return g.Rated, nil
+							}
+							return nil, nil
+						},
+					},
+					"challenge": &graphql.Field{
+						Type:        ChallengeType(),
+						Description: "The challenge that requested this game, if any.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if g, ok := p.Source.(repository.Game); ok {
+								c, err := g.Challenge()
+								if err != nil {
+									return nil, err
+								}
+								if c.Id == 0 {
+									return nil, nil
+								}
+								return c, nil
+							}
+							return nil, nil
+						},
+					},
 					"moves": &graphql.Field{
 						Type:        graphql.NewList(GameMoveType()),
 						Description: "The moves played for this game, order by time ascending.",
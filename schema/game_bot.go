@@ -46,12 +46,35 @@ func GameBotType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"team": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The team this bot played for. Bots on the same team share the result of the game.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gb, ok := p.Source.(repository.GameBot); ok {
+								return gb.Team, nil
+							}
+							return nil, nil
+						},
+					},
 				},
 				Interfaces: []*graphql.Interface{
 					nodeDefinitions.NodeInterface,
 				},
 			},
 		)
+
+		// Teammates refers back to the GameBot type so can only be added once the
+		// type has been created.
+		gameBotType.AddFieldConfig("teammates", &graphql.Field{
+			Type:        graphql.NewList(gameBotType),
+			Description: "The other bots on the same team in this game.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if gb, ok := p.Source.(repository.GameBot); ok {
+					return gb.Teammates()
+				}
+				return nil, nil
+			},
+		})
 	}
 	return gameBotType
 }
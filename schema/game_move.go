@@ -94,6 +94,26 @@ func GameMoveType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"failedMoves": &graphql.Field{
+						Type:        graphql.NewList(FailedMoveType()),
+						Description: "Every time this move failed to be played, most recent first.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gm, ok := p.Source.(repository.GameMove); ok {
+								return gm.FailedMoves()
+							}
+							return nil, nil
+						},
+					},
+					"rpcAttempts": &graphql.Field{
+						Type:        graphql.NewList(RPCAttemptType()),
+						Description: "Every attempt at calling the bot to play this move.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gm, ok := p.Source.(repository.GameMove); ok {
+								return gm.RPCAttempts()
+							}
+							return nil, nil
+						},
+					},
 				},
 				Interfaces: []*graphql.Interface{
 					nodeDefinitions.NodeInterface,
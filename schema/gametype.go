@@ -46,6 +46,16 @@ func GameTypeType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"ratingEngine": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The rating engine used to rate games of this type (e.g. ELO or TRUESKILL).",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gt, ok := p.Source.(repository.GameType); ok {
+								return gt.RatingEngine, nil
+							}
+							return nil, nil
+						},
+					},
 				},
 				Interfaces: []*graphql.Interface{
 					nodeDefinitions.NodeInterface,
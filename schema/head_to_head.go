@@ -0,0 +1,190 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var recordType *graphql.Object
+
+func RecordType() *graphql.Object {
+	if recordType == nil {
+		recordType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Record",
+				Description: "The results of a bot over a set of completed games.",
+				Fields: graphql.Fields{
+					"gamesPlayed": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Played, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesWon": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games won.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Won, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesDrawn": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games drawn.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Drawn, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesLost": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games lost.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Lost(), nil
+							}
+							return nil, nil
+						},
+					},
+					"score": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The percentage of games that were won or drawn.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Score(), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return recordType
+}
+
+var headToHeadType *graphql.Object
+
+func HeadToHeadType() *graphql.Object {
+	if headToHeadType == nil {
+		headToHeadType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "HeadToHead",
+				Description: "The record of one bot against another, either across all versions or for specific versions.",
+				Fields: graphql.Fields{
+					"botName": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The name of the bot this record belongs to.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.BotName, nil
+							}
+							return nil, nil
+						},
+					},
+					"botVersion": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The version of the bot this record belongs to or null if it covers all versions.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok && h.BotVersion != "" {
+								return h.BotVersion, nil
+							}
+							return nil, nil
+						},
+					},
+					"opponentName": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The name of the opposing bot.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.OpponentName, nil
+							}
+							return nil, nil
+						},
+					},
+					"opponentVersion": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The version of the opposing bot or null if the record covers all versions.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok && h.OpponentVersion != "" {
+								return h.OpponentVersion, nil
+							}
+							return nil, nil
+						},
+					},
+					"record": &graphql.Field{
+						Type:        RecordType(),
+						Description: "The record of the bot against the opponent across all completed games.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.Record, nil
+							}
+							return nil, nil
+						},
+					},
+					"asPlayerOne": &graphql.Field{
+						Type:        RecordType(),
+						Description: "The record of the bot against the opponent in completed games where the bot played first.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.AsPlayerOne, nil
+							}
+							return nil, nil
+						},
+					},
+					"asPlayerTwo": &graphql.Field{
+						Type:        RecordType(),
+						Description: "The record of the bot against the opponent in completed games where the bot played second.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.AsPlayerTwo, nil
+							}
+							return nil, nil
+						},
+					},
+					"averageMoveTime": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The average time in milliseconds the bot took to make a move against the opponent.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok && h.AverageMoveTime != nil {
+								return *h.AverageMoveTime, nil
+							}
+							return nil, nil
+						},
+					},
+					"opponentAverageMoveTime": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The average time in milliseconds the opponent took to make a move against the bot.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok && h.OpponentAverageMoveTime != nil {
+								return *h.OpponentAverageMoveTime, nil
+							}
+							return nil, nil
+						},
+					},
+					"games": &graphql.Field{
+						Type:        graphql.NewList(GameType()),
+						Description: "Every game between the bot and the opponent, most recent first.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if h, ok := p.Source.(repository.HeadToHead); ok {
+								return h.Games()
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return headToHeadType
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var qualificationType *graphql.Object
+
+func QualificationType() *graphql.Object {
+	if qualificationType == nil {
+		qualificationType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Qualification",
+				Description: "The progress of a new bot version through its qualification games.",
+				Fields: graphql.Fields{
+					"gamesPlayed": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of qualification games completed.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Played, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesWon": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of qualification games won.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Won, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesDrawn": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of qualification games drawn.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Drawn, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesRemaining": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of qualification games still to be played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Remaining, nil
+							}
+							return nil, nil
+						},
+					},
+					"score": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The score (as a percentage) across the completed qualification games.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if gr, ok := p.Source.(repository.GameRecord); ok {
+								return gr.Score(), nil
+							}
+							return nil, nil
+						},
+					},
+					"threshold": &graphql.Field{
+						Type:        graphql.Float,
+						Description: "The score required to replace the current version of the bot.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							return gameworker.QualificationThreshold(), nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return qualificationType
+}
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var regressionResultType *graphql.Object
+
+func RegressionResultType() *graphql.Object {
+	if regressionResultType == nil {
+		regressionResultType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "RegressionResult",
+				Description: "The record of one version of a bot against another version of the same bot in regression games.",
+				Fields: graphql.Fields{
+					"bot": &graphql.Field{
+						Type:        BotType(),
+						Description: "The version of the bot this record belongs to.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if rr, ok := p.Source.(repository.RegressionResult); ok {
+								return rr.Bot()
+							}
+							return nil, nil
+						},
+					},
+					"opponent": &graphql.Field{
+						Type:        BotType(),
+						Description: "The version of the bot that was played against.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if rr, ok := p.Source.(repository.RegressionResult); ok {
+								return rr.Opponent()
+							}
+							return nil, nil
+						},
+					},
+					"gamesWon": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games won against the opponent version.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if rr, ok := p.Source.(repository.RegressionResult); ok {
+								return rr.Record.Won, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesDrawn": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games drawn against the opponent version.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if rr, ok := p.Source.(repository.RegressionResult); ok {
+								return rr.Record.Drawn, nil
+							}
+							return nil, nil
+						},
+					},
+					"gamesLost": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games lost against the opponent version.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if rr, ok := p.Source.(repository.RegressionResult); ok {
+								return rr.Record.Lost(), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return regressionResultType
+}
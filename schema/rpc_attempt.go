@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var rpcAttemptType *graphql.Object
+
+func RPCAttemptType() *graphql.Object {
+	if rpcAttemptType == nil {
+		rpcAttemptType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "RPCAttempt",
+				Description: "A single attempt at an RPC call to a bot. Calls are retried if the bot can't be reached.",
+				Fields: graphql.Fields{
+					"method": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The RPC method that was called.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if a, ok := p.Source.(repository.RPCAttempt); ok {
+								return a.Method, nil
+							}
+							return nil, nil
+						},
+					},
+					"attempt": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of this attempt, starting at 1.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if a, ok := p.Source.(repository.RPCAttempt); ok {
+								return a.Attempt, nil
+							}
+							return nil, nil
+						},
+					},
+					"startDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time that this attempt was started.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if a, ok := p.Source.(repository.RPCAttempt); ok {
+								return a.StartDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+					"durationMs": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "How long the attempt took in milliseconds.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if a, ok := p.Source.(repository.RPCAttempt); ok {
+								return a.DurationMs, nil
+							}
+							return nil, nil
+						},
+					},
+					"error": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Why the attempt failed or null if it succeeded.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if a, ok := p.Source.(repository.RPCAttempt); ok {
+								if a.Error.Valid {
+									return a.Error.String, nil
+								}
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return rpcAttemptType
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/relay"
+	"github.com/mleonard87/merknera/gameworker"
 	"github.com/mleonard87/merknera/repository"
+	"github.com/mleonard87/merknera/services"
 )
 
 var nodeDefinitions *relay.NodeDefinitions
@@ -47,6 +49,9 @@ func init() {
 			case "User":
 				i, _ := strconv.Atoi(resolvedID.ID)
 				return repository.GetUserById(i)
+			case "Challenge":
+				i, _ := strconv.Atoi(resolvedID.ID)
+				return repository.GetChallengeById(i)
 			default:
 				return nil, errors.New("Unknown node type")
 			}
@@ -66,6 +71,8 @@ func init() {
 				return GameTypeType()
 			case repository.User:
 				return UserType()
+			case repository.Challenge:
+				return ChallengeType()
 			default:
 				return UserType()
 			}
@@ -125,6 +132,10 @@ func MerkneraSchema() *graphql.Schema {
 						Type:        graphql.Int,
 						Description: "If a User ID is provided a list of bots will be returned that are owned by the specified user.",
 					},
+					"sandbox": &graphql.ArgumentConfig{
+						Type:        graphql.Boolean,
+						Description: "If true a list of the bots currently in the sandbox will be returned instead of the ranked bots.",
+					},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 					args := relay.NewConnectionArguments(p.Args)
@@ -140,6 +151,8 @@ func MerkneraSchema() *graphql.Schema {
 						if err != nil {
 							return nil, err
 						}
+					} else if sandbox, _ := p.Args["sandbox"].(bool); sandbox {
+						bots, _ = repository.ListSandboxBots()
 					} else {
 						bots, _ = repository.ListBots()
 					}
@@ -171,6 +184,10 @@ func MerkneraSchema() *graphql.Schema {
 						Type:        graphql.Int,
 						Description: "If a Bot ID is provided a list of games will be returned for the specifie bot.",
 					},
+					"kind": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "If a kind is provided (e.g. SANDBOX) only games of that kind will be returned.",
+					},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 					args := relay.NewConnectionArguments(p.Args)
@@ -186,6 +203,8 @@ func MerkneraSchema() *graphql.Schema {
 						if err != nil {
 							return nil, err
 						}
+					} else if kind, isOK := p.Args["kind"].(string); isOK {
+						games, _ = repository.ListGamesByKind(repository.GameKind(kind))
 					} else {
 						games, _ = repository.ListGames()
 					}
@@ -227,6 +246,105 @@ func MerkneraSchema() *graphql.Schema {
 					return nil, nil
 				},
 			},
+			"headToHead": &graphql.Field{
+				Type:        HeadToHeadType(),
+				Description: "The record of one bot against another. If versions are not given the record covers every version of each bot.",
+				Args: graphql.FieldConfigArgument{
+					"botName": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The name of the bot you want the record for.",
+					},
+					"botVersion": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "The version of the bot you want the record for.",
+					},
+					"opponentName": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The name of the opposing bot.",
+					},
+					"opponentVersion": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "The version of the opposing bot.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					botName, _ := p.Args["botName"].(string)
+					botVersion, _ := p.Args["botVersion"].(string)
+					opponentName, _ := p.Args["opponentName"].(string)
+					opponentVersion, _ := p.Args["opponentVersion"].(string)
+
+					return repository.GetHeadToHead(botName, botVersion, opponentName, opponentVersion)
+				},
+			},
+			"gameTypeStatistics": &graphql.Field{
+				Type:        graphql.NewList(GameTypeStatisticsType()),
+				Description: "Statistics over the completed games of each game type.",
+				Args: graphql.FieldConfigArgument{
+					"gameType": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "If a game type mnemonic (e.g. TICTACTOE) is provided only statistics for that game type will be returned.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var gameTypes []repository.GameType
+					mnemonic, isOK := p.Args["gameType"].(string)
+					if isOK {
+						gt, err := repository.GetGameTypeByMnemonic(mnemonic)
+						if err != nil {
+							return nil, err
+						}
+						gameTypes = append(gameTypes, gt)
+					} else {
+						var err error
+						gameTypes, err = repository.ListGameTypes()
+						if err != nil {
+							return nil, err
+						}
+					}
+
+					var statsList []repository.GameTypeStatistics
+					for _, gt := range gameTypes {
+						stats, err := repository.GetGameTypeStatistics(gt)
+						if err != nil {
+							return nil, err
+						}
+						statsList = append(statsList, stats)
+					}
+
+					return statsList, nil
+				},
+			},
+			"dispatcher": &graphql.Field{
+				Type:        DispatcherType(),
+				Description: "The live state of the dispatcher and worker pool on the worker node serving this request.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return gameworker.GetDispatcherStatus()
+				},
+			},
+			"workerNodes": &graphql.Field{
+				Type:        graphql.NewList(WorkerNodeType()),
+				Description: "Every worker node that has registered, most recent first.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return repository.ListWorkerNodes()
+				},
+			},
+			"stuckGames": &graphql.Field{
+				Type:        graphql.NewList(StuckGameType()),
+				Description: "Unfinished games whose next move is not queued to be played. Administrators see every stuck game, other users see the games stuck on their own bots.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						return services.ListStuckGames(user)
+					}
+
+					return nil, nil
+				},
+			},
 			"users": &graphql.Field{
 				Type: UserConnectionDefinition().ConnectionType,
 				Args: relay.ConnectionArgs,
@@ -348,6 +466,382 @@ func MerkneraSchema() *graphql.Schema {
 					return nil, nil
 				},
 			},
+			"challenge": &graphql.Field{
+				Type:        ChallengeType(),
+				Description: "Challenge another bot to a game, or a series of games, against one of your bots.",
+				Args: graphql.FieldConfigArgument{
+					"botId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of your bot that will issue the challenge.",
+					},
+					"opponentBotId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the bot to challenge.",
+					},
+					"games": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 1,
+						Description:  "The number of games to play. In a series the bots alternate who plays first.",
+					},
+					"rated": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: false,
+						Description:  "True if the games should count towards each bots score.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						botId, _ := p.Args["botId"].(int)
+						opponentBotId, _ := p.Args["opponentBotId"].(int)
+						games, isOK := p.Args["games"].(int)
+						if !isOK {
+							games = 1
+						}
+						rated, _ := p.Args["rated"].(bool)
+
+						return services.Challenge(user, botId, opponentBotId, games, rated)
+					}
+
+					return nil, nil
+				},
+			},
+			"setAcceptChallenges": &graphql.Field{
+				Type:        UserType(),
+				Description: "Set whether other users may challenge your bots to games.",
+				Args: graphql.FieldConfigArgument{
+					"accept": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Boolean),
+						Description: "True to accept challenges from other users, false to opt out.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						accept, isOK := p.Args["accept"].(bool)
+						if isOK {
+							err = user.SetAcceptChallenges(accept)
+							if err != nil {
+								return nil, err
+							}
+							return user, nil
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"promoteBot": &graphql.Field{
+				Type:        BotType(),
+				Description: "Promote one of your bots from the sandbox into ranked play. Any other version of the bot will be superseded.",
+				Args: graphql.FieldConfigArgument{
+					"botId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the sandbox bot to promote.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						botId, isOK := p.Args["botId"].(int)
+						if isOK {
+							return services.PromoteBot(user, botId)
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"setRatingEngine": &graphql.Field{
+				Type:        GameTypeType(),
+				Description: "Set the rating engine used to rate games of a game type. Only administrators may do this.",
+				Args: graphql.FieldConfigArgument{
+					"gameType": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The mnemonic of the game type (e.g. TICTACTOE).",
+					},
+					"ratingEngine": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The rating engine to use, either ELO for two player games or TRUESKILL for games with more players or teams.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						gameType, _ := p.Args["gameType"].(string)
+						ratingEngine, _ := p.Args["ratingEngine"].(string)
+
+						return services.SetRatingEngine(user, gameType, ratingEngine)
+					}
+
+					return nil, nil
+				},
+			},
+			"setWorkerPoolSize": &graphql.Field{
+				Type:        DispatcherType(),
+				Description: "Set the number of workers playing moves on the worker node serving this request. Only administrators may do this.",
+				Args: graphql.FieldConfigArgument{
+					"size": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The number of workers.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						size, _ := p.Args["size"].(int)
+
+						return services.SetWorkerPoolSize(user, size)
+					}
+
+					return nil, nil
+				},
+			},
+			"setSchedulingWeight": &graphql.Field{
+				Type:        UserType(),
+				Description: "Set a user's share of the worker pool relative to other users with moves waiting to be played. Only administrators may do this.",
+				Args: graphql.FieldConfigArgument{
+					"userId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the user.",
+					},
+					"weight": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The user's weight. A user with a weight of 2 gets twice the share of a user with a weight of 1.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						weightedUserId, _ := p.Args["userId"].(int)
+						weight, _ := p.Args["weight"].(int)
+
+						return services.SetSchedulingWeight(user, weightedUserId, weight)
+					}
+
+					return nil, nil
+				},
+			},
+			"setSandboxOpponent": &graphql.Field{
+				Type:        BotType(),
+				Description: "Set whether one of your bots will play practice games against bots in the sandbox.",
+				Args: graphql.FieldConfigArgument{
+					"botId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of your bot.",
+					},
+					"enabled": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Boolean),
+						Description: "True to opt in to sandbox games, false to opt out.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						botId, _ := p.Args["botId"].(int)
+						enabled, _ := p.Args["enabled"].(bool)
+
+						bot, err := repository.GetBotById(botId)
+						if err != nil {
+							return nil, err
+						}
+
+						botUser, err := bot.User()
+						if err != nil {
+							return nil, err
+						}
+
+						if botUser.Id != int(userId) {
+							return nil, nil
+						}
+
+						err = bot.SetSandboxOpponent(enabled)
+						if err != nil {
+							return nil, err
+						}
+
+						return bot, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"createWebhook": &graphql.Field{
+				Type:        WebhookType(),
+				Description: "Register a URL to be sent signed events when one of your bots changes status, finishes a game or causes an error.",
+				Args: graphql.FieldConfigArgument{
+					"url": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The http or https URL that events will be POSTed to.",
+					},
+					"secret": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "The secret used to sign each request in the X-Merknera-Signature header.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						url, _ := p.Args["url"].(string)
+						secret, _ := p.Args["secret"].(string)
+
+						return services.CreateWebhook(user, url, secret)
+					}
+
+					return nil, nil
+				},
+			},
+			"deleteWebhook": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Delete one of your webhooks along with its delivery history.",
+				Args: graphql.FieldConfigArgument{
+					"webhookId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the webhook to be deleted.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						webhookId, isOK := p.Args["webhookId"].(int)
+						if isOK {
+							return services.DeleteWebhook(user, webhookId)
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"retryFailedMove": &graphql.Field{
+				Type:        FailedMoveType(),
+				Description: "Queue a failed move to be played again. Only the owner of the bot or an administrator may do this.",
+				Args: graphql.FieldConfigArgument{
+					"failedMoveId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the failed move.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						failedMoveId, isOK := p.Args["failedMoveId"].(int)
+						if isOK {
+							return services.RetryFailedMove(user, failedMoveId)
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"skipFailedMove": &graphql.Field{
+				Type:        FailedMoveType(),
+				Description: "Skip a failed move, forfeiting the game for the bot whose move failed. Only the owner of the bot or an administrator may do this.",
+				Args: graphql.FieldConfigArgument{
+					"failedMoveId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the failed move.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						failedMoveId, isOK := p.Args["failedMoveId"].(int)
+						if isOK {
+							return services.SkipFailedMove(user, failedMoveId)
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
+			"abandonFailedMove": &graphql.Field{
+				Type:        FailedMoveType(),
+				Description: "Abandon the game a failed move belongs to, leaving it without a result. Only the owner of the bot or an administrator may do this.",
+				Args: graphql.FieldConfigArgument{
+					"failedMoveId": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.Int),
+						Description: "The id of the failed move.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userId, isOK := p.Context.Value("userId").(float64)
+					if isOK {
+						user, err := repository.GetUserById(int(userId))
+						if err != nil {
+							return nil, err
+						}
+
+						failedMoveId, isOK := p.Args["failedMoveId"].(int)
+						if isOK {
+							return services.AbandonFailedMove(user, failedMoveId)
+						}
+
+						return nil, nil
+					}
+
+					return nil, nil
+				},
+			},
 			"deleteBot": &graphql.Field{
 				Type:        graphql.Int,
 				Description: "Permanently delete a bot with the given id and all its prevous versions.",
@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var playSequenceResultType *graphql.Object
+
+func PlaySequenceResultType() *graphql.Object {
+	if playSequenceResultType == nil {
+		playSequenceResultType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "PlaySequenceResult",
+				Description: "The combined record of every bot that played in a given position (e.g. first).",
+				Fields: graphql.Fields{
+					"playSequence": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The position in which the bots played, starting at 1 for the first player.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if psr, ok := p.Source.(repository.PlaySequenceResult); ok {
+								return psr.PlaySequence, nil
+							}
+							return nil, nil
+						},
+					},
+					"record": &graphql.Field{
+						Type:        RecordType(),
+						Description: "The record of the bots that played in this position.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if psr, ok := p.Source.(repository.PlaySequenceResult); ok {
+								return psr.Record, nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return playSequenceResultType
+}
+
+var gameLengthFrequencyType *graphql.Object
+
+func GameLengthFrequencyType() *graphql.Object {
+	if gameLengthFrequencyType == nil {
+		gameLengthFrequencyType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "GameLengthFrequency",
+				Description: "The number of games that lasted a given number of moves.",
+				Fields: graphql.Fields{
+					"moves": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of moves played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if glf, ok := p.Source.(repository.GameLengthFrequency); ok {
+								return glf.Moves, nil
+							}
+							return nil, nil
+						},
+					},
+					"games": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of games that lasted this many moves.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if glf, ok := p.Source.(repository.GameLengthFrequency); ok {
+								return glf.Games, nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return gameLengthFrequencyType
+}
+
+var openingFrequencyType *graphql.Object
+
+func OpeningFrequencyType() *graphql.Object {
+	if openingFrequencyType == nil {
+		openingFrequencyType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "OpeningFrequency",
+				Description: "How often an opening move was played and how the first player fared after it.",
+				Fields: graphql.Fields{
+					"gameState": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The game state, as JSON, after the opening move was played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if of, ok := p.Source.(repository.OpeningFrequency); ok {
+								return of.GameState, nil
+							}
+							return nil, nil
+						},
+					},
+					"games": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of completed games that began with this opening.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if of, ok := p.Source.(repository.OpeningFrequency); ok {
+								return of.Record.Played, nil
+							}
+							return nil, nil
+						},
+					},
+					"firstPlayerRecord": &graphql.Field{
+						Type:        RecordType(),
+						Description: "The record of the first player in games that began with this opening.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if of, ok := p.Source.(repository.OpeningFrequency); ok {
+								return of.Record, nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return openingFrequencyType
+}
+
+var gameTypeStatisticsType *graphql.Object
+
+func GameTypeStatisticsType() *graphql.Object {
+	if gameTypeStatisticsType == nil {
+		gameTypeStatisticsType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "GameTypeStatistics",
+				Description: "Statistics over every completed game of a game type, used to check how balanced the game is.",
+				Fields: graphql.Fields{
+					"gameType": &graphql.Field{
+						Type:        GameTypeType(),
+						Description: "The game type these statistics are for.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.GameTypeStatistics); ok {
+								return s.GameType()
+							}
+							return nil, nil
+						},
+					},
+					"gamesCompleted": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of completed games.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.GameTypeStatistics); ok {
+								return s.GamesCompleted, nil
+							}
+							return nil, nil
+						},
+					},
+					"playSequenceResults": &graphql.Field{
+						Type:        graphql.NewList(PlaySequenceResultType()),
+						Description: "The win/draw/loss record for each play position, e.g. to compare the first and second players.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.GameTypeStatistics); ok {
+								return s.PlaySequenceResults, nil
+							}
+							return nil, nil
+						},
+					},
+					"gameLengths": &graphql.Field{
+						Type:        graphql.NewList(GameLengthFrequencyType()),
+						Description: "The distribution of game lengths, in moves.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.GameTypeStatistics); ok {
+								return s.GameLengths, nil
+							}
+							return nil, nil
+						},
+					},
+					"openings": &graphql.Field{
+						Type:        graphql.NewList(OpeningFrequencyType()),
+						Description: "Every opening move played, most frequent first.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if s, ok := p.Source.(repository.GameTypeStatistics); ok {
+								return s.Openings, nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return gameTypeStatisticsType
+}
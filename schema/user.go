@@ -174,6 +174,36 @@ func UserType() *graphql.Object {
 							return nil, nil
 						},
 					},
+					"acceptChallenges": &graphql.Field{
+						Type:        graphql.Boolean,
+						Description: "True if other users may challenge this users bots to games.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if u, ok := p.Source.(repository.User); ok {
+								return u.AcceptChallenges, nil
+							}
+							return nil, nil
+						},
+					},
+					"admin": &graphql.Field{
+						Type:        graphql.Boolean,
+						Description: "True if this user is a Merknera administrator. Bots owned by administrators are house bots.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if u, ok := p.Source.(repository.User); ok {
+								return u.Admin, nil
+							}
+							return nil, nil
+						},
+					},
+					"schedulingWeight": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "This users share of the worker pool relative to other users with moves waiting to be played.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if u, ok := p.Source.(repository.User); ok {
+								return u.SchedulingWeight, nil
+							}
+							return nil, nil
+						},
+					},
 					"tokenList": &graphql.Field{
 						Type:        graphql.NewList(UserTokenType()),
 						Description: "The list of tokens for the currently logged in user, otherwise null.",
@@ -188,6 +218,23 @@ func UserType() *graphql.Object {
 								return user.Tokens()
 							}
 
+							return nil, nil
+						},
+					},
+					"webhookList": &graphql.Field{
+						Type:        graphql.NewList(WebhookType()),
+						Description: "The list of webhooks for the currently logged in user, otherwise null.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							userId, isOK := p.Context.Value("userId").(float64)
+							if isOK {
+								user, err := repository.GetUserById(int(userId))
+								if err != nil {
+									return nil, err
+								}
+
+								return user.ListWebhooks()
+							}
+
 							return nil, nil
 						},
 					},
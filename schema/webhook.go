@@ -0,0 +1,188 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+	"github.com/mleonard87/merknera/services"
+)
+
+var webhookType *graphql.Object
+var webhookDeliveryType *graphql.Object
+
+func WebhookType() *graphql.Object {
+	if webhookType == nil {
+		webhookType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "Webhook",
+				Description: "A URL that is sent signed events about a user's bots. The secret is never returned.",
+				Fields: graphql.Fields{
+					"webhookId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The unique ID of the webhook.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(repository.Webhook); ok {
+								return w.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"url": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The URL that events are POSTed to.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(repository.Webhook); ok {
+								return w.URL, nil
+							}
+							return nil, nil
+						},
+					},
+					"createdDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time that the webhook was created.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(repository.Webhook); ok {
+								return w.CreatedDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+					"deliveries": &graphql.Field{
+						Type:        graphql.NewList(WebhookDeliveryType()),
+						Description: "The most recent deliveries to this webhook, newest first.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if w, ok := p.Source.(repository.Webhook); ok {
+								return w.Deliveries(services.WEBHOOK_HISTORY_LIMIT)
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return webhookType
+}
+
+func WebhookDeliveryType() *graphql.Object {
+	if webhookDeliveryType == nil {
+		webhookDeliveryType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "WebhookDelivery",
+				Description: "An event sent, or waiting to be sent, to a webhook. Failed attempts are retried with a backoff.",
+				Fields: graphql.Fields{
+					"webhookDeliveryId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The unique ID of the delivery. This is sent in the X-Merknera-Delivery header.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return d.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"event": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The event that was delivered, e.g. GAME_COMPLETED.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return d.Event, nil
+							}
+							return nil, nil
+						},
+					},
+					"payload": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The JSON body of the request.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return d.Payload, nil
+							}
+							return nil, nil
+						},
+					},
+					"status": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Either PENDING, DELIVERED or FAILED.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return string(d.Status), nil
+							}
+							return nil, nil
+						},
+					},
+					"attempts": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The number of times the delivery has been attempted.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return d.Attempts, nil
+							}
+							return nil, nil
+						},
+					},
+					"responseStatus": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The HTTP status of the last response or null if there wasn't one.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								if d.ResponseStatus.Valid {
+									return int(d.ResponseStatus.Int64), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"error": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Why the last attempt failed or null if it succeeded.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								if d.Error.Valid {
+									return d.Error.String, nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"nextAttemptDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "When the delivery will next be attempted, or null if it won't be.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								if d.Status == repository.WEBHOOK_DELIVERY_STATUS_PENDING {
+									return d.NextAttemptDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"lastAttemptDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "When the delivery was last attempted or null if it hasn't been yet.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								if d.LastAttemptDateTime.Valid {
+									return d.LastAttemptDateTime.Time.UTC().Format("2006-01-02T15:04:05Z"), nil
+								}
+							}
+							return nil, nil
+						},
+					},
+					"createdDateTime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "When the event happened.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if d, ok := p.Source.(repository.WebhookDelivery); ok {
+								return d.CreatedDateTime.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return webhookDeliveryType
+}
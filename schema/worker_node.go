@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/mleonard87/merknera/repository"
+)
+
+var workerNodeType *graphql.Object
+
+func WorkerNodeType() *graphql.Object {
+	if workerNodeType == nil {
+		workerNodeType = graphql.NewObject(
+			graphql.ObjectConfig{
+				Name:        "WorkerNode",
+				Description: "A Merknera process playing moves. Several worker nodes may share one database.",
+				Fields: graphql.Fields{
+					"workerNodeId": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The unique ID of the worker node.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								return n.Id, nil
+							}
+							return nil, nil
+						},
+					},
+					"hostname": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The host the worker node is running on.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								return n.Hostname, nil
+							}
+							return nil, nil
+						},
+					},
+					"pid": &graphql.Field{
+						Type:        graphql.Int,
+						Description: "The process ID of the worker node on its host.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								return n.Pid, nil
+							}
+							return nil, nil
+						},
+					},
+					"status": &graphql.Field{
+						Type:        graphql.String,
+						Description: "Either ACTIVE, STOPPED if the worker node shut down cleanly or DEAD if it stopped sending heartbeats.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								return n.Status, nil
+							}
+							return nil, nil
+						},
+					},
+					"startedDatetime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time the worker node started.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								t := n.StartedDateTime
+								return t.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+					"heartbeatDatetime": &graphql.Field{
+						Type:        graphql.String,
+						Description: "The date and time of the last heartbeat from the worker node.",
+						Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+							if n, ok := p.Source.(repository.WorkerNode); ok {
+								t := n.HeartbeatDateTime
+								return t.UTC().Format("2006-01-02T15:04:05Z"), nil
+							}
+							return nil, nil
+						},
+					},
+				},
+			},
+		)
+	}
+
+	return workerNodeType
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_CHALLENGE_LIMIT = "MERKNERA_CHALLENGE_LIMIT"
+
+	// The default number of challenges a single user may issue per challenge
+	// period. This can be overridden with MERKNERA_CHALLENGE_LIMIT.
+	DEFAULT_CHALLENGE_LIMIT = 10
+	CHALLENGE_PERIOD        = time.Hour
+	MAX_CHALLENGE_GAMES     = 10
+)
+
+func challengeLimit() int {
+	limit, err := strconv.Atoi(os.Getenv(ENVVAR_CHALLENGE_LIMIT))
+	if err != nil || limit < 0 {
+		return DEFAULT_CHALLENGE_LIMIT
+	}
+
+	return limit
+}
+
+// Challenge schedules a game, or a series of games, between one of the users
+// bots and an opponent bot. In a series the bots alternate who plays first.
+func Challenge(user repository.User, botId int, opponentBotId int, gameCount int, rated bool) (repository.Challenge, error) {
+	if gameCount < 1 || gameCount > MAX_CHALLENGE_GAMES {
+		em := fmt.Sprintf("A challenge must be for between 1 and %d games.", MAX_CHALLENGE_GAMES)
+		return repository.Challenge{}, errors.New(em)
+	}
+
+	if botId == opponentBotId {
+		return repository.Challenge{}, errors.New("A bot cannot challenge itself.")
+	}
+
+	bot, err := repository.GetBotById(botId)
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	botUser, err := bot.User()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	if botUser.Id != user.Id {
+		return repository.Challenge{}, errors.New("You may only issue challenges from your own bots.")
+	}
+
+	opponent, err := repository.GetBotById(opponentBotId)
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	if bot.Status == repository.BOT_STATUS_SUPERSEDED || opponent.Status == repository.BOT_STATUS_SUPERSEDED {
+		return repository.Challenge{}, errors.New("Superseded bots cannot be challenged or issue challenges.")
+	}
+
+	if bot.Stage == repository.BOT_STAGE_SANDBOX || opponent.Stage == repository.BOT_STAGE_SANDBOX {
+		return repository.Challenge{}, errors.New("Sandbox bots cannot be challenged or issue challenges.")
+	}
+
+	if bot.Name == opponent.Name {
+		return repository.Challenge{}, errors.New("A bot cannot challenge another version of itself.")
+	}
+
+	gameType, err := bot.GameType()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	opponentGameType, err := opponent.GameType()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	if gameType.Id != opponentGameType.Id {
+		em := fmt.Sprintf("%s plays %s but %s plays %s.", bot.Name, gameType.Name, opponent.Name, opponentGameType.Name)
+		return repository.Challenge{}, errors.New(em)
+	}
+
+	opponentUser, err := opponent.User()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	if opponentUser.Id != user.Id && !opponentUser.AcceptChallenges {
+		em := fmt.Sprintf("The owner of %s is not accepting challenges.", opponent.Name)
+		return repository.Challenge{}, errors.New(em)
+	}
+
+	gameManager, err := games.GetGameManager(gameType)
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	if gameManager.TeamSize() != 1 {
+		em := fmt.Sprintf("%s is played in teams so bots cannot challenge each other.", gameType.Name)
+		return repository.Challenge{}, errors.New(em)
+	}
+
+	// The challenge is counted against the rate limit and created along with
+	// its games in one transaction, holding a lock on the users challenges so
+	// that challenges issued at the same time can't all slip under the limit.
+	db := repository.GetDB()
+	tx, err := db.Begin()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	err = repository.LockChallengesTx(tx, user)
+	if err != nil {
+		tx.Rollback()
+		return repository.Challenge{}, err
+	}
+
+	issued, err := repository.CountChallengesSinceTx(tx, user, time.Now().Add(-CHALLENGE_PERIOD))
+	if err != nil {
+		tx.Rollback()
+		return repository.Challenge{}, err
+	}
+
+	if issued >= challengeLimit() {
+		tx.Rollback()
+		em := fmt.Sprintf("You may only issue %d challenges per hour, please try again later.", challengeLimit())
+		return repository.Challenge{}, errors.New(em)
+	}
+
+	challenge, err := repository.CreateChallengeTx(tx, user, bot, opponent, gameCount, rated)
+	if err != nil {
+		tx.Rollback()
+		return repository.Challenge{}, err
+	}
+
+	var gameList []repository.Game
+	for i := 0; i < gameCount; i++ {
+		players := []repository.Bot{bot, opponent}
+		if i%2 == 1 {
+			players = []repository.Bot{opponent, bot}
+		}
+
+		game, err := gameManager.CreateGame(tx, players, repository.GAME_KIND_CHALLENGE, rated)
+		if err != nil {
+			log.Printf("An error occurred whilst creating a game for challenge %d:\n%s\n", challenge.Id, err)
+			tx.Rollback()
+			return repository.Challenge{}, err
+		}
+
+		err = challenge.AddGameTx(tx, game)
+		if err != nil {
+			tx.Rollback()
+			return repository.Challenge{}, err
+		}
+
+		gameList = append(gameList, game)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repository.Challenge{}, err
+	}
+
+	for _, game := range gameList {
+		events.Publish(events.GameCreated{Game: game})
+
+		bot.Logf("Challenged %s (gameId: %d)", opponent.Name, game.Id)
+		opponent.Logf("Challenged by %s (gameId: %d)", bot.Name, game.Id)
+
+		gameMove, err := game.NextGameMove()
+		if err != nil {
+			return challenge, err
+		}
+		gameworker.QueueGameMove(gameMove)
+	}
+
+	return challenge, nil
+}
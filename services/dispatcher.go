@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// SetWorkerPoolSize changes the number of workers playing moves on this node.
+func SetWorkerPoolSize(user repository.User, size int) (gameworker.DispatcherStatus, error) {
+	if !user.Admin {
+		return gameworker.DispatcherStatus{}, errors.New("Only administrators may change the size of the worker pool.")
+	}
+
+	err := gameworker.ResizeWorkerPool(size)
+	if err != nil {
+		return gameworker.DispatcherStatus{}, err
+	}
+
+	return gameworker.GetDispatcherStatus()
+}
+
+// The largest share of the worker pool that a user may be given.
+const MAX_SCHEDULING_WEIGHT = 100
+
+// SetSchedulingWeight sets a user's share of the worker pool relative to other
+// users with moves waiting to be played.
+func SetSchedulingWeight(user repository.User, userId int, weight int) (repository.User, error) {
+	if !user.Admin {
+		return repository.User{}, errors.New("Only administrators may change the scheduling weight of a user.")
+	}
+
+	if weight < 1 || weight > MAX_SCHEDULING_WEIGHT {
+		em := fmt.Sprintf("A scheduling weight must be between 1 and %d.", MAX_SCHEDULING_WEIGHT)
+		return repository.User{}, errors.New(em)
+	}
+
+	weightedUser, err := repository.GetUserById(userId)
+	if err != nil {
+		return repository.User{}, err
+	}
+
+	err = weightedUser.SetSchedulingWeight(weight)
+	if err != nil {
+		return weightedUser, err
+	}
+
+	return weightedUser, nil
+}
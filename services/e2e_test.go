@@ -0,0 +1,501 @@
+//go:build integration
+// +build integration
+
+// The end-to-end tests drive RegistrationService.Register against a real
+// Postgres database and scripted bots served by httptest servers, then follow
+// the games through the backlog scheduler and the worker pool.
+//
+// Every table other than game_type and worker_node is truncated before each
+// test, so the tests refuse to run unless MERKNERA_DBNAME ends with "_test".
+// The database must already have the migrations in sql/ applied, e.g.
+//
+//	MERKNERA_DBNAME=merknera_test go test -tags integration ./services/
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+	"github.com/mleonard87/merknera/scheduler"
+)
+
+const (
+	// How long to wait for the workers before failing a test.
+	waitTimeout  = 30 * time.Second
+	pollInterval = 100 * time.Millisecond
+	// How long a hanging bot waits before responding, longer than the RPC
+	// response timeout set in TestMain.
+	hangFor = 5 * time.Second
+)
+
+func TestMain(m *testing.M) {
+	if !strings.HasSuffix(os.Getenv(repository.ENVVAR_DBNAME), "_test") {
+		fmt.Printf("Skipping the end-to-end tests, %s must name a database ending in \"_test\" as its tables are truncated.\n", repository.ENVVAR_DBNAME)
+		os.Exit(0)
+	}
+
+	err := games.CreateGameTypes()
+	if err != nil {
+		fmt.Printf("Error creating game types: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Keep timeouts and intervals short so that misbehaving bots are dealt
+	// with quickly. These must be set before the first RPC call is made.
+	os.Setenv("MERKNERA_RPC_CONNECT_TIMEOUT", "1")
+	os.Setenv("MERKNERA_RPC_RESPONSE_TIMEOUT", "1")
+	os.Setenv("MERKNERA_RPC_RETRIES", "0")
+	os.Setenv("MERKNERA_BACKLOG_INTERVAL", "1")
+	os.Setenv("MERKNERA_HEALTH_INTERVAL", "1")
+	os.Setenv("MERKNERA_HEALTH_BACKOFF", "1")
+
+	// The Complete and Error notifications are sent in the background so may
+	// not have been received by the time an event is recorded, tests wait for
+	// them with waitForCalls.
+	events.Subscribe(events.GAME_COMPLETED, recordEvent)
+	events.Subscribe(events.GAME_SUSPENDED, recordEvent)
+
+	gameworker.StartGameMoveDispatcher(4)
+	gameworker.StartHealthMonitor()
+	scheduler.StartBacklogScheduler()
+
+	code := m.Run()
+
+	scheduler.Stop()
+	err = gameworker.Shutdown(hangFor)
+	if err != nil {
+		fmt.Printf("Error shutting down the workers: %s\n", err)
+	}
+
+	os.Exit(code)
+}
+
+// resetDatabase empties every table other than game_type, which is filled in
+// TestMain, and worker_node, which holds the node
+// running the tests. Recorded events are cleared too.
+func resetDatabase(t *testing.T) {
+	rows, err := repository.DB.Query(`
+	SELECT tablename
+	FROM pg_tables
+	WHERE schemaname = 'public'
+	  AND tablename NOT IN ('game_type', 'worker_node')
+	`)
+	if err != nil {
+		t.Fatalf("Error listing tables: %s", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			t.Fatalf("Error listing tables: %s", err)
+		}
+		tables = append(tables, table)
+	}
+
+	_, err = repository.DB.Exec(fmt.Sprintf("TRUNCATE %s RESTART IDENTITY CASCADE", strings.Join(tables, ", ")))
+	if err != nil {
+		t.Fatalf("Error truncating tables: %s", err)
+	}
+
+	recorded.Lock()
+	recorded.events = nil
+	recorded.Unlock()
+}
+
+var recorded struct {
+	sync.Mutex
+	events []events.Event
+}
+
+func recordEvent(e events.Event) {
+	recorded.Lock()
+	defer recorded.Unlock()
+
+	recorded.events = append(recorded.events, e)
+}
+
+func gameCompletedEvents() []events.GameCompleted {
+	recorded.Lock()
+	defer recorded.Unlock()
+
+	var gcs []events.GameCompleted
+	for _, e := range recorded.events {
+		if gc, ok := e.(events.GameCompleted); ok {
+			gcs = append(gcs, gc)
+		}
+	}
+
+	return gcs
+}
+
+func gameSuspendedEvents() []events.GameSuspended {
+	recorded.Lock()
+	defer recorded.Unlock()
+
+	var gss []events.GameSuspended
+	for _, e := range recorded.events {
+		if gs, ok := e.(events.GameSuspended); ok {
+			gss = append(gss, gs)
+		}
+	}
+
+	return gss
+}
+
+// behaviour writes the response to a TicTacToe.NextMove call given the game
+// state sent to the bot.
+type behaviour func(fb *fakeBot, w http.ResponseWriter, gameState []string)
+
+// playFirstFree plays the first empty position, so the first player always wins
+// down the diagonal from the top right.
+func playFirstFree(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	for i, m := range gameState {
+		if m == "" {
+			writeResult(w, map[string]int{"position": i})
+			return
+		}
+	}
+	writeResult(w, map[string]int{"position": -1})
+}
+
+// playTopLeft always plays the top left position, which is an illegal move once
+// it has been taken.
+func playTopLeft(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	writeResult(w, map[string]int{"position": 0})
+}
+
+const garbageResponse = "<html><body>Bad Gateway... just kidding</body></html>"
+
+// respondGarbage responds successfully with something that isn't JSON.
+func respondGarbage(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	w.Write([]byte(garbageResponse))
+}
+
+const nullResultResponse = `{"jsonrpc":"2.0","result":null,"id":1}`
+
+// respondNullResult responds with well-formed JSON-RPC that has no result.
+func respondNullResult(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(nullResultResponse))
+}
+
+const errorResponse = `{"jsonrpc":"2.0","error":"I don't know how to play","id":1}`
+
+// respondError responds with well-formed JSON-RPC reporting an error.
+func respondError(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(errorResponse))
+}
+
+// hang doesn't respond until after the RPC response timeout has passed or the
+// bot is closed.
+func hang(fb *fakeBot, w http.ResponseWriter, gameState []string) {
+	select {
+	case <-fb.release:
+	case <-time.After(hangFor):
+	}
+	playFirstFree(fb, w, gameState)
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"result":  result,
+		"id":      1,
+	})
+}
+
+// botCall is a single RPC call received by a fake bot.
+type botCall struct {
+	Method string
+	Params json.RawMessage
+}
+
+// completeCall is the params of a TicTacToe.Complete or
+// TicTacToeDoubles.Complete notification.
+type completeCall struct {
+	GameId int    `json:"gameid"`
+	Winner bool   `json:"winner"`
+	Mark   string `json:"mark"`
+}
+
+// fakeBot is a Tic-Tac-Toe, or Tic-Tac-Toe Doubles, bot served by an httptest
+// server. It answers pings and notifications and plays moves with its scripted
+// behaviour, which may be changed whilst it is running. Every call it receives
+// is recorded.
+type fakeBot struct {
+	server  *httptest.Server
+	release chan bool
+
+	lock  sync.Mutex
+	play  behaviour
+	calls []botCall
+}
+
+func newFakeBot(play behaviour) *fakeBot {
+	fb := &fakeBot{
+		release: make(chan bool),
+		play:    play,
+	}
+	fb.server = httptest.NewServer(fb)
+
+	return fb
+}
+
+func (fb *fakeBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fb.lock.Lock()
+	fb.calls = append(fb.calls, botCall{Method: req.Method, Params: req.Params})
+	play := fb.play
+	fb.lock.Unlock()
+
+	if req.Method != games.TICTACTOE_RPC_METHOD_NEXT_MOVE && req.Method != games.TICTACTOE_DOUBLES_RPC_METHOD_NEXT_MOVE {
+		writeResult(w, map[string]string{"ping": "OK"})
+		return
+	}
+
+	var params struct {
+		GameState []string `json:"gamestate"`
+	}
+	err = json.Unmarshal(req.Params, &params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	play(fb, w, params.GameState)
+}
+
+func (fb *fakeBot) URL() string {
+	return fb.server.URL
+}
+
+func (fb *fakeBot) setBehaviour(play behaviour) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	fb.play = play
+}
+
+func (fb *fakeBot) callsTo(method string) []botCall {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	var calls []botCall
+	for _, c := range fb.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// completeCalls returns the Complete notifications received by the bot.
+func (fb *fakeBot) completeCalls(t *testing.T) []completeCall {
+	calls := fb.callsTo(games.TICTACTOE_RPC_METHOD_COMPLETE)
+	calls = append(calls, fb.callsTo(games.TICTACTOE_DOUBLES_RPC_METHOD_COMPLETE)...)
+
+	var ccs []completeCall
+	for _, c := range calls {
+		var cc completeCall
+		err := json.Unmarshal(c.Params, &cc)
+		if err != nil {
+			t.Fatalf("Error parsing Complete params %s: %s", c.Params, err)
+		}
+		ccs = append(ccs, cc)
+	}
+
+	return ccs
+}
+
+// Close releases any hanging calls and then stops the server.
+func (fb *fakeBot) Close() {
+	close(fb.release)
+	fb.server.Close()
+}
+
+// newUser creates a user and returns it along with a token it can register bots
+// with.
+func newUser(t *testing.T, name string) (repository.User, string) {
+	user, err := repository.CreateUser(name, fmt.Sprintf("%s@example.com", strings.ToLower(name)), "")
+	if err != nil {
+		t.Fatalf("Error creating user %s: %s", name, err)
+	}
+
+	token, err := user.CreateToken("End-to-end tests")
+	if err != nil {
+		t.Fatalf("Error creating token for %s: %s", name, err)
+	}
+
+	return user, token.Token
+}
+
+// register registers the fake bot as a ranked Tic-Tac-Toe bot and returns the
+// bot that was registered along with the reply.
+func register(t *testing.T, token string, name string, fb *fakeBot) (repository.Bot, RegistrationReply) {
+	return registerForGame(t, token, name, games.TICTACTOE_MNEMONIC, fb)
+}
+
+// registerForGame registers the fake bot as a ranked bot for the game with the
+// given mnemonic.
+func registerForGame(t *testing.T, token string, name string, game string, fb *fakeBot) (repository.Bot, RegistrationReply) {
+	args := RegistrationArgs{
+		BotName:             name,
+		BotVersion:          "1.0.0",
+		Game:                game,
+		Token:               token,
+		RPCEndpoint:         fb.URL(),
+		ProgrammingLanguage: "Go",
+		Mode:                REGISTRATION_MODE_RANKED,
+	}
+	var reply RegistrationReply
+	err := new(RegistrationService).Register(nil, &args, &reply)
+	if err != nil {
+		t.Fatalf("Error registering %s: %s", name, err)
+	}
+
+	bot, err := repository.GetBotByNameAndVersion(name, args.BotVersion)
+	if err != nil {
+		t.Fatalf("Error retrieving %s: %s", name, err)
+	}
+
+	return bot, reply
+}
+
+// waitFor polls until done returns true, failing the test if it errors or
+// doesn't return true within waitTimeout.
+func waitFor(t *testing.T, what string, done func() (bool, error)) {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		ok, err := done()
+		if err != nil {
+			t.Fatalf("Error waiting for %s: %s", what, err)
+		}
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out after %s waiting for %s", waitTimeout, what)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// waitForCalls waits until the bot has received at least count calls to the
+// method.
+func waitForCalls(t *testing.T, fb *fakeBot, method string, count int) {
+	waitFor(t, fmt.Sprintf("%d calls to %s", count, method), func() (bool, error) {
+		return len(fb.callsTo(method)) >= count, nil
+	})
+}
+
+func reloadBot(t *testing.T, bot repository.Bot) repository.Bot {
+	b, err := repository.GetBotById(bot.Id)
+	if err != nil {
+		t.Fatalf("Error retrieving bot %d: %s", bot.Id, err)
+	}
+
+	return b
+}
+
+func reloadGame(t *testing.T, game repository.Game) repository.Game {
+	g, err := repository.GetGameById(game.Id)
+	if err != nil {
+		t.Fatalf("Error retrieving game %d: %s", game.Id, err)
+	}
+
+	return g
+}
+
+func gamesPlayed(t *testing.T, bot repository.Bot) []repository.Game {
+	gameList, err := bot.GamesPlayed()
+	if err != nil {
+		t.Fatalf("Error listing games for %s: %s", bot.Name, err)
+	}
+
+	return gameList
+}
+
+// winningBot returns the bot that made the winning move of the game.
+func winningBot(t *testing.T, game repository.Game) repository.Bot {
+	gm, err := game.WinningMove()
+	if err != nil {
+		t.Fatalf("Error retrieving the winning move of game %d: %s", game.Id, err)
+	}
+
+	gb, err := gm.GameBot()
+	if err != nil {
+		t.Fatalf("Error retrieving the winner of game %d: %s", game.Id, err)
+	}
+
+	bot, err := gb.Bot()
+	if err != nil {
+		t.Fatalf("Error retrieving the winner of game %d: %s", game.Id, err)
+	}
+
+	return bot
+}
+
+// openFailedMoves returns the open failures of the games stuck on the user's
+// bots.
+func openFailedMoves(t *testing.T, user repository.User) []repository.FailedMove {
+	stuck, err := repository.ListStuckGames(user.Id)
+	if err != nil {
+		t.Fatalf("Error listing stuck games: %s", err)
+	}
+
+	var failed []repository.FailedMove
+	for _, s := range stuck {
+		f, ok, err := s.FailedMove()
+		if err != nil {
+			t.Fatalf("Error retrieving failed move: %s", err)
+		}
+		if ok && f.Status == repository.FAILED_MOVE_STATUS_OPEN {
+			failed = append(failed, f)
+		}
+	}
+
+	return failed
+}
+
+// waitForStuckGames waits until the bot is in error and the given number of its
+// owner's games are stuck waiting on it.
+func waitForStuckGames(t *testing.T, user repository.User, bot repository.Bot, count int) {
+	waitFor(t, fmt.Sprintf("%s to be in error with %d stuck games", bot.Name, count), func() (bool, error) {
+		b, err := repository.GetBotById(bot.Id)
+		if err != nil {
+			return false, err
+		}
+
+		stuck, err := repository.ListStuckGames(user.Id)
+		if err != nil {
+			return false, err
+		}
+
+		return b.Status == repository.BOT_STATUS_ERROR && len(stuck) == count, nil
+	})
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// getFailedMoveForUser returns the failed move if the user owns the bot whose
+// move failed or is an administrator.
+func getFailedMoveForUser(user repository.User, failedMoveId int) (repository.FailedMove, repository.Bot, error) {
+	f, err := repository.GetFailedMoveById(failedMoveId)
+	if err != nil {
+		return repository.FailedMove{}, repository.Bot{}, err
+	}
+
+	bot, err := f.Bot()
+	if err != nil {
+		return repository.FailedMove{}, repository.Bot{}, err
+	}
+
+	if !user.Admin {
+		botUser, err := bot.User()
+		if err != nil {
+			return repository.FailedMove{}, repository.Bot{}, err
+		}
+
+		if botUser.Id != user.Id {
+			return repository.FailedMove{}, repository.Bot{}, errors.New("Only the owner of the bot or an administrator may resolve a failed move.")
+		}
+	}
+
+	return f, bot, nil
+}
+
+// RetryFailedMove queues the failed move to be played again. If the bot was
+// taken out of play by the failure it is pinged first and brought back online
+// if it responds, otherwise the move is left failed and the ping error returned.
+func RetryFailedMove(user repository.User, failedMoveId int) (repository.FailedMove, error) {
+	f, bot, err := getFailedMoveForUser(user, failedMoveId)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	if bot.Status == repository.BOT_STATUS_ERROR {
+		err = gameworker.PingBot(&bot)
+		if err != nil {
+			return repository.FailedMove{}, err
+		}
+	}
+
+	// The move is queued again as part of retrying it.
+	err = f.Retry(user)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	return repository.GetFailedMoveById(f.Id)
+}
+
+// SkipFailedMove forfeits the game for the bot whose move failed, the player due
+// to move next winning the game.
+func SkipFailedMove(user repository.User, failedMoveId int) (repository.FailedMove, error) {
+	f, _, err := getFailedMoveForUser(user, failedMoveId)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gm, err := f.GameMove()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gameBot, err := gm.GameBot()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	game, err := gameBot.Game()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gameType, err := game.GameType()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gameManager, err := games.GetGameManager(gameType)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	winner, err := gameManager.GetGameBotForNextMove(gm)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	players, err := game.Players()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	err = f.Skip(user, winner, func(tx *repository.Tx) error {
+		return gameworker.RateGameTx(tx, game, players, winner.Team)
+	})
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	// The Complete notifications are handled as for any other completed game.
+	events.Publish(events.GameCompleted{
+		Game:     game,
+		GameType: gameType,
+		Result:   string(games.GAME_RESULT_WIN),
+		Players:  players,
+	})
+
+	return repository.GetFailedMoveById(f.Id)
+}
+
+// AbandonFailedMove abandons the game the failed move belongs to, leaving it
+// without a result.
+func AbandonFailedMove(user repository.User, failedMoveId int) (repository.FailedMove, error) {
+	f, _, err := getFailedMoveForUser(user, failedMoveId)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gm, err := f.GameMove()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	gameBot, err := gm.GameBot()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	game, err := gameBot.Game()
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	err = f.Abandon(user)
+	if err != nil {
+		return repository.FailedMove{}, err
+	}
+
+	// An abandoned qualification game may have been the last one its qualifying
+	// player was waiting on.
+	if game.Kind == repository.GAME_KIND_QUALIFICATION {
+		players, err := game.Players()
+		if err != nil {
+			return repository.FailedMove{}, err
+		}
+		gameworker.EvaluateQualifyingPlayers(players)
+	}
+
+	return repository.GetFailedMoveById(f.Id)
+}
+
+// ListStuckGames lists every stuck game for administrators and the games stuck
+// on one of their own bots for anyone else.
+func ListStuckGames(user repository.User) ([]repository.StuckGame, error) {
+	if user.Admin {
+		return repository.ListStuckGames(0)
+	}
+
+	return repository.ListStuckGames(user.Id)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mleonard87/merknera/rating"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// SetRatingEngine changes the rating engine used to rate games of a game type.
+// Ratings from the previous engine are kept but no longer updated.
+func SetRatingEngine(user repository.User, mnemonic string, engineName string) (repository.GameType, error) {
+	if !user.Admin {
+		return repository.GameType{}, errors.New("Only administrators may change the rating engine of a game type.")
+	}
+
+	engine, err := rating.GetEngine(strings.ToUpper(engineName))
+	if err != nil {
+		return repository.GameType{}, err
+	}
+
+	gameType, err := repository.GetGameTypeByMnemonic(mnemonic)
+	if err != nil {
+		return repository.GameType{}, err
+	}
+
+	err = gameType.SetRatingEngine(engine.Name())
+	if err != nil {
+		return gameType, err
+	}
+
+	return gameType, nil
+}
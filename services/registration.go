@@ -10,8 +10,14 @@ import (
 
 	"fmt"
 
+	"strings"
+
+	"sync/atomic"
+
+	"github.com/mleonard87/merknera/events"
 	"github.com/mleonard87/merknera/games"
 	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/metrics"
 	"github.com/mleonard87/merknera/repository"
 )
 
@@ -24,16 +30,64 @@ type RegistrationArgs struct {
 	ProgrammingLanguage string `json:"programminglanguage"`
 	Website             string `json:"website"`
 	Description         string `json:"description"`
+	Mode                string `json:"mode"`
+	MaxConcurrency      int    `json:"maxconcurrency"`
 }
 
+const (
+	REGISTRATION_MODE_RANKED  = "RANKED"
+	REGISTRATION_MODE_SANDBOX = "SANDBOX"
+	// In STAGED mode a new version of an existing bot must qualify before it
+	// replaces the current version.
+	REGISTRATION_MODE_STAGED = "STAGED"
+)
+
 type RegistrationReply struct {
-	Message string `json:"message"`
+	Message     string `json:"message"`
+	GamesQueued int    `json:"gamesqueued"`
 }
 
 type RegistrationService struct{}
 
+var registrations = metrics.NewCounter(
+	"merknera_registrations_total",
+	"Successful bot registrations, by game type and registration mode.",
+	"game_type",
+	"mode",
+)
+
+func init() {
+	events.Subscribe(events.BOT_REGISTERED, func(e events.Event) {
+		if br, ok := e.(events.BotRegistered); ok {
+			registrations.Inc(br.GameType.Mnemonic, br.Mode)
+		}
+	})
+}
+
+// registrationsStopped is set to 1 once Merknera starts shutting down.
+var registrationsStopped int32
+
+// StopRegistrations makes any further registrations fail so that no new games
+// are created whilst Merknera is shutting down.
+func StopRegistrations() {
+	atomic.StoreInt32(&registrationsStopped, 1)
+}
+
 func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs, reply *RegistrationReply) error {
+	if atomic.LoadInt32(&registrationsStopped) == 1 {
+		return errors.New("Merknera is shutting down and is not accepting registrations, please try again shortly.")
+	}
+
 	log.Printf("Registering %s (%s)\n", args.BotName, args.BotVersion)
+	mode := strings.ToUpper(args.Mode)
+	if mode == "" {
+		mode = REGISTRATION_MODE_RANKED
+	}
+	if mode != REGISTRATION_MODE_RANKED && mode != REGISTRATION_MODE_SANDBOX && mode != REGISTRATION_MODE_STAGED {
+		em := fmt.Sprintf("Unknown registration mode \"%s\". The mode must be one of %s, %s or %s.", args.Mode, REGISTRATION_MODE_RANKED, REGISTRATION_MODE_SANDBOX, REGISTRATION_MODE_STAGED)
+		return errors.New(em)
+	}
+
 	gameType, err := repository.GetGameTypeByMnemonic(args.Game)
 	if err != nil {
 		return err
@@ -85,7 +139,13 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 
 		if !exists {
 
-			bot, err = repository.RegisterBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+			if mode == REGISTRATION_MODE_SANDBOX {
+				bot, err = repository.RegisterSandboxBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+			} else if mode == REGISTRATION_MODE_STAGED && bot.Stage == repository.BOT_STAGE_RANKED {
+				bot, err = repository.RegisterQualifyingBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+			} else {
+				bot, err = repository.RegisterBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+			}
 			if err != nil {
 				em := "An error occurred whilst registering your bot."
 				log.Printf("%s\n%s\n", em, err)
@@ -99,11 +159,23 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 				return errors.New(em)
 			}
 
-			bot.Logf("Registered %s (version: %s)", bot.Name, bot.Version)
+			events.Publish(events.BotRegistered{Bot: bot, GameType: gameType, Mode: mode})
 			responseMessage := fmt.Sprintf("A new version of your bot has been registered as %s (version: %s), good luck with %s!", bot.Name, bot.Version, gt.Name)
+			if bot.Stage == repository.BOT_STAGE_SANDBOX {
+				responseMessage = fmt.Sprintf("A new version of your bot has been registered in the sandbox as %s (version: %s). Its games will not count towards your score until it is promoted.", bot.Name, bot.Version)
+			} else if bot.Stage == repository.BOT_STAGE_QUALIFYING {
+				responseMessage = fmt.Sprintf("A new version of your bot has been registered as %s (version: %s). It must score at least %.2f in its qualification games to replace your current version.", bot.Name, bot.Version, gameworker.QualificationThreshold())
+			}
 			reply.Message = responseMessage
 		} else {
-			bot.Logf("Re-registered %s (version: %s)", bot.Name, bot.Version)
+			// A sandbox version and a ranked version of a bot may both be current
+			// so make sure we re-register the version that was asked for.
+			versionBot, err := repository.GetBotByNameAndVersion(args.BotName, args.BotVersion)
+			if err == nil && versionBot.Status != repository.BOT_STATUS_SUPERSEDED {
+				bot = versionBot
+			}
+
+			events.Publish(events.BotRegistered{Bot: bot, GameType: gameType, Mode: mode, Reregistered: true})
 			responseMessage := fmt.Sprintf(`Hello, %s. The version \"%s\" of your bot is already registered. RPC Endpoint, Programming Language, Website and Description have been updated. No new games will
 		be scheduled but your bot will marked as online and if there are any outstanding games they will be
 		continued.`, bot.Name, bot.Version)
@@ -111,18 +183,42 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 
 			err = bot.Update(args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
 			if err != nil {
-				log.Fatal(err)
+				em := "An error occurred whilst registering your bot."
+				log.Printf("%s\n%s\n", em, err)
+				return errors.New(em)
 			}
 
-			// Mark the bot as online again.
+			err = setMaxConcurrency(&bot, args.MaxConcurrency)
+			if err != nil {
+				em := "An error occurred whilst registering your bot."
+				log.Printf("%s\n%s\n", em, err)
+				return errors.New(em)
+			}
+
+			// Mark the bot as online again. Registering shows the bot can be
+			// reached so any open circuit for its endpoint is closed.
+			from := bot.Status
 			err = bot.MarkOnline()
 			if err != nil {
-				log.Fatal(err)
+				em := "An error occurred whilst registering your bot."
+				log.Printf("%s\n%s\n", em, err)
+				return errors.New(em)
+			}
+			gameworker.ResetCircuit(bot.RPCEndpoint)
+			if from != repository.BOT_STATUS_ONLINE {
+				events.Publish(events.BotStatusChanged{
+					Bot:    bot,
+					From:   from,
+					To:     bot.Status,
+					Reason: "the bot re-registered",
+				})
 			}
 
 			awaitingMoves, err := bot.ListAwaitingMoves()
 			if err != nil {
-				log.Fatal(err)
+				em := "An error occurred whilst continuing your bot's games."
+				log.Printf("%s\n%s\n", em, err)
+				return errors.New(em)
 			}
 
 			for _, am := range awaitingMoves {
@@ -132,7 +228,11 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 			return nil
 		}
 	} else {
-		bot, err = repository.RegisterBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+		if mode == REGISTRATION_MODE_SANDBOX {
+			bot, err = repository.RegisterSandboxBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+		} else {
+			bot, err = repository.RegisterBot(args.BotName, args.BotVersion, gameType, user, args.RPCEndpoint, args.ProgrammingLanguage, args.Website, args.Description)
+		}
 		if err != nil {
 			em := "An error occurred whilst registering your bot."
 			log.Printf("%s\n%s\n", em, err)
@@ -146,11 +246,23 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 			return errors.New(em)
 		}
 
-		bot.Logf("Registered %s (version: %s)", bot.Name, bot.Version)
+		events.Publish(events.BotRegistered{Bot: bot, GameType: gameType, Mode: mode})
 		responseMessage := fmt.Sprintf("Hello, %s (version: %s), good luck with %s!", bot.Name, bot.Version, gt.Name)
+		if bot.Stage == repository.BOT_STAGE_SANDBOX {
+			responseMessage = fmt.Sprintf("Hello, %s (version: %s), you have been registered in the sandbox. Your games will not count towards your score until you are promoted.", bot.Name, bot.Version)
+		}
 		reply.Message = responseMessage
 	}
 
+	err = setMaxConcurrency(&bot, args.MaxConcurrency)
+	if err != nil {
+		em := "An error occurred whilst registering your bot."
+		log.Printf("%s\n%s\n", em, err)
+		return errors.New(em)
+	}
+
+	gameworker.ResetCircuit(bot.RPCEndpoint)
+
 	gameManager, err := games.GetGameManager(gameType)
 	if err != nil {
 		em := "An error occurred whilst registering your bot."
@@ -158,16 +270,87 @@ func (h *RegistrationService) Register(r *http.Request, args *RegistrationArgs,
 		return errors.New(em)
 	}
 
-	games := gameManager.GenerateGames(bot)
-	for _, g := range games {
-		gameMove, err := g.NextGameMove()
+	var pairings []repository.Pairing
+	if bot.Stage == repository.BOT_STAGE_SANDBOX {
+		pairings, err = generateUnrankedGames(gameManager, bot, repository.GAME_KIND_SANDBOX)
+		if err != nil {
+			em := "An error occurred whilst generating games for your bot."
+			log.Printf("%s\n%s\n", em, err)
+			return errors.New(em)
+		}
+	} else if bot.Stage == repository.BOT_STAGE_QUALIFYING {
+		pairings, err = generateUnrankedGames(gameManager, bot, repository.GAME_KIND_QUALIFICATION)
+		if err != nil {
+			em := "An error occurred whilst generating games for your bot."
+			log.Printf("%s\n%s\n", em, err)
+			return errors.New(em)
+		}
+
+		// With no opponents to qualify against the bot qualifies immediately.
+		if len(pairings) == 0 {
+			err = gameworker.EvaluateQualification(bot)
+			if err != nil {
+				em := "An error occurred whilst qualifying your bot."
+				log.Printf("%s\n%s\n", em, err)
+				return errors.New(em)
+			}
+			return nil
+		}
+	} else {
+		pairings, err = gameManager.GenerateGames(bot)
 		if err != nil {
 			em := "An error occurred whilst generating games for your bot."
 			log.Printf("%s\n%s\n", em, err)
 			return errors.New(em)
 		}
-		gameworker.QueueGameMove(gameMove)
+	}
+
+	regressionPairings, err := generateUnrankedGames(gameManager, bot, repository.GAME_KIND_REGRESSION)
+	if err != nil {
+		em := "An error occurred whilst generating regression games for your bot."
+		log.Printf("%s\n%s\n", em, err)
+		return errors.New(em)
+	}
+	pairings = append(pairings, regressionPairings...)
+
+	// Rather than creating every game now the pairings are added to the backlog
+	// and their games created as the backlog scheduler releases them, so that
+	// registration isn't held up and the games don't sit waiting to be played.
+	err = repository.AddToBacklog(pairings)
+	if err != nil {
+		em := "An error occurred whilst generating games for your bot."
+		log.Printf("%s\n%s\n", em, err)
+		return errors.New(em)
+	}
+	reply.GamesQueued = len(pairings)
+	reply.Message = fmt.Sprintf("%s %d games have been queued.", reply.Message, len(pairings))
+
+	// Let the owner know when previous versions were left out of regression
+	// games rather than silently scheduling nothing against them.
+	_, sharingEndpoint, err := previousVersions(bot)
+	if err != nil {
+		em := "An error occurred whilst generating regression games for your bot."
+		log.Printf("%s\n%s\n", em, err)
+		return errors.New(em)
+	}
+	if len(sharingEndpoint) > 0 {
+		var versions []string
+		for _, pv := range sharingEndpoint {
+			versions = append(versions, pv.Version)
+		}
+		reply.Message = fmt.Sprintf("%s No regression games were queued against version(s) %s as they share this version's RPC endpoint, register on a different endpoint to play them.", reply.Message, strings.Join(versions, ", "))
 	}
 
 	return nil
 }
+
+// setMaxConcurrency records how many moves the bot is willing to play at once.
+// If the bot doesn't declare a limit its current limit is kept. The server
+// maximum is applied when moves are dispatched so it isn't applied here.
+func setMaxConcurrency(bot *repository.Bot, maxConcurrency int) error {
+	if maxConcurrency < 1 {
+		return nil
+	}
+
+	return bot.SetMaxConcurrency(maxConcurrency)
+}
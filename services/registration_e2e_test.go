@@ -0,0 +1,536 @@
+//go:build integration
+// +build integration
+
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/repository"
+)
+
+func TestRegisterPlaysGamesToCompletion(t *testing.T) {
+	resetDatabase(t)
+
+	alphaBot := newFakeBot(playFirstFree)
+	defer alphaBot.Close()
+	bravoBot := newFakeBot(playFirstFree)
+	defer bravoBot.Close()
+
+	_, alphaToken := newUser(t, "Alpha")
+	_, bravoToken := newUser(t, "Bravo")
+
+	alpha, reply := register(t, alphaToken, "alpha", alphaBot)
+	if reply.GamesQueued != 0 {
+		t.Fatalf("Expected no games to be queued without an opponent, %d were queued", reply.GamesQueued)
+	}
+
+	bravo, reply := register(t, bravoToken, "bravo", bravoBot)
+	if reply.GamesQueued != 2 {
+		t.Fatalf("Expected 2 games to be queued, %d were queued", reply.GamesQueued)
+	}
+
+	waitFor(t, "both games to complete", func() (bool, error) {
+		return len(gameCompletedEvents()) == 2, nil
+	})
+
+	for _, gc := range gameCompletedEvents() {
+		if gc.Result != string(games.GAME_RESULT_WIN) {
+			t.Errorf("Expected game %d to be won, the result was %s", gc.Game.Id, gc.Result)
+		}
+	}
+
+	gameList := gamesPlayed(t, bravo)
+	if len(gameList) != 2 {
+		t.Fatalf("Expected bravo to have played 2 games, it played %d", len(gameList))
+	}
+	for _, g := range gameList {
+		if g.Status != repository.GAME_STATUS_COMPLETE {
+			t.Errorf("Expected game %d to be %s, it is %s", g.Id, repository.GAME_STATUS_COMPLETE, g.Status)
+			continue
+		}
+
+		moves, err := g.Moves()
+		if err != nil {
+			t.Fatalf("Error listing moves for game %d: %s", g.Id, err)
+		}
+		// Playing the first free position the first player wins on their
+		// fourth move.
+		if len(moves) != 7 {
+			t.Errorf("Expected game %d to have 7 moves, it has %d", g.Id, len(moves))
+		}
+		for _, gm := range moves {
+			if gm.Status != repository.GAMEMOVE_STATUS_COMPLETE {
+				t.Errorf("Expected move %d of game %d to be %s, it is %s", gm.Id, g.Id, repository.GAMEMOVE_STATUS_COMPLETE, gm.Status)
+			}
+		}
+
+		gm, err := g.WinningMove()
+		if err != nil {
+			t.Fatalf("Error retrieving the winning move of game %d: %s", g.Id, err)
+		}
+		gb, err := gm.GameBot()
+		if err != nil {
+			t.Fatalf("Error retrieving the winner of game %d: %s", g.Id, err)
+		}
+		if gb.PlaySequence != 1 {
+			t.Errorf("Expected the first player to win game %d, play sequence %d won", g.Id, gb.PlaySequence)
+		}
+	}
+
+	// Each bot plays first once so each wins once.
+	for _, fb := range []*fakeBot{alphaBot, bravoBot} {
+		waitForCalls(t, fb, games.TICTACTOE_RPC_METHOD_COMPLETE, 2)
+		ccs := fb.completeCalls(t)
+		if len(ccs) != 2 {
+			t.Errorf("Expected 2 Complete notifications, %d were received", len(ccs))
+			continue
+		}
+
+		wins := 0
+		for _, cc := range ccs {
+			if cc.Winner {
+				wins++
+			}
+		}
+		if wins != 1 {
+			t.Errorf("Expected to be notified of 1 win, %d were received", wins)
+		}
+	}
+
+	for _, b := range []repository.Bot{alpha, bravo} {
+		b = reloadBot(t, b)
+		if b.Status != repository.BOT_STATUS_ONLINE {
+			t.Errorf("Expected %s to be %s, it is %s", b.Name, repository.BOT_STATUS_ONLINE, b.Status)
+		}
+	}
+
+	stuck, err := repository.ListStuckGames(0)
+	if err != nil {
+		t.Fatalf("Error listing stuck games: %s", err)
+	}
+	if len(stuck) != 0 {
+		t.Errorf("Expected no stuck games, there are %d", len(stuck))
+	}
+}
+
+func TestRegisterPlaysTeamGamesToCompletion(t *testing.T) {
+	resetDatabase(t)
+
+	names := []string{"alpha", "bravo", "charlie", "delta"}
+	var bots []repository.Bot
+	var fakeBots []*fakeBot
+	for _, name := range names {
+		fb := newFakeBot(playFirstFree)
+		defer fb.Close()
+
+		_, token := newUser(t, strings.Title(name))
+		bot, reply := registerForGame(t, token, name, games.TICTACTOE_DOUBLES_MNEMONIC, fb)
+
+		// Two teams of two can't be made up until the fourth bot registers.
+		// It is then teamed up with and against each of the others in turn,
+		// once on each team.
+		expected := 0
+		if name == "delta" {
+			expected = 6
+		}
+		if reply.GamesQueued != expected {
+			t.Fatalf("Expected %d games to be queued for %s, %d were queued", expected, name, reply.GamesQueued)
+		}
+
+		bots = append(bots, bot)
+		fakeBots = append(fakeBots, fb)
+	}
+	delta := bots[3]
+	deltaBot := fakeBots[3]
+
+	waitFor(t, "all games to complete", func() (bool, error) {
+		return len(gameCompletedEvents()) == 6, nil
+	})
+
+	gameList := gamesPlayed(t, delta)
+	if len(gameList) != 6 {
+		t.Fatalf("Expected delta to have played 6 games, it played %d", len(gameList))
+	}
+	for _, g := range gameList {
+		if g.Status != repository.GAME_STATUS_COMPLETE {
+			t.Errorf("Expected game %d to be %s, it is %s", g.Id, repository.GAME_STATUS_COMPLETE, g.Status)
+			continue
+		}
+
+		players, err := g.Players()
+		if err != nil {
+			t.Fatalf("Error listing players for game %d: %s", g.Id, err)
+		}
+		if len(players) != 4 {
+			t.Fatalf("Expected game %d to have 4 players, it has %d", g.Id, len(players))
+		}
+		// The teams take turns, so the first bot of each team plays before the
+		// second bot of either.
+		for _, p := range players {
+			team := (p.PlaySequence-1)%2 + 1
+			if p.Team != team {
+				t.Errorf("Expected play sequence %d of game %d to be on team %d, it is on team %d", p.PlaySequence, g.Id, team, p.Team)
+			}
+		}
+
+		moves, err := g.Moves()
+		if err != nil {
+			t.Fatalf("Error listing moves for game %d: %s", g.Id, err)
+		}
+		// Playing the first free position the first team wins on its fourth
+		// move, made by the first team's second bot.
+		if len(moves) != 7 {
+			t.Errorf("Expected game %d to have 7 moves, it has %d", g.Id, len(moves))
+		}
+
+		winningTeam, err := g.WinningTeam()
+		if err != nil {
+			t.Fatalf("Error retrieving the winning team of game %d: %s", g.Id, err)
+		}
+		if winningTeam != 1 {
+			t.Errorf("Expected the first team to win game %d, team %d won", g.Id, winningTeam)
+		}
+	}
+
+	// Every bot is told who its teammate is.
+	for _, c := range deltaBot.callsTo(games.TICTACTOE_DOUBLES_RPC_METHOD_NEXT_MOVE) {
+		var params struct {
+			Mark      string           `json:"mark"`
+			Teammates []games.Teammate `json:"teammates"`
+		}
+		err := json.Unmarshal(c.Params, &params)
+		if err != nil {
+			t.Fatalf("Error parsing NextMove params %s: %s", c.Params, err)
+		}
+		if len(params.Teammates) != 1 || params.Teammates[0].Name == delta.Name {
+			t.Errorf("Expected delta to be told of its one teammate, it was told of %v", params.Teammates)
+		}
+	}
+
+	// Delta is on the first team in half of its games so wins half of them, and
+	// every member of the winning team is credited with the win.
+	waitForCalls(t, deltaBot, games.TICTACTOE_DOUBLES_RPC_METHOD_COMPLETE, 6)
+	ccs := deltaBot.completeCalls(t)
+	wins := 0
+	for _, cc := range ccs {
+		if cc.Winner {
+			wins++
+			if cc.Mark != "X" {
+				t.Errorf("Expected the winning team of game %d to play X, it played %s", cc.GameId, cc.Mark)
+			}
+		}
+	}
+	if len(ccs) != 6 || wins != 3 {
+		t.Errorf("Expected to be notified of 3 wins in 6 games, %d wins in %d games were received", wins, len(ccs))
+	}
+
+	stuck, err := repository.ListStuckGames(0)
+	if err != nil {
+		t.Fatalf("Error listing stuck games: %s", err)
+	}
+	if len(stuck) != 0 {
+		t.Errorf("Expected no stuck games, there are %d", len(stuck))
+	}
+}
+
+func TestRegisterIllegalMoveCanBeSkipped(t *testing.T) {
+	resetDatabase(t)
+
+	alphaBot := newFakeBot(playFirstFree)
+	defer alphaBot.Close()
+	bravoBot := newFakeBot(playTopLeft)
+	defer bravoBot.Close()
+
+	_, alphaToken := newUser(t, "Alpha")
+	bravoUser, bravoToken := newUser(t, "Bravo")
+
+	alpha, _ := register(t, alphaToken, "alpha", alphaBot)
+	bravo, _ := register(t, bravoToken, "bravo", bravoBot)
+
+	// Bravo plays the top left position in both games but alpha takes it first
+	// in one and bravo takes it itself in the other.
+	waitForStuckGames(t, bravoUser, bravo, 2)
+
+	if n := len(gameCompletedEvents()); n != 0 {
+		t.Fatalf("Expected no games to complete, %d completed", n)
+	}
+
+	suspended := gameSuspendedEvents()
+	if len(suspended) == 0 {
+		t.Fatalf("Expected a game to be suspended")
+	}
+	for _, gs := range suspended {
+		if gs.Bot.Id != bravo.Id {
+			t.Errorf("Expected game %d to be suspended by bravo, it was suspended by %s", gs.Game.Id, gs.Bot.Name)
+		}
+	}
+	waitForCalls(t, bravoBot, games.TICTACTOE_RPC_METHOD_ERROR, 1)
+
+	failed := openFailedMoves(t, bravoUser)
+	if len(failed) == 0 {
+		t.Fatalf("Expected the illegal move to be recorded as a failed move")
+	}
+	f := failed[0]
+	if f.Reason != repository.FAILED_MOVE_REASON_BOT_ERROR {
+		t.Errorf("Expected the failed move reason to be %s, it is %s", repository.FAILED_MOVE_REASON_BOT_ERROR, f.Reason)
+	}
+	if !strings.Contains(f.Error.String, "already taken") {
+		t.Errorf("Expected the failed move error to explain the position is taken, it is %q", f.Error.String)
+	}
+	if f.LastResponse.String != `{"position":0}` {
+		t.Errorf("Expected the failed move to record the response, it recorded %q", f.LastResponse.String)
+	}
+
+	gm, err := f.GameMove()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move: %s", err)
+	}
+	gb, err := gm.GameBot()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move's player: %s", err)
+	}
+	game, err := gb.Game()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move's game: %s", err)
+	}
+
+	// Skipping the move forfeits the game to alpha.
+	f, err = SkipFailedMove(bravoUser, f.Id)
+	if err != nil {
+		t.Fatalf("Error skipping the failed move: %s", err)
+	}
+	if f.Status != repository.FAILED_MOVE_STATUS_SKIPPED {
+		t.Errorf("Expected the failed move to be %s, it is %s", repository.FAILED_MOVE_STATUS_SKIPPED, f.Status)
+	}
+
+	waitFor(t, "the skipped game to complete", func() (bool, error) {
+		return len(gameCompletedEvents()) == 1, nil
+	})
+
+	game = reloadGame(t, game)
+	if game.Status != repository.GAME_STATUS_COMPLETE {
+		t.Fatalf("Expected the skipped game to be %s, it is %s", repository.GAME_STATUS_COMPLETE, game.Status)
+	}
+	if winner := winningBot(t, game); winner.Id != alpha.Id {
+		t.Errorf("Expected alpha to win the skipped game, %s won", winner.Name)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		fb     *fakeBot
+		winner bool
+	}{
+		{"alpha", alphaBot, true},
+		{"bravo", bravoBot, false},
+	} {
+		waitForCalls(t, tc.fb, games.TICTACTOE_RPC_METHOD_COMPLETE, 1)
+		ccs := tc.fb.completeCalls(t)
+		if len(ccs) != 1 || ccs[0].GameId != game.Id {
+			t.Errorf("Expected %s to be notified that game %d is complete, received %v", tc.name, game.Id, ccs)
+			continue
+		}
+		if ccs[0].Winner != tc.winner {
+			t.Errorf("Expected %s to be notified with winner %t", tc.name, tc.winner)
+		}
+	}
+
+	stuck, err := repository.ListStuckGames(bravoUser.Id)
+	if err != nil {
+		t.Fatalf("Error listing stuck games: %s", err)
+	}
+	if len(stuck) != 1 {
+		t.Errorf("Expected 1 game to still be stuck, there are %d", len(stuck))
+	}
+}
+
+func TestRegisterGarbageResponseCanBeAbandoned(t *testing.T) {
+	resetDatabase(t)
+
+	alphaBot := newFakeBot(playFirstFree)
+	defer alphaBot.Close()
+	bravoBot := newFakeBot(respondGarbage)
+	defer bravoBot.Close()
+
+	_, alphaToken := newUser(t, "Alpha")
+	bravoUser, bravoToken := newUser(t, "Bravo")
+
+	register(t, alphaToken, "alpha", alphaBot)
+	bravo, _ := register(t, bravoToken, "bravo", bravoBot)
+
+	waitForStuckGames(t, bravoUser, bravo, 2)
+
+	if n := len(gameCompletedEvents()); n != 0 {
+		t.Fatalf("Expected no games to complete, %d completed", n)
+	}
+	waitForCalls(t, bravoBot, games.TICTACTOE_RPC_METHOD_ERROR, 1)
+
+	failed := openFailedMoves(t, bravoUser)
+	if len(failed) == 0 {
+		t.Fatalf("Expected the garbage response to be recorded as a failed move")
+	}
+	f := failed[0]
+	if f.Reason != repository.FAILED_MOVE_REASON_BOT_ERROR {
+		t.Errorf("Expected the failed move reason to be %s, it is %s", repository.FAILED_MOVE_REASON_BOT_ERROR, f.Reason)
+	}
+	if f.LastResponse.String != garbageResponse {
+		t.Errorf("Expected the failed move to record the response, it recorded %q", f.LastResponse.String)
+	}
+
+	gm, err := f.GameMove()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move: %s", err)
+	}
+	gb, err := gm.GameBot()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move's player: %s", err)
+	}
+	game, err := gb.Game()
+	if err != nil {
+		t.Fatalf("Error retrieving the failed move's game: %s", err)
+	}
+
+	// Abandoning the move leaves the game without a result.
+	f, err = AbandonFailedMove(bravoUser, f.Id)
+	if err != nil {
+		t.Fatalf("Error abandoning the failed move: %s", err)
+	}
+	if f.Status != repository.FAILED_MOVE_STATUS_ABANDONED {
+		t.Errorf("Expected the failed move to be %s, it is %s", repository.FAILED_MOVE_STATUS_ABANDONED, f.Status)
+	}
+
+	game = reloadGame(t, game)
+	if game.Status != repository.GAME_STATUS_SUPERSEDED {
+		t.Errorf("Expected the abandoned game to be %s, it is %s", repository.GAME_STATUS_SUPERSEDED, game.Status)
+	}
+
+	moves, err := game.Moves()
+	if err != nil {
+		t.Fatalf("Error listing moves for game %d: %s", game.Id, err)
+	}
+	for _, gm := range moves {
+		if gm.Status == repository.GAMEMOVE_STATUS_AWAITING {
+			t.Errorf("Expected no moves of the abandoned game to be awaiting, move %d is", gm.Id)
+		}
+	}
+
+	if n := len(gameCompletedEvents()); n != 0 {
+		t.Errorf("Expected the abandoned game not to complete, %d games completed", n)
+	}
+}
+
+func TestRegisterResponseWithoutResultIsRecorded(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		play  behaviour
+		error string
+	}{
+		{"null result", respondNullResult, "did not contain a result object"},
+		{"error", respondError, "I don't know how to play"},
+	} {
+		resetDatabase(t)
+
+		alphaBot := newFakeBot(playFirstFree)
+		bravoBot := newFakeBot(tc.play)
+
+		_, alphaToken := newUser(t, "Alpha")
+		bravoUser, bravoToken := newUser(t, "Bravo")
+
+		register(t, alphaToken, "alpha", alphaBot)
+		bravo, _ := register(t, bravoToken, "bravo", bravoBot)
+
+		// The move mustn't be completed without a result, leaving the game
+		// with nothing to play next, it is recorded as a failed move.
+		waitForStuckGames(t, bravoUser, bravo, 2)
+
+		if n := len(gameCompletedEvents()); n != 0 {
+			t.Errorf("%s: Expected no games to complete, %d completed", tc.name, n)
+		}
+
+		failed := openFailedMoves(t, bravoUser)
+		if len(failed) == 0 {
+			t.Errorf("%s: Expected the response to be recorded as a failed move", tc.name)
+		}
+		for _, f := range failed {
+			if f.Reason != repository.FAILED_MOVE_REASON_BOT_ERROR {
+				t.Errorf("%s: Expected the failed move reason to be %s, it is %s", tc.name, repository.FAILED_MOVE_REASON_BOT_ERROR, f.Reason)
+			}
+			if !strings.Contains(f.Error.String, tc.error) {
+				t.Errorf("%s: Expected the failed move error to contain %q, it is %q", tc.name, tc.error, f.Error.String)
+			}
+		}
+
+		alphaBot.Close()
+		bravoBot.Close()
+	}
+}
+
+func TestRegisterTimeoutIsResumed(t *testing.T) {
+	resetDatabase(t)
+
+	alphaBot := newFakeBot(playFirstFree)
+	defer alphaBot.Close()
+	bravoBot := newFakeBot(hang)
+	defer bravoBot.Close()
+
+	_, alphaToken := newUser(t, "Alpha")
+	bravoUser, bravoToken := newUser(t, "Bravo")
+
+	register(t, alphaToken, "alpha", alphaBot)
+	bravo, _ := register(t, bravoToken, "bravo", bravoBot)
+
+	waitFor(t, "bravo to time out", func() (bool, error) {
+		for _, g := range gamesPlayed(t, bravo) {
+			moves, err := g.Moves()
+			if err != nil {
+				return false, err
+			}
+			for _, gm := range moves {
+				attempts, err := gm.RPCAttempts()
+				if err != nil {
+					return false, err
+				}
+				for _, a := range attempts {
+					if a.Method == games.TICTACTOE_RPC_METHOD_NEXT_MOVE && a.Error.Valid {
+						return true, nil
+					}
+				}
+			}
+		}
+		return false, nil
+	})
+
+	// Timing out isn't the bot's fault so its move is neither failed nor
+	// suspended, it is left to be played once the bot responds again.
+	if n := len(gameCompletedEvents()); n != 0 {
+		t.Fatalf("Expected no games to complete, %d completed", n)
+	}
+	if n := len(gameSuspendedEvents()); n != 0 {
+		t.Errorf("Expected no games to be suspended, %d were", n)
+	}
+	if failed := openFailedMoves(t, bravoUser); len(failed) != 0 {
+		t.Errorf("Expected no failed moves, there are %d", len(failed))
+	}
+	if b := reloadBot(t, bravo); b.Status == repository.BOT_STATUS_ERROR {
+		t.Errorf("Expected bravo not to be in error")
+	}
+
+	bravoBot.setBehaviour(playFirstFree)
+
+	waitFor(t, "both games to complete", func() (bool, error) {
+		return len(gameCompletedEvents()) == 2, nil
+	})
+
+	for _, g := range gamesPlayed(t, bravo) {
+		if g.Status != repository.GAME_STATUS_COMPLETE {
+			t.Errorf("Expected game %d to be %s, it is %s", g.Id, repository.GAME_STATUS_COMPLETE, g.Status)
+		}
+	}
+	waitForCalls(t, bravoBot, games.TICTACTOE_RPC_METHOD_COMPLETE, 2)
+	if n := len(bravoBot.completeCalls(t)); n != 2 {
+		t.Errorf("Expected bravo to be notified that both games are complete, it was notified of %d", n)
+	}
+}
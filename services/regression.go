@@ -0,0 +1,24 @@
+package services
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	ENVVAR_REGRESSION_VERSIONS = "MERKNERA_REGRESSION_VERSIONS"
+
+	// The default number of previous versions a newly registered version plays
+	// regression games against. Setting MERKNERA_REGRESSION_VERSIONS to 0
+	// disables regression games.
+	DEFAULT_REGRESSION_VERSIONS = 3
+)
+
+func regressionVersions() int {
+	versions, err := strconv.Atoi(os.Getenv(ENVVAR_REGRESSION_VERSIONS))
+	if err != nil || versions < 0 {
+		return DEFAULT_REGRESSION_VERSIONS
+	}
+
+	return versions
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/mleonard87/merknera/gameworker"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// PromoteBot moves a users sandbox or qualifying bot into ranked play,
+// superseding any other version of the bot, and schedules its ranked games.
+func PromoteBot(user repository.User, botId int) (repository.Bot, error) {
+	bot, err := repository.GetBotById(botId)
+	if err != nil {
+		return repository.Bot{}, err
+	}
+
+	botUser, err := bot.User()
+	if err != nil {
+		return repository.Bot{}, err
+	}
+
+	if botUser.Id != user.Id {
+		return repository.Bot{}, errors.New("You may only promote your own bots.")
+	}
+
+	err = gameworker.PromoteBot(&bot)
+	if err != nil {
+		return bot, err
+	}
+
+	return bot, nil
+}
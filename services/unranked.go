@@ -0,0 +1,82 @@
+package services
+
+import (
+	"github.com/mleonard87/merknera/games"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// unrankedOpponents returns the bots that a newly registered bot plays unrated
+// games of the given kind against. Qualifying bots play every ranked bot and
+// sandbox bots every available sandbox opponent, other than their own previous
+// versions. Regression games are played against the most recent previous
+// versions that don't share the new version's RPC endpoint.
+func unrankedOpponents(bot repository.Bot, kind repository.GameKind) ([]repository.Bot, error) {
+	if kind == repository.GAME_KIND_REGRESSION {
+		opponents, _, err := previousVersions(bot)
+		return opponents, err
+	}
+
+	gameType, err := bot.GameType()
+	if err != nil {
+		return []repository.Bot{}, err
+	}
+
+	var candidates []repository.Bot
+	if kind == repository.GAME_KIND_SANDBOX {
+		candidates, err = repository.ListSandboxOpponentsForGameType(gameType)
+	} else {
+		candidates, err = repository.ListBotsForGameType(gameType)
+	}
+	if err != nil {
+		return []repository.Bot{}, err
+	}
+
+	// Never play against another version of ourselves.
+	var opponents []repository.Bot
+	for _, o := range candidates {
+		if o.Name != bot.Name {
+			opponents = append(opponents, o)
+		}
+	}
+
+	return opponents, nil
+}
+
+// previousVersions splits the most recent previous versions of the bot into
+// those it can play regression games against and those that share its RPC
+// endpoint. The new version will be the one answering on a shared endpoint so
+// regression games can't be played against those versions.
+func previousVersions(bot repository.Bot) ([]repository.Bot, []repository.Bot, error) {
+	previous, err := repository.ListPreviousVersions(bot, regressionVersions())
+	if err != nil {
+		return []repository.Bot{}, []repository.Bot{}, err
+	}
+
+	var opponents []repository.Bot
+	var sharingEndpoint []repository.Bot
+	for _, pv := range previous {
+		if pv.RPCEndpoint == bot.RPCEndpoint {
+			sharingEndpoint = append(sharingEndpoint, pv)
+		} else {
+			opponents = append(opponents, pv)
+		}
+	}
+
+	return opponents, sharingEndpoint, nil
+}
+
+// generateUnrankedGames pairs a newly registered bot with its opponents for the
+// given kind of unrated game, twice so that it plays once first and once second.
+func generateUnrankedGames(gameManager games.GameManager, bot repository.Bot, kind repository.GameKind) ([]repository.Pairing, error) {
+	opponents, err := unrankedOpponents(bot, kind)
+	if err != nil {
+		return []repository.Pairing{}, err
+	}
+
+	gameType, err := bot.GameType()
+	if err != nil {
+		return []repository.Pairing{}, err
+	}
+
+	return games.PairWithOpponents(gameManager, gameType, bot, opponents, kind, false), nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	MAX_WEBHOOKS          = 10
+	MIN_WEBHOOK_SECRET    = 16
+	MAX_WEBHOOK_SECRET    = 250
+	MAX_WEBHOOK_URL       = 1000
+	WEBHOOK_HISTORY_LIMIT = 50
+)
+
+// CreateWebhook registers a URL that will be sent events about the user's bots.
+// Each request is signed with the secret so that the receiver can check it came
+// from Merknera.
+func CreateWebhook(user repository.User, webhookUrl string, secret string) (repository.Webhook, error) {
+	if len(webhookUrl) > MAX_WEBHOOK_URL {
+		em := fmt.Sprintf("A webhook URL may be at most %d characters.", MAX_WEBHOOK_URL)
+		return repository.Webhook{}, errors.New(em)
+	}
+
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return repository.Webhook{}, errors.New("A webhook URL must be an absolute http or https URL.")
+	}
+
+	if len(secret) < MIN_WEBHOOK_SECRET || len(secret) > MAX_WEBHOOK_SECRET {
+		em := fmt.Sprintf("A webhook secret must be between %d and %d characters.", MIN_WEBHOOK_SECRET, MAX_WEBHOOK_SECRET)
+		return repository.Webhook{}, errors.New(em)
+	}
+
+	webhookList, err := user.ListWebhooks()
+	if err != nil {
+		return repository.Webhook{}, err
+	}
+	if len(webhookList) >= MAX_WEBHOOKS {
+		em := fmt.Sprintf("You may have at most %d webhooks.", MAX_WEBHOOKS)
+		return repository.Webhook{}, errors.New(em)
+	}
+
+	return user.CreateWebhook(webhookUrl, secret)
+}
+
+// DeleteWebhook deletes one of the user's webhooks and returns its id.
+func DeleteWebhook(user repository.User, webhookId int) (int, error) {
+	webhook, err := repository.GetWebhookById(webhookId)
+	if err != nil {
+		return 0, err
+	}
+
+	webhookUser, err := webhook.User()
+	if err != nil {
+		return 0, err
+	}
+
+	if webhookUser.Id != user.Id {
+		return 0, errors.New("You may only delete your own webhooks.")
+	}
+
+	err = user.DeleteWebhook(webhook.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	return webhook.Id, nil
+}
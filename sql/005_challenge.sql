@@ -0,0 +1,29 @@
+ALTER TABLE merknera_user
+ADD COLUMN accept_challenges BOOLEAN DEFAULT TRUE NOT NULL;
+
+CREATE TABLE challenge (
+  id                SERIAL PRIMARY KEY NOT NULL
+, merknera_user_id  INTEGER REFERENCES merknera_user (id) NOT NULL
+, challenger_bot_id INTEGER REFERENCES bot (id) NOT NULL
+, opponent_bot_id   INTEGER REFERENCES bot (id) NOT NULL
+, game_count        INTEGER NOT NULL CHECK (game_count > 0)
+, rated             BOOLEAN NOT NULL
+, created_datetime  TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON challenge (merknera_user_id, created_datetime);
+
+CREATE INDEX ON challenge (challenger_bot_id);
+
+CREATE INDEX ON challenge (opponent_bot_id);
+
+ALTER TABLE game
+ADD COLUMN kind VARCHAR(20) DEFAULT 'LADDER' NOT NULL CHECK (kind IN ('LADDER', 'CHALLENGE'));
+
+ALTER TABLE game
+ADD COLUMN rated BOOLEAN DEFAULT TRUE NOT NULL;
+
+ALTER TABLE game
+ADD COLUMN challenge_id INTEGER REFERENCES challenge (id) NULL;
+
+CREATE INDEX ON game (challenge_id);
@@ -0,0 +1,18 @@
+ALTER TABLE merknera_user
+ADD COLUMN admin BOOLEAN DEFAULT FALSE NOT NULL;
+
+ALTER TABLE bot
+ADD COLUMN stage VARCHAR(20) DEFAULT 'RANKED' NOT NULL CHECK (stage IN ('RANKED', 'SANDBOX'));
+
+ALTER TABLE bot
+ADD COLUMN sandbox_opponent BOOLEAN DEFAULT FALSE NOT NULL;
+
+CREATE INDEX ON bot (stage);
+
+ALTER TABLE game
+DROP CONSTRAINT game_kind_check;
+
+ALTER TABLE game
+ADD CONSTRAINT game_kind_check CHECK (kind IN ('LADDER', 'CHALLENGE', 'SANDBOX'));
+
+CREATE INDEX ON game (kind);
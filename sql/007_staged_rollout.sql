@@ -0,0 +1,11 @@
+ALTER TABLE bot
+DROP CONSTRAINT bot_stage_check;
+
+ALTER TABLE bot
+ADD CONSTRAINT bot_stage_check CHECK (stage IN ('RANKED', 'SANDBOX', 'QUALIFYING', 'DISCARDED'));
+
+ALTER TABLE game
+DROP CONSTRAINT game_kind_check;
+
+ALTER TABLE game
+ADD CONSTRAINT game_kind_check CHECK (kind IN ('LADDER', 'CHALLENGE', 'SANDBOX', 'QUALIFICATION'));
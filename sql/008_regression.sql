@@ -0,0 +1,5 @@
+ALTER TABLE game
+DROP CONSTRAINT game_kind_check;
+
+ALTER TABLE game
+ADD CONSTRAINT game_kind_check CHECK (kind IN ('LADDER', 'CHALLENGE', 'SANDBOX', 'QUALIFICATION', 'REGRESSION'));
@@ -0,0 +1,7 @@
+CREATE TABLE game_backlog (
+  game_id           INTEGER PRIMARY KEY REFERENCES game (id) ON DELETE CASCADE NOT NULL
+, created_datetime  TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, released_datetime TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX ON game_backlog (created_datetime) WHERE released_datetime IS NULL;
@@ -0,0 +1,12 @@
+ALTER TABLE game_type
+ADD COLUMN rating_engine VARCHAR(20) DEFAULT 'ELO' NOT NULL CHECK (rating_engine IN ('ELO', 'TRUESKILL'));
+
+CREATE TABLE bot_rating (
+  bot_id           INTEGER REFERENCES bot (id) NOT NULL
+, rating_engine    VARCHAR(20) NOT NULL
+, mu               DOUBLE PRECISION NOT NULL
+, sigma            DOUBLE PRECISION NOT NULL
+, games_rated      INTEGER DEFAULT 0 NOT NULL
+, updated_datetime TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, PRIMARY KEY (bot_id, rating_engine)
+);
@@ -0,0 +1,10 @@
+ALTER TABLE game_bot
+ADD COLUMN team INTEGER NULL;
+
+UPDATE game_bot
+SET team = play_sequence;
+
+ALTER TABLE game_bot
+ALTER COLUMN team SET NOT NULL;
+
+CREATE INDEX ON game_bot (game_id, team);
@@ -0,0 +1,27 @@
+CREATE TABLE move_job (
+  id                     SERIAL PRIMARY KEY NOT NULL
+, move_id                INTEGER UNIQUE REFERENCES move (id) ON DELETE CASCADE NOT NULL
+, status                 VARCHAR(20) DEFAULT 'QUEUED' NOT NULL CHECK (status IN ('QUEUED', 'RUNNING', 'FAILED'))
+, attempts               INTEGER DEFAULT 0 NOT NULL
+, lease_expires_datetime TIMESTAMP WITH TIME ZONE NULL
+, created_datetime       TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON move_job (status, id);
+
+-- Queue every move that is currently awaiting play, other than those in games
+-- still held in the backlog.
+INSERT INTO move_job (
+  move_id
+)
+SELECT m.id
+FROM move m
+JOIN game_bot gb
+  ON m.game_bot_id = gb.id
+WHERE m.status = 'AWAITING'
+AND NOT EXISTS (
+  SELECT 1
+  FROM game_backlog gbl
+  WHERE gbl.game_id = gb.game_id
+  AND gbl.released_datetime IS NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE worker_node (
+  id                 SERIAL PRIMARY KEY NOT NULL
+, hostname           VARCHAR(250) NOT NULL
+, pid                INTEGER NOT NULL
+, status             VARCHAR(20) DEFAULT 'ACTIVE' NOT NULL CHECK (status IN ('ACTIVE', 'DEAD'))
+, started_datetime   TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, heartbeat_datetime TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON worker_node (status, heartbeat_datetime);
+
+ALTER TABLE move_job
+ADD COLUMN worker_node_id INTEGER REFERENCES worker_node (id) NULL;
+
+CREATE INDEX ON move_job (worker_node_id);
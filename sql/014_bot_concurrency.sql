@@ -0,0 +1,17 @@
+ALTER TABLE bot
+ADD COLUMN max_concurrency INTEGER DEFAULT 1 NOT NULL CHECK (max_concurrency > 0);
+
+ALTER TABLE move_job
+ADD COLUMN bot_id INTEGER REFERENCES bot (id) NULL;
+
+UPDATE move_job mj
+SET bot_id = gb.bot_id
+FROM move m
+JOIN game_bot gb
+  ON m.game_bot_id = gb.id
+WHERE mj.move_id = m.id;
+
+ALTER TABLE move_job
+ALTER COLUMN bot_id SET NOT NULL;
+
+CREATE INDEX ON move_job (bot_id, status);
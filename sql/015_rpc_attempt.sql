@@ -0,0 +1,14 @@
+CREATE TABLE rpc_attempt (
+  id               SERIAL PRIMARY KEY NOT NULL
+, bot_id           INTEGER REFERENCES bot (id) ON DELETE CASCADE NOT NULL
+, move_id          INTEGER REFERENCES move (id) ON DELETE CASCADE NULL
+, method           VARCHAR(250) NOT NULL
+, attempt          INTEGER NOT NULL
+, start_datetime   TIMESTAMP WITH TIME ZONE NOT NULL
+, duration_ms      INTEGER NOT NULL
+, error            VARCHAR(1000) NULL
+, created_datetime TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON rpc_attempt (bot_id);
+CREATE INDEX ON rpc_attempt (move_id);
@@ -0,0 +1,5 @@
+ALTER TABLE worker_node
+DROP CONSTRAINT worker_node_status_check;
+
+ALTER TABLE worker_node
+ADD CONSTRAINT worker_node_status_check CHECK (status IN ('ACTIVE', 'STOPPED', 'DEAD'));
@@ -0,0 +1,5 @@
+ALTER TABLE bot
+DROP CONSTRAINT bot_status_check;
+
+ALTER TABLE bot
+ADD CONSTRAINT bot_status_check CHECK (status IN ('ONLINE', 'SUSPECT', 'OFFLINE', 'ERROR', 'SUPERSEDED'));
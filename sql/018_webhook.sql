@@ -0,0 +1,26 @@
+CREATE TABLE webhook (
+  id               SERIAL PRIMARY KEY NOT NULL
+, merknera_user_id INTEGER REFERENCES merknera_user (id) NOT NULL
+, url              VARCHAR(1000) NOT NULL
+, secret           VARCHAR(250) NOT NULL
+, created_datetime TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON webhook (merknera_user_id);
+
+CREATE TABLE webhook_delivery (
+  id                     SERIAL PRIMARY KEY NOT NULL
+, webhook_id             INTEGER REFERENCES webhook (id) ON DELETE CASCADE NOT NULL
+, event                  VARCHAR(50) NOT NULL
+, payload                TEXT NOT NULL
+, status                 VARCHAR(20) DEFAULT 'PENDING' NOT NULL CHECK (status IN ('PENDING', 'DELIVERED', 'FAILED'))
+, attempts               INTEGER DEFAULT 0 NOT NULL
+, response_status        INTEGER NULL
+, error                  VARCHAR(1000) NULL
+, next_attempt_datetime  TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, last_attempt_datetime  TIMESTAMP WITH TIME ZONE NULL
+, created_datetime       TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+);
+
+CREATE INDEX ON webhook_delivery (webhook_id);
+CREATE INDEX ON webhook_delivery (status, next_attempt_datetime);
@@ -0,0 +1,27 @@
+-- Moves are claimed in order of priority: 0 for moves in games that are already
+-- under way, 1 for the first move of a game and 2 for moves in background games
+-- such as sandbox, qualification and regression games.
+ALTER TABLE move_job
+ADD COLUMN priority INTEGER DEFAULT 1 NOT NULL CHECK (priority BETWEEN 0 AND 2);
+
+UPDATE move_job mj
+SET priority = CASE
+  WHEN g.kind IN ('SANDBOX', 'QUALIFICATION', 'REGRESSION') THEN 2
+  WHEN EXISTS (
+    SELECT 1
+    FROM move om
+    JOIN game_bot ogb
+      ON om.game_bot_id = ogb.id
+    WHERE ogb.game_id = g.id
+    AND om.id != m.id
+  ) THEN 0
+  ELSE 1
+END
+FROM move m
+JOIN game_bot gb
+  ON m.game_bot_id = gb.id
+JOIN game g
+  ON gb.game_id = g.id
+WHERE mj.move_id = m.id;
+
+CREATE INDEX ON move_job (status, priority, id);
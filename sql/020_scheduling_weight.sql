@@ -0,0 +1,6 @@
+-- A user's share of the worker pool relative to other users with moves waiting.
+ALTER TABLE merknera_user
+ADD COLUMN scheduling_weight INTEGER DEFAULT 1 NOT NULL CHECK (scheduling_weight > 0);
+
+-- Used to work out how many moves each user has had played recently.
+CREATE INDEX ON move (start_datetime);
@@ -0,0 +1,37 @@
+-- A dead letter for a move that could not be played, kept until the bot owner
+-- or an administrator retries, skips or abandons the move.
+CREATE TABLE failed_move (
+  id                  SERIAL PRIMARY KEY NOT NULL
+, move_id             INTEGER REFERENCES move (id) ON DELETE CASCADE NOT NULL
+, bot_id              INTEGER REFERENCES bot (id) ON DELETE CASCADE NOT NULL
+, reason              VARCHAR(20) NOT NULL CHECK (reason IN ('BOT_ERROR', 'LEASE_EXPIRED', 'INTERNAL'))
+, error               VARCHAR(1000) NULL
+, attempts            INTEGER DEFAULT 0 NOT NULL
+, last_response       TEXT NULL
+, status              VARCHAR(20) DEFAULT 'OPEN' NOT NULL CHECK (status IN ('OPEN', 'RETRIED', 'SKIPPED', 'ABANDONED'))
+, resolved_by_user_id INTEGER REFERENCES merknera_user (id) NULL
+, created_datetime    TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, resolved_datetime   TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- A move only has one open failure at a time.
+CREATE UNIQUE INDEX failed_move_open_move_id ON failed_move (move_id) WHERE status = 'OPEN';
+CREATE INDEX ON failed_move (bot_id);
+CREATE INDEX ON failed_move (status);
+
+-- Record the jobs that have already failed.
+INSERT INTO failed_move (
+  move_id
+, bot_id
+, reason
+, error
+, attempts
+)
+SELECT
+  mj.move_id
+, mj.bot_id
+, 'LEASE_EXPIRED'
+, 'The move was claimed too many times without being played.'
+, mj.attempts
+FROM move_job mj
+WHERE mj.status = 'FAILED';
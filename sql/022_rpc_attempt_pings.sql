@@ -0,0 +1,5 @@
+-- Successful calls that weren't part of a move, mostly pings, are no longer
+-- stored.
+DELETE FROM rpc_attempt
+WHERE move_id IS NULL
+  AND error IS NULL;
@@ -0,0 +1,88 @@
+-- The backlog holds the pairings of bots for games that have been scheduled but
+-- not yet created. A game is only created, along with its first move, when its
+-- pairing is released. Pairings that are dropped, because one of the bots has
+-- since been superseded, are released without a game.
+CREATE TABLE backlog_pairing (
+  id                SERIAL PRIMARY KEY NOT NULL
+, game_type_id      INTEGER REFERENCES game_type (id) NOT NULL
+, kind              VARCHAR(20) NOT NULL
+, rated             BOOLEAN NOT NULL
+, game_id           INTEGER REFERENCES game (id) ON DELETE SET NULL NULL
+, created_datetime  TIMESTAMP WITH TIME ZONE DEFAULT (now()) NOT NULL
+, released_datetime TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX ON backlog_pairing (created_datetime, id) WHERE released_datetime IS NULL;
+
+-- Teams play in order of team and the bots of a team in order of position.
+CREATE TABLE backlog_pairing_bot (
+  backlog_pairing_id INTEGER REFERENCES backlog_pairing (id) ON DELETE CASCADE NOT NULL
+, bot_id             INTEGER REFERENCES bot (id) ON DELETE CASCADE NOT NULL
+, team               INTEGER NOT NULL
+, position           INTEGER NOT NULL
+, PRIMARY KEY (backlog_pairing_id, team, position)
+);
+
+CREATE INDEX ON backlog_pairing_bot (bot_id);
+
+-- Games still held in the old backlog haven't been started so they are turned
+-- back into pairings and removed.
+INSERT INTO backlog_pairing (
+  game_type_id
+, kind
+, rated
+, game_id
+, created_datetime
+)
+SELECT
+  g.game_type_id
+, g.kind
+, g.rated
+, g.id
+, gbl.created_datetime
+FROM game_backlog gbl
+JOIN game g
+  ON gbl.game_id = g.id
+WHERE gbl.released_datetime IS NULL
+AND g.status = 'NOT_STARTED'
+ORDER BY gbl.created_datetime, gbl.game_id;
+
+INSERT INTO backlog_pairing_bot (
+  backlog_pairing_id
+, bot_id
+, team
+, position
+)
+SELECT
+  bp.id
+, gb.bot_id
+, gb.team
+, ROW_NUMBER() OVER (PARTITION BY gb.game_id, gb.team ORDER BY gb.play_sequence)
+FROM backlog_pairing bp
+JOIN game_bot gb
+  ON bp.game_id = gb.game_id;
+
+CREATE TEMPORARY TABLE backlog_game AS
+SELECT game_id
+FROM backlog_pairing
+WHERE game_id IS NOT NULL;
+
+UPDATE backlog_pairing
+SET game_id = NULL;
+
+DELETE FROM move
+WHERE game_bot_id IN (
+  SELECT gb.id
+  FROM game_bot gb
+  JOIN backlog_game bg
+    ON gb.game_id = bg.game_id
+);
+
+DELETE FROM game_bot
+WHERE game_id IN (SELECT game_id FROM backlog_game);
+
+DELETE FROM game
+WHERE id IN (SELECT game_id FROM backlog_game);
+
+DROP TABLE backlog_game;
+DROP TABLE game_backlog;
@@ -0,0 +1,5 @@
+ALTER TABLE failed_move
+DROP CONSTRAINT failed_move_reason_check;
+
+ALTER TABLE failed_move
+ADD CONSTRAINT failed_move_reason_check CHECK (reason IN ('BOT_ERROR', 'LEASE_EXPIRED', 'INTERNAL', 'UNREACHABLE'));
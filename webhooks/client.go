@@ -0,0 +1,103 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// blockedNetworks are the addresses webhooks may not be delivered to. Webhook
+// URLs are given by users so without this they could have Merknera make
+// requests to itself or to other services on its network.
+var blockedNetworks = parseNetworks(
+	// "This" network.
+	"0.0.0.0/8",
+	// Private networks.
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	// Carrier-grade NAT.
+	"100.64.0.0/10",
+	// Loopback.
+	"127.0.0.0/8",
+	"::1/128",
+	// Link local, including cloud metadata services.
+	"169.254.0.0/16",
+	"fe80::/10",
+	// Unique local.
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, n)
+	}
+
+	return networks
+}
+
+// isPublicIP returns false if the address is one that webhooks may not be
+// delivered to.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dialPublic resolves the host and connects to the first of its addresses,
+// refusing to connect if any of them isn't public. The vetted address is dialled
+// directly so the host can't resolve to a different address in between.
+func dialPublic(dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("The webhook host %s has no addresses.", host)
+		}
+		for _, a := range addrs {
+			if !isPublicIP(a.IP) {
+				return nil, fmt.Errorf("The webhook host %s resolves to %s which is not a public address.", host, a.IP)
+			}
+		}
+
+		return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+	}
+}
+
+// newClient returns the client deliveries are sent with. It only connects to
+// public addresses and doesn't follow redirects, which could otherwise lead it
+// to an address it would refuse to connect to.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialPublic(dialer),
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"log"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/repository"
+)
+
+// The body of every webhook request. Data depends on the event.
+type payload struct {
+	Event     string      `json:"event"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+type botData struct {
+	BotId   int    `json:"botId"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Status  string `json:"status"`
+}
+
+type gameData struct {
+	GameId   int    `json:"gameId"`
+	GameType string `json:"gameType"`
+	Kind     string `json:"kind"`
+	Rated    bool   `json:"rated"`
+}
+
+type botStatusChangedData struct {
+	Bot    botData `json:"bot"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Reason string  `json:"reason"`
+}
+
+type playerData struct {
+	Bot  botData `json:"bot"`
+	Team int     `json:"team"`
+	// Either WIN, LOSS or DRAW.
+	Outcome string `json:"outcome"`
+	// True if the bot belongs to the user the webhook was sent to.
+	Owned bool `json:"owned"`
+}
+
+type gameCompletedData struct {
+	Game    gameData     `json:"game"`
+	Result  string       `json:"result"`
+	Players []playerData `json:"players"`
+}
+
+type gameSuspendedData struct {
+	Game       gameData `json:"game"`
+	Bot        botData  `json:"bot"`
+	GameMoveId int      `json:"gameMoveId"`
+	Error      string   `json:"error"`
+}
+
+func newPayload(kind events.Kind, data interface{}) payload {
+	return payload{
+		Event:     string(kind),
+		Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Data:      data,
+	}
+}
+
+func newBotData(b repository.Bot) botData {
+	return botData{
+		BotId:   b.Id,
+		Name:    b.Name,
+		Version: b.Version,
+		Status:  string(b.Status),
+	}
+}
+
+func newGameData(g repository.Game, gt repository.GameType) gameData {
+	return gameData{
+		GameId:   g.Id,
+		GameType: gt.Mnemonic,
+		Kind:     string(g.Kind),
+		Rated:    g.Rated,
+	}
+}
+
+// newGameCompletedData describes the outcome of the game for every player. The
+// owned flag is left for the caller to set per user.
+func newGameCompletedData(gc events.GameCompleted) (gameCompletedData, []repository.Bot, error) {
+	// The game passed in may have been loaded before it was completed.
+	game, err := repository.GetGameById(gc.Game.Id)
+	if err != nil {
+		return gameCompletedData{}, nil, err
+	}
+
+	winningTeam, err := game.WinningTeam()
+	if err != nil {
+		return gameCompletedData{}, nil, err
+	}
+
+	data := gameCompletedData{
+		Game:   newGameData(game, gc.GameType),
+		Result: gc.Result,
+	}
+	var bots []repository.Bot
+	for _, p := range gc.Players {
+		pb, err := p.Bot()
+		if err != nil {
+			log.Printf("An error occurred in payload.newGameCompletedData():\n%s\n", err)
+			return gameCompletedData{}, nil, err
+		}
+
+		outcome := "DRAW"
+		if winningTeam != 0 {
+			if p.Team == winningTeam {
+				outcome = "WIN"
+			} else {
+				outcome = "LOSS"
+			}
+		}
+
+		data.Players = append(data.Players, playerData{
+			Bot:     newBotData(pb),
+			Team:    p.Team,
+			Outcome: outcome,
+		})
+		bots = append(bots, pb)
+	}
+
+	return data, bots, nil
+}
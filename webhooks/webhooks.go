@@ -0,0 +1,321 @@
+// Package webhooks sends signed JSON events to the URLs that users have
+// registered, telling them what their bots are up to.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mleonard87/merknera/events"
+	"github.com/mleonard87/merknera/repository"
+)
+
+const (
+	ENVVAR_WEBHOOK_INTERVAL     = "MERKNERA_WEBHOOK_INTERVAL"
+	ENVVAR_WEBHOOK_TIMEOUT      = "MERKNERA_WEBHOOK_TIMEOUT"
+	ENVVAR_WEBHOOK_MAX_ATTEMPTS = "MERKNERA_WEBHOOK_MAX_ATTEMPTS"
+	ENVVAR_WEBHOOK_BACKOFF      = "MERKNERA_WEBHOOK_BACKOFF"
+	ENVVAR_WEBHOOK_MAX_BACKOFF  = "MERKNERA_WEBHOOK_MAX_BACKOFF"
+
+	// The default number of seconds between checks for deliveries that are due.
+	// New deliveries made on this node are sent straight away.
+	DEFAULT_WEBHOOK_INTERVAL = 5
+	// The default number of seconds to wait for a webhook to respond.
+	DEFAULT_WEBHOOK_TIMEOUT = 10
+	// The default number of times a delivery is attempted before it is failed.
+	DEFAULT_WEBHOOK_MAX_ATTEMPTS = 5
+	// The default number of seconds to wait before retrying a delivery. The wait
+	// doubles after each failed attempt up to the maximum.
+	DEFAULT_WEBHOOK_BACKOFF     = 30
+	DEFAULT_WEBHOOK_MAX_BACKOFF = 3600
+
+	HEADER_EVENT     = "X-Merknera-Event"
+	HEADER_DELIVERY  = "X-Merknera-Delivery"
+	HEADER_SIGNATURE = "X-Merknera-Signature"
+)
+
+func envInt(name string, defaultValue int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return defaultValue
+	}
+
+	return v
+}
+
+func init() {
+	events.Subscribe(events.BOT_STATUS_CHANGED, queueBotStatusChanged)
+	events.Subscribe(events.GAME_COMPLETED, queueGameCompleted)
+	events.Subscribe(events.GAME_SUSPENDED, queueGameSuspended)
+}
+
+func queueBotStatusChanged(e events.Event) {
+	bsc, ok := e.(events.BotStatusChanged)
+	if !ok {
+		return
+	}
+
+	queue(bsc.Bot, newPayload(bsc.Kind(), botStatusChangedData{
+		Bot:    newBotData(bsc.Bot),
+		From:   string(bsc.From),
+		To:     string(bsc.To),
+		Reason: bsc.Reason,
+	}))
+}
+
+// queueGameCompleted sends the result to the owner of every player, once per
+// owner however many of the players they own.
+func queueGameCompleted(e events.Event) {
+	gc, ok := e.(events.GameCompleted)
+	if !ok {
+		return
+	}
+
+	data, bots, err := newGameCompletedData(gc)
+	if err != nil {
+		log.Printf("[webhooks] Error describing completed game (game id: %d):\n%v\n", gc.Game.Id, err)
+		return
+	}
+
+	var owners []repository.User
+	ownerIds := make([]int, len(bots))
+	for i, b := range bots {
+		owner, err := b.User()
+		if err != nil {
+			log.Printf("[webhooks] Error obtaining owner of bot (bot id: %d):\n%v\n", b.Id, err)
+			continue
+		}
+		ownerIds[i] = owner.Id
+
+		seen := false
+		for _, o := range owners {
+			seen = seen || o.Id == owner.Id
+		}
+		if !seen {
+			owners = append(owners, owner)
+		}
+	}
+
+	for _, owner := range owners {
+		ownerData := data
+		ownerData.Players = make([]playerData, len(data.Players))
+		for i, p := range data.Players {
+			p.Owned = ownerIds[i] == owner.Id
+			ownerData.Players[i] = p
+		}
+		queueForUser(owner, newPayload(gc.Kind(), ownerData))
+	}
+}
+
+func queueGameSuspended(e events.Event) {
+	gs, ok := e.(events.GameSuspended)
+	if !ok {
+		return
+	}
+
+	em := ""
+	if gs.Err != nil {
+		em = gs.Err.Error()
+	}
+
+	queue(gs.Bot, newPayload(gs.Kind(), gameSuspendedData{
+		Game:       newGameData(gs.Game, gs.GameType),
+		Bot:        newBotData(gs.Bot),
+		GameMoveId: gs.GameMove.Id,
+		Error:      em,
+	}))
+}
+
+// queue records a delivery of the payload to every webhook of the bot's owner.
+func queue(bot repository.Bot, p payload) {
+	owner, err := bot.User()
+	if err != nil {
+		log.Printf("[webhooks] Error obtaining owner of bot (bot id: %d):\n%v\n", bot.Id, err)
+		return
+	}
+
+	queueForUser(owner, p)
+}
+
+func queueForUser(user repository.User, p payload) {
+	webhookList, err := user.ListWebhooks()
+	if err != nil {
+		log.Printf("[webhooks] Error listing webhooks (user id: %d):\n%v\n", user.Id, err)
+		return
+	}
+	if len(webhookList) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("[webhooks] Error encoding %s payload:\n%v\n", p.Event, err)
+		return
+	}
+
+	for _, w := range webhookList {
+		err = w.CreateDelivery(p.Event, string(body))
+		if err != nil {
+			log.Printf("[webhooks] Error queueing %s delivery (webhook id: %d):\n%v\n", p.Event, w.Id, err)
+		}
+	}
+
+	wake()
+}
+
+// Sign returns the signature sent with a webhook request: the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook's secret, prefixed with the
+// name of the hash. Receivers should compute the same and compare.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// wakeDelivery is signalled when deliveries are queued so that they are sent
+// without waiting for the next check.
+var wakeDelivery = make(chan bool, 1)
+var stopDelivery = make(chan bool)
+var deliveryStopped = make(chan bool)
+
+func wake() {
+	select {
+	case wakeDelivery <- true:
+	default:
+	}
+}
+
+var client *http.Client
+
+// StartWebhookDelivery starts a background goroutine that sends due deliveries
+// and retries those that fail.
+func StartWebhookDelivery() {
+	interval := time.Duration(envInt(ENVVAR_WEBHOOK_INTERVAL, DEFAULT_WEBHOOK_INTERVAL)) * time.Second
+	timeout := time.Duration(envInt(ENVVAR_WEBHOOK_TIMEOUT, DEFAULT_WEBHOOK_TIMEOUT)) * time.Second
+	client = newClient(timeout)
+
+	fmt.Println("Starting webhook delivery")
+	go func() {
+		defer close(deliveryStopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-wakeDelivery:
+			case <-stopDelivery:
+				return
+			}
+
+			// A delivery being sent when asked to stop is allowed to finish.
+			// Anything else still due is picked up once Merknera restarts.
+			for deliverNext(timeout) {
+				select {
+				case <-stopDelivery:
+					return
+				default:
+				}
+			}
+		}
+	}()
+}
+
+// StopWebhookDelivery stops sending deliveries, waiting for any that is being
+// sent to finish.
+func StopWebhookDelivery() {
+	if client == nil {
+		return
+	}
+	close(stopDelivery)
+	<-deliveryStopped
+}
+
+// deliverNext sends the next delivery that is due and returns false if there
+// wasn't one.
+func deliverNext(timeout time.Duration) bool {
+	// The lease covers the request timing out with time to spare, after which
+	// another node may try again.
+	d, err := repository.ClaimWebhookDelivery(2 * timeout)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[webhooks] Error claiming delivery:\n%v\n", err)
+		}
+		return false
+	}
+
+	w, err := d.Webhook()
+	if err != nil {
+		log.Printf("[webhooks] Error obtaining webhook for delivery (delivery id: %d):\n%v\n", d.Id, err)
+		return true
+	}
+
+	responseStatus, err := send(w, d)
+
+	var nextAttempt *time.Time
+	if err != nil && d.Attempts+1 < envInt(ENVVAR_WEBHOOK_MAX_ATTEMPTS, DEFAULT_WEBHOOK_MAX_ATTEMPTS) {
+		t := time.Now().Add(backoff(d.Attempts))
+		nextAttempt = &t
+	}
+
+	err = d.RecordAttempt(responseStatus, err, nextAttempt)
+	if err != nil {
+		log.Printf("[webhooks] Error recording delivery attempt (delivery id: %d):\n%v\n", d.Id, err)
+	}
+
+	return true
+}
+
+// backoff returns how long to wait before retrying a delivery that has already
+// been attempted the given number of times.
+func backoff(attempts int) time.Duration {
+	b := time.Duration(envInt(ENVVAR_WEBHOOK_BACKOFF, DEFAULT_WEBHOOK_BACKOFF)) * time.Second
+	maxBackoff := time.Duration(envInt(ENVVAR_WEBHOOK_MAX_BACKOFF, DEFAULT_WEBHOOK_MAX_BACKOFF)) * time.Second
+	for i := 0; i < attempts && b < maxBackoff; i++ {
+		b *= 2
+	}
+	if b > maxBackoff {
+		b = maxBackoff
+	}
+
+	return b
+}
+
+// send POSTs the delivery to the webhook. Any response other than a 2xx is an
+// error. The response status is returned if there was a response.
+func send(w repository.Webhook, d repository.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Merknera-Webhook")
+	req.Header.Set(HEADER_EVENT, d.Event)
+	req.Header.Set(HEADER_DELIVERY, strconv.Itoa(d.Id))
+	req.Header.Set(HEADER_SIGNATURE, Sign(w.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("The webhook responded with %s.", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}